@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"glooko/internal/config"
+	"glooko/internal/events"
+	"glooko/internal/importer"
+	"glooko/internal/logging"
+	"glooko/internal/storage"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// Imports a Dexcom Clarity or LibreView CSV export for a user:
+//
+//	go run ./cmd/import -user <userID> -file export.csv
+func main() {
+	ctx := context.Background()
+	logger, _ := logging.NewProduction()
+	log := logger.Sugar()
+
+	userID := flag.String("user", "", "ID of the user the export belongs to")
+	path := flag.String("file", "", "path to the CSV export")
+	flag.Parse()
+
+	if *userID == "" || *path == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatal("failed to load config", zap.Error(err))
+	}
+
+	repos, err := storage.Open(ctx, cfg)
+	if err != nil {
+		log.Fatal("failed to open storage", zap.Error(err))
+	}
+
+	user, err := repos.Users.FindByID(ctx, *userID)
+	if err != nil {
+		log.Fatal("failed to fetch user", zap.Error(err))
+	}
+
+	file, err := os.Open(*path)
+	if err != nil {
+		log.Fatal("failed to open export", zap.Error(err))
+	}
+	defer file.Close()
+
+	detector := events.NewDetector(repos.Readings, repos.Events)
+	summary, importErr := importer.NewImporter(repos.Devices, repos.Readings, detector).Import(ctx, user, file)
+	if importErr != nil && !errors.Is(importErr, importer.ErrEventDetection) {
+		log.Fatal("failed to import readings", zap.Error(importErr))
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(summary)
+	if err != nil {
+		log.Fatal("failed to write summary", zap.Error(err))
+	}
+
+	// The readings are stored, the events of their days are detected again with the next upload for them
+	if importErr != nil {
+		log.Fatal("failed to detect events", zap.Error(importErr))
+	}
+}
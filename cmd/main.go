@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
-	"glooko/internal/adapters/mongodb"
 	"glooko/internal/api"
+	"glooko/internal/auth"
 	"glooko/internal/config"
+	"glooko/internal/logging"
+	"glooko/internal/storage"
 	"net/http"
 	"os"
 	"os/signal"
@@ -18,7 +20,7 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	logger, _ := zap.NewProduction()
+	logger, _ := logging.NewProduction()
 	log := logger.Sugar()
 
 	cfg, err := config.LoadConfig()
@@ -26,18 +28,29 @@ func main() {
 		log.Fatal("failed to load config", zap.Error(err))
 	}
 
-	log.Infof("config: %+v", cfg)
+	authCfg, err := config.LoadAuthConfig()
+	if err != nil {
+		log.Fatal("failed to load auth config", zap.Error(err))
+	}
+
+	log.Infow("loaded config", "config", cfg, "auth", authCfg)
 
-	mongoDB, err := mongodb.NewMongoDB(ctx, cfg.MongoDBURI, cfg.MongoDBName)
+	repos, err := storage.Open(ctx, cfg)
 	if err != nil {
-		log.Fatal("failed to connect to MongoDB", zap.Error(err))
+		log.Fatal("failed to open storage", zap.Error(err))
 	}
 
-	userRepository := mongodb.NewUserRepository(mongoDB)
-	deviceRepository := mongodb.NewDeviceRepository(mongoDB)
-	readingsRepository := mongodb.NewReadingRepository(mongoDB)
+	authenticator, err := auth.NewAuthenticator(auth.Config{
+		HMACSecret: authCfg.JWTHMACSecret.Reveal(),
+		JWKSFile:   authCfg.JWTJWKSFile,
+		Issuer:     authCfg.JWTIssuer,
+		Audience:   authCfg.JWTAudience,
+	})
+	if err != nil {
+		log.Fatal("failed to set up authentication", zap.Error(err))
+	}
 
-	mainAPI := api.NewAPI(log, userRepository, deviceRepository, readingsRepository)
+	mainAPI := api.NewAPI(log, repos.Users, repos.Devices, repos.Readings, repos.Events, repos.Audit, authenticator)
 
 	server := &http.Server{
 		Addr:    cfg.ServerPort,
@@ -49,7 +62,8 @@ func main() {
 	go func() {
 		<-sig
 
-		shutdownCtx, _ := context.WithTimeout(ctx, 30*time.Second)
+		shutdownCtx, shutdownCancel := context.WithTimeout(ctx, 30*time.Second)
+		defer shutdownCancel()
 
 		go func() {
 			<-shutdownCtx.Done()
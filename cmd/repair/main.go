@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"glooko/internal/adapters/mongodb"
+	"glooko/internal/config"
+	"glooko/internal/logging"
+	"glooko/internal/storage"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// Merges readings documents duplicated for the same user, device and day and enforces one
+// document per device day with a unique index:
+//
+//	go run ./cmd/repair -dry-run
+//	go run ./cmd/repair
+func main() {
+	ctx := context.Background()
+	logger, _ := logging.NewProduction()
+	log := logger.Sugar()
+
+	dryRun := flag.Bool("dry-run", false, "only count the duplicate buckets")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatal("failed to load config", zap.Error(err))
+	}
+
+	repos, err := storage.Open(ctx, cfg)
+	if err != nil {
+		log.Fatal("failed to open storage", zap.Error(err))
+	}
+	if repos.MongoDB == nil {
+		log.Fatalf("nothing to repair for the %s storage driver", cfg.StorageDriver)
+	}
+
+	repair, err := mongodb.RepairReadingBuckets(ctx, repos.MongoDB.Database, *dryRun)
+	if err != nil {
+		log.Fatal("failed to repair readings", zap.Error(err))
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(repair)
+	if err != nil {
+		log.Fatal("failed to write summary", zap.Error(err))
+	}
+}
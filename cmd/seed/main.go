@@ -2,25 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"glooko/internal/adapters/mongodb"
 	"glooko/internal/config"
 	"glooko/internal/domain"
+	"glooko/internal/logging"
+	"glooko/internal/storage"
 	"math/rand"
 	"strconv"
 	"time"
 
-	"github.com/pkg/errors"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 )
 
 func main() {
 	ctx := context.Background()
-	logger, _ := zap.NewProduction()
+	logger, _ := logging.NewProduction()
 	log := logger.Sugar()
 
 	cfg, err := config.LoadConfig()
@@ -28,18 +26,20 @@ func main() {
 		log.Fatal("failed to load config", zap.Error(err))
 	}
 
-	mongoDB, err := mongodb.NewMongoDB(ctx, cfg.MongoDBURI, cfg.MongoDBName)
+	repos, err := storage.Open(ctx, cfg)
 	if err != nil {
-		log.Fatal("failed to connect to MongoDB", zap.Error(err))
+		log.Fatal("failed to open storage", zap.Error(err))
 	}
 
-	err = mongodb.SetUpCollections(ctx, mongoDB.Database)
-	if err != nil {
-		log.Fatal("failed to set up collections", zap.Error(err))
+	if repos.MongoDB != nil {
+		err = mongodb.SetUpCollections(ctx, repos.MongoDB.Database)
+		if err != nil {
+			log.Fatal("failed to set up collections", zap.Error(err))
+		}
 	}
 
-	userRepo := mongodb.NewUserRepository(mongoDB)
-	deviceRepo := mongodb.NewDeviceRepository(mongoDB)
+	userRepo := repos.Users
+	deviceRepo := repos.Devices
 
 	users := make([]domain.User, 10)
 	devices := []domain.Device{
@@ -70,6 +70,8 @@ func main() {
 			device := devices[deviceIndex]
 
 			device.UserID = u.ID
+			device.Status = domain.DeviceActive
+			device.ActivatedAt = time.Now().AddDate(0, 0, -5)
 			d, err := deviceRepo.Save(ctx, device)
 			if err != nil {
 				log.Fatal("Failed to save device", zap.Error(err))
@@ -77,86 +79,34 @@ func main() {
 
 			daysInPast := 5
 			startDate := time.Now().AddDate(0, 0, -daysInPast)
-			readingsBatch := []domain.ReadingEntry{}
+			readingsBatch := []domain.DeviceReading{}
 
 			for day := 0; day < daysInPast; day++ {
 				date := startDate.AddDate(0, 0, day)
 				for j := 0; j < 24*12; j++ { // Generate readings every 5 minutes
-					reading := domain.ReadingEntry{
-						Time:  date.Add(5 * time.Minute * time.Duration(j)),
-						Value: rand.Intn(1024),
+					reading := domain.DeviceReading{
+						DeviceID: d.ID.Hex(),
+						Time:     date.Add(5 * time.Minute * time.Duration(j)),
+						Value:    rand.Intn(1024),
 					}
 					readingsBatch = append(readingsBatch, reading)
 				}
-				// Process the batch for each day
-				err = addDayReadingsAndUpdateStats(ctx, mongoDB.Database, d.ID.Hex(), u.ID.Hex(), date, readingsBatch)
-				if err != nil {
-					log.Fatal("Failed to add day batch of readings", zap.Error(err))
+			}
+
+			results, err := repos.Readings.AddReadingsAndUpdateStats(ctx, u.ID.Hex(), readingsBatch)
+			if err != nil {
+				log.Fatal("Failed to add batch of readings", zap.Error(err))
+			}
+			for _, err := range results {
+				if err != nil && !errors.Is(err, domain.ErrDuplicate) {
+					log.Fatal("Failed to add reading", zap.Error(err))
 				}
-				readingsBatch = []domain.ReadingEntry{} // Clear the batch for the next day
 			}
 		}
 	}
 
 	log.Infof("Seeded %d users with devices and readings", len(users))
-}
-
-func addDayReadingsAndUpdateStats(ctx context.Context, db *mongo.Database, deviceID, userID string, day time.Time, readings []domain.ReadingEntry) error {
-	col := db.Collection("readings")
-
-	userObjectID, err := primitive.ObjectIDFromHex(userID)
-	if err != nil {
-		return errors.Wrap(err, "failed to parse userID")
+	if repos.MongoDB == nil {
+		log.Infof("%s storage keeps no data after the seed exits", cfg.StorageDriver)
 	}
-
-	deviceObjID, err := primitive.ObjectIDFromHex(deviceID)
-	if err != nil {
-		return errors.Wrap(err, "failed to parse deviceID")
-	}
-
-	// Normalize day to ensure consistent day boundary
-	normalizedDay := day.Truncate(24 * time.Hour)
-	filter := bson.M{"deviceId": deviceObjID, "day": normalizedDay}
-	update := bson.D{{Key: "$setOnInsert", Value: bson.M{"userId": userObjectID, "deviceId": deviceObjID, "day": normalizedDay}}}
-
-	readingsArray := bson.A{}
-	sumValues := 0
-	minValue := int(^uint(0) >> 1) // Initialize with the maximum int value
-	maxValue := -1
-
-	for _, reading := range readings {
-		readingsArray = append(readingsArray, bson.M{"time": reading.Time, "value": reading.Value})
-		sumValues += reading.Value
-		if reading.Value < minValue {
-			minValue = reading.Value
-		}
-		if reading.Value > maxValue {
-			maxValue = reading.Value
-		}
-	}
-
-	update = append(update, bson.E{Key: "$push", Value: bson.M{"readings": bson.M{"$each": readingsArray}}})
-	update = append(update, bson.E{Key: "$min", Value: bson.M{"minValue": minValue}})
-	update = append(update, bson.E{Key: "$max", Value: bson.M{"maxValue": maxValue}})
-	update = append(update, bson.E{Key: "$inc", Value: bson.M{"sumValues": sumValues, "countReadings": len(readings)}})
-
-	opts := options.FindOneAndUpdate().SetUpsert(true)
-	var updatedReading domain.Reading
-
-	// Perform the update and calculate the new average if needed
-	err = col.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updatedReading)
-	if err != nil && err != mongo.ErrNoDocuments {
-		return err
-	}
-
-	if updatedReading.CountReadings > 0 {
-		newAvg := float64(updatedReading.SumValues) / float64(updatedReading.CountReadings)
-		avgUpdate := bson.M{"$set": bson.M{"avgValue": newAvg}}
-		_, err = col.UpdateOne(ctx, filter, avgUpdate)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
 }
@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"context"
+	"glooko/internal/domain"
+	"glooko/internal/ports"
+	"slices"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditRepository only appends to and queries the audit trail.
+type AuditRepository struct {
+	store *Store
+}
+
+func NewAuditRepository(store *Store) ports.AuditRepository {
+	return &AuditRepository{store: store}
+}
+
+func (r *AuditRepository) Record(ctx context.Context, entry domain.AuditEntry) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	entry.ID = primitive.NewObjectID()
+	r.store.audit = append(r.store.audit, entry)
+
+	return nil
+}
+
+func (r *AuditRepository) Find(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEntry, int64, error) {
+	r.store.mu.RLock()
+	entries := []domain.AuditEntry{}
+	for _, entry := range r.store.audit {
+		if filter.Actor != "" && entry.Actor != filter.Actor {
+			continue
+		}
+		if filter.Subject != "" && entry.Subject != filter.Subject {
+			continue
+		}
+		if !filter.From.IsZero() && entry.Time.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && !entry.Time.Before(filter.To) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	r.store.mu.RUnlock()
+
+	// Newest first, entries recorded in the same instant latest first like the Mongo adapter
+	slices.Reverse(entries)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.After(entries[j].Time)
+	})
+
+	total := int64(len(entries))
+	return page(entries, filter.Offset, filter.Limit), total, nil
+}
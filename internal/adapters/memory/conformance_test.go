@@ -0,0 +1,32 @@
+package memory
+
+import (
+	"testing"
+
+	"glooko/internal/ports"
+	"glooko/internal/ports/porttest"
+)
+
+func TestUserRepositoryConformance(t *testing.T) {
+	porttest.TestUserRepository(t, func(t *testing.T) ports.UserRepository {
+		return NewUserRepository(NewStore())
+	})
+}
+
+func TestDeviceRepositoryConformance(t *testing.T) {
+	porttest.TestDeviceRepository(t, func(t *testing.T) ports.DeviceRepository {
+		return NewDeviceRepository(NewStore())
+	})
+}
+
+func TestReadingRepositoryConformance(t *testing.T) {
+	porttest.TestReadingRepository(t, func(t *testing.T) ports.ReadingRepository {
+		return NewReadingRepository(NewStore())
+	})
+}
+
+func TestEventRepositoryConformance(t *testing.T) {
+	porttest.TestEventRepository(t, func(t *testing.T) ports.EventRepository {
+		return NewEventRepository(NewStore())
+	})
+}
@@ -0,0 +1,137 @@
+package memory
+
+import (
+	"context"
+	"glooko/internal/domain"
+	"glooko/internal/ports"
+	"sort"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type DeviceRepository struct {
+	store *Store
+}
+
+func NewDeviceRepository(store *Store) ports.DeviceRepository {
+	return &DeviceRepository{store: store}
+}
+
+func (r *DeviceRepository) Save(ctx context.Context, device domain.Device) (domain.Device, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if device.ID.IsZero() {
+		device.ID = primitive.NewObjectID()
+	}
+	if _, exists := r.store.devices[device.ID]; exists {
+		return domain.Device{}, errors.Wrap(domain.ErrConflict, "device already exists")
+	}
+
+	r.store.devices[device.ID] = device
+	return device, nil
+}
+
+func (r *DeviceRepository) FindByID(ctx context.Context, id string) (domain.Device, error) {
+	oid, err := parseID(id, "deviceID")
+	if err != nil {
+		return domain.Device{}, err
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	device, ok := r.store.devices[oid]
+	if !ok {
+		return domain.Device{}, errors.Wrap(domain.ErrNotFound, "device not found")
+	}
+
+	return device, nil
+}
+
+func (r *DeviceRepository) FindByUser(ctx context.Context, userID string) ([]domain.Device, error) {
+	userObjectID, err := parseID(userID, "userID")
+	if err != nil {
+		return nil, err
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	devices := []domain.Device{}
+	for _, device := range r.store.devices {
+		if device.UserID == userObjectID {
+			devices = append(devices, device)
+		}
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].ID.Hex() < devices[j].ID.Hex()
+	})
+
+	return devices, nil
+}
+
+func (r *DeviceRepository) Update(ctx context.Context, id string, update domain.DeviceUpdate) (domain.Device, error) {
+	oid, err := parseID(id, "deviceID")
+	if err != nil {
+		return domain.Device{}, err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	device, ok := r.store.devices[oid]
+	if !ok {
+		return domain.Device{}, errors.Wrap(domain.ErrNotFound, "device not found")
+	}
+
+	if update.UserID != nil {
+		device.UserID = *update.UserID
+	}
+	if update.Manufacturer != nil {
+		device.Manufacturer = *update.Manufacturer
+	}
+	if update.Model != nil {
+		device.Model = *update.Model
+	}
+	if update.SerialNumber != nil {
+		device.SerialNumber = *update.SerialNumber
+	}
+	if update.Status != nil {
+		device.Status = *update.Status
+	}
+	if update.ReplacedAt != nil {
+		replacedAt := *update.ReplacedAt
+		device.ReplacedAt = &replacedAt
+	}
+	if update.ReplacedBy != nil {
+		replacedBy := *update.ReplacedBy
+		device.ReplacedBy = &replacedBy
+	}
+	if update.RetiredAt != nil {
+		retiredAt := *update.RetiredAt
+		device.RetiredAt = &retiredAt
+	}
+
+	r.store.devices[oid] = device
+	return device, nil
+}
+
+func (r *DeviceRepository) Delete(ctx context.Context, id string) error {
+	oid, err := parseID(id, "deviceID")
+	if err != nil {
+		return err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.devices[oid]; !ok {
+		return errors.Wrap(domain.ErrNotFound, "device not found")
+	}
+	delete(r.store.devices, oid)
+
+	return nil
+}
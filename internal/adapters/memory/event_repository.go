@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+	"glooko/internal/domain"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type EventRepository struct {
+	store *Store
+}
+
+func NewEventRepository(store *Store) *EventRepository {
+	return &EventRepository{store: store}
+}
+
+func (r *EventRepository) ReplaceEvents(ctx context.Context, userID, deviceID string, startDate, endDate time.Time, events []domain.GlucoseEvent) error {
+	userObjectID, err := parseID(userID, "userID")
+	if err != nil {
+		return err
+	}
+	deviceObjectID, err := parseID(deviceID, "deviceID")
+	if err != nil {
+		return err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for key, event := range r.store.events {
+		if key.userID == userObjectID && key.deviceID == deviceObjectID && !event.Start.Before(startDate) && !event.Start.After(endDate) {
+			delete(r.store.events, key)
+		}
+	}
+
+	for _, event := range events {
+		event.ID = primitive.NewObjectID()
+		key := eventKey{userID: event.UserID, deviceID: event.DeviceID, typ: event.Type, start: event.Start.UnixNano()}
+		r.store.events[key] = event
+	}
+
+	return nil
+}
+
+func (r *EventRepository) FetchEvents(ctx context.Context, userID string, startDate, endDate time.Time) ([]domain.GlucoseEvent, error) {
+	userObjectID, err := parseID(userID, "userID")
+	if err != nil {
+		return nil, err
+	}
+
+	r.store.mu.RLock()
+	events := []domain.GlucoseEvent{}
+	for _, event := range r.store.events {
+		if event.UserID != userObjectID || event.Start.Before(startDate) || event.Start.After(endDate) {
+			continue
+		}
+		events = append(events, event)
+	}
+	r.store.mu.RUnlock()
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+
+	return events, nil
+}
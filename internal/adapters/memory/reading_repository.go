@@ -0,0 +1,182 @@
+package memory
+
+import (
+	"context"
+	"glooko/internal/domain"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ReadingRepository struct {
+	store *Store
+}
+
+func NewReadingRepository(store *Store) *ReadingRepository {
+	return &ReadingRepository{store: store}
+}
+
+// AddReadingAndUpdateStats appends the reading to the bucket of its device and day, creating it
+// on the first reading, and keeps the min, max, sum, count and average of the bucket current.
+// A reading the bucket already holds for the same time leaves it unchanged.
+func (r *ReadingRepository) AddReadingAndUpdateStats(ctx context.Context, deviceID, userID string, value int, timestamp time.Time) error {
+	_, err := r.addReading(deviceID, userID, value, timestamp)
+	return err
+}
+
+// addReading adds the reading to its bucket and tells whether it was stored, false when the device
+// already has a reading at timestamp. Like MongoDB the time is kept to the millisecond, readings
+// are identified by it.
+func (r *ReadingRepository) addReading(deviceID, userID string, value int, timestamp time.Time) (bool, error) {
+	userObjectID, err := parseID(userID, "userID")
+	if err != nil {
+		return false, err
+	}
+
+	deviceObjID, err := parseID(deviceID, "deviceID")
+	if err != nil {
+		return false, err
+	}
+
+	timestamp = time.UnixMilli(timestamp.UnixMilli()).In(timestamp.Location())
+	day := domain.DayOf(timestamp)
+	key := readingKey{userID: userObjectID, deviceID: deviceObjID, day: day.Unix()}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	reading, ok := r.store.readings[key]
+	if !ok {
+		reading = &domain.Reading{
+			ID:       primitive.NewObjectID(),
+			UserID:   userObjectID,
+			DeviceID: deviceObjID,
+			Day:      day,
+			MinValue: value,
+			MaxValue: value,
+		}
+		r.store.readings[key] = reading
+	}
+
+	for _, entry := range reading.Readings {
+		if entry.Time.UnixMilli() == timestamp.UnixMilli() {
+			return false, nil
+		}
+	}
+
+	reading.Readings = append(reading.Readings, domain.ReadingEntry{Time: timestamp, Value: value})
+	reading.MinValue = min(reading.MinValue, value)
+	reading.MaxValue = max(reading.MaxValue, value)
+	reading.SumValues += value
+	reading.CountReadings++
+	reading.AvgValue = float64(reading.SumValues) / float64(reading.CountReadings)
+
+	return true, nil
+}
+
+// AddReadingsAndUpdateStats adds the readings one by one, there are no round trips to save.
+func (r *ReadingRepository) AddReadingsAndUpdateStats(ctx context.Context, userID string, readings []domain.DeviceReading) ([]error, error) {
+	_, err := parseID(userID, "userID")
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]error, len(readings))
+	for i, reading := range readings {
+		stored, err := r.addReading(reading.DeviceID, userID, reading.Value, reading.Time)
+		if err == nil && !stored {
+			err = errors.Wrap(domain.ErrDuplicate, "reading already stored")
+		}
+		results[i] = err
+	}
+
+	return results, nil
+}
+
+func (r *ReadingRepository) FetchReadings(ctx context.Context, userID string, startDate, endDate time.Time) ([]domain.Reading, error) {
+	readings := []domain.Reading{}
+	err := r.StreamReadings(ctx, userID, startDate, endDate, func(reading domain.Reading) error {
+		readings = append(readings, reading)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return readings, nil
+}
+
+func (r *ReadingRepository) StreamReadings(ctx context.Context, userID string, startDate, endDate time.Time, fn func(domain.Reading) error) error {
+	userObjectID, err := parseID(userID, "userID")
+	if err != nil {
+		return err
+	}
+
+	// Copy the matching buckets so fn runs without holding the lock
+	r.store.mu.RLock()
+	var readings []domain.Reading
+	for _, reading := range r.store.readings {
+		if reading.UserID != userObjectID || reading.Day.Before(startDate) || reading.Day.After(endDate) {
+			continue
+		}
+		copied := *reading
+		copied.Readings = slices.Clone(reading.Readings)
+		readings = append(readings, copied)
+	}
+	r.store.mu.RUnlock()
+
+	sort.Slice(readings, func(i, j int) bool {
+		if !readings[i].Day.Equal(readings[j].Day) {
+			return readings[i].Day.Before(readings[j].Day)
+		}
+		return readings[i].DeviceID.Hex() < readings[j].DeviceID.Hex()
+	})
+
+	for _, reading := range readings {
+		if err := fn(reading); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FetchDevicesOverview counts the readings of each device per day over the last days, by day.
+func (r *ReadingRepository) FetchDevicesOverview(ctx context.Context, userID string, days int) ([]domain.DayDeviceCounts, error) {
+	userObjectID, err := parseID(userID, "userID")
+	if err != nil {
+		return nil, err
+	}
+
+	startDate := time.Now().AddDate(0, 0, -days)
+
+	r.store.mu.RLock()
+	byDay := map[time.Time][]domain.DeviceCount{}
+	for _, reading := range r.store.readings {
+		if reading.UserID != userObjectID || reading.Day.Before(startDate) {
+			continue
+		}
+		byDay[reading.Day] = append(byDay[reading.Day], domain.DeviceCount{
+			DeviceID: reading.DeviceID.Hex(),
+			Count:    reading.CountReadings,
+		})
+	}
+	r.store.mu.RUnlock()
+
+	results := make([]domain.DayDeviceCounts, 0, len(byDay))
+	for day, devices := range byDay {
+		sort.Slice(devices, func(i, j int) bool {
+			return devices[i].DeviceID < devices[j].DeviceID
+		})
+		results = append(results, domain.DayDeviceCounts{Day: day, Devices: devices})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Day.Before(results[j].Day)
+	})
+
+	return results, nil
+}
@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReadingRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewReadingRepository(NewStore())
+
+	userID := primitive.NewObjectID().Hex()
+	deviceID := primitive.NewObjectID().Hex()
+	otherDeviceID := primitive.NewObjectID().Hex()
+	day := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	readings := []struct {
+		deviceID string
+		value    int
+		time     time.Time
+	}{
+		{deviceID, 120, day.Add(8 * time.Hour)},
+		{deviceID, 80, day.Add(9 * time.Hour)},
+		{deviceID, 190, day.Add(10 * time.Hour)},
+		{deviceID, 150, day.Add(32 * time.Hour)},
+		{otherDeviceID, 100, day.Add(8 * time.Hour)},
+	}
+	for _, reading := range readings {
+		err := repo.AddReadingAndUpdateStats(ctx, reading.deviceID, userID, reading.value, reading.time)
+		assert.NoError(t, err)
+	}
+
+	t.Run("Buckets Per Device And Day", func(t *testing.T) {
+		fetched, err := repo.FetchReadings(ctx, userID, day, day.AddDate(0, 0, 1))
+		assert.NoError(t, err)
+		assert.Len(t, fetched, 3)
+
+		assert.Equal(t, day, fetched[0].Day)
+		assert.Equal(t, day, fetched[1].Day)
+		assert.Equal(t, day.AddDate(0, 0, 1), fetched[2].Day)
+		assert.Equal(t, deviceID, fetched[2].DeviceID.Hex())
+		assert.Equal(t, 1, fetched[2].CountReadings)
+	})
+
+	t.Run("Keeps Stats", func(t *testing.T) {
+		fetched, err := repo.FetchReadings(ctx, userID, day, day)
+		assert.NoError(t, err)
+
+		for _, reading := range fetched {
+			if reading.DeviceID.Hex() != deviceID {
+				continue
+			}
+			assert.Len(t, reading.Readings, 3)
+			assert.Equal(t, 80, reading.MinValue)
+			assert.Equal(t, 190, reading.MaxValue)
+			assert.Equal(t, 390, reading.SumValues)
+			assert.Equal(t, 3, reading.CountReadings)
+			assert.Equal(t, 130.0, reading.AvgValue)
+		}
+	})
+
+	t.Run("Range Excludes Other Days", func(t *testing.T) {
+		fetched, err := repo.FetchReadings(ctx, userID, day.AddDate(0, 0, 2), day.AddDate(0, 0, 3))
+		assert.NoError(t, err)
+		assert.Empty(t, fetched)
+	})
+
+	t.Run("Stops Streaming At First Error", func(t *testing.T) {
+		calls := 0
+		err := repo.StreamReadings(ctx, userID, day, day.AddDate(0, 0, 1), func(domain.Reading) error {
+			calls++
+			return assert.AnError
+		})
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Invalid User ID", func(t *testing.T) {
+		_, err := repo.FetchReadings(ctx, "invalid", day, day)
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+
+		err = repo.AddReadingAndUpdateStats(ctx, deviceID, "invalid", 100, day)
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+	})
+}
@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"sync"
+
+	"glooko/internal/domain"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Store holds all data of the in-memory adapters, the counterpart of a MongoDB database.
+// Data lives as long as the process, a single lock serializes access across repositories.
+type Store struct {
+	mu       sync.RWMutex
+	users    map[primitive.ObjectID]domain.User
+	devices  map[primitive.ObjectID]domain.Device
+	readings map[readingKey]*domain.Reading
+	events   map[eventKey]domain.GlucoseEvent
+	audit    []domain.AuditEntry
+}
+
+// readingKey identifies the daily bucket of a device's readings.
+type readingKey struct {
+	userID   primitive.ObjectID
+	deviceID primitive.ObjectID
+	day      int64
+}
+
+// eventKey identifies an event the way the unique index of the events collection does.
+type eventKey struct {
+	userID   primitive.ObjectID
+	deviceID primitive.ObjectID
+	typ      domain.EventType
+	start    int64
+}
+
+func NewStore() *Store {
+	return &Store{
+		users:    map[primitive.ObjectID]domain.User{},
+		devices:  map[primitive.ObjectID]domain.Device{},
+		readings: map[readingKey]*domain.Reading{},
+		events:   map[eventKey]domain.GlucoseEvent{},
+	}
+}
+
+// parseID parses the hex ObjectID of an entity, name is used in the error of malformed IDs.
+func parseID(id, name string) (primitive.ObjectID, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, errors.Wrapf(domain.ErrInvalidID, "failed to parse %s", name)
+	}
+	return oid, nil
+}
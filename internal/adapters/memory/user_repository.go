@@ -0,0 +1,188 @@
+package memory
+
+import (
+	"context"
+	"glooko/internal/domain"
+	"glooko/internal/ports"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type UserRepository struct {
+	store *Store
+}
+
+func NewUserRepository(store *Store) ports.UserRepository {
+	return &UserRepository{store: store}
+}
+
+func (r *UserRepository) Save(ctx context.Context, user domain.User) (domain.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	if _, exists := r.store.users[user.ID]; exists {
+		return domain.User{}, errors.Wrap(domain.ErrConflict, "user already exists")
+	}
+
+	r.store.users[user.ID] = cloneUser(user)
+	return cloneUser(user), nil
+}
+
+func (r *UserRepository) FindByID(ctx context.Context, id string) (domain.User, error) {
+	oid, err := parseID(id, "userID")
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	user, ok := r.store.users[oid]
+	if !ok {
+		return domain.User{}, errors.Wrap(domain.ErrNotFound, "user not found")
+	}
+
+	return cloneUser(user), nil
+}
+
+func (r *UserRepository) Find(ctx context.Context, filter domain.UserFilter) ([]domain.User, int64, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	lastNamePrefix := strings.ToLower(filter.LastName)
+	matched := []domain.User{}
+	for _, user := range r.store.users {
+		if filter.Email != "" && user.Email != filter.Email {
+			continue
+		}
+		if !strings.HasPrefix(strings.ToLower(user.LastName), lastNamePrefix) {
+			continue
+		}
+		if filter.SupportQueues != nil && !slices.Contains(filter.SupportQueues, user.SupportQueue) {
+			continue
+		}
+		matched = append(matched, user)
+	}
+
+	// Same order as the MongoDB adapter: last name, first name, then ID
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if a.LastName != b.LastName {
+			return a.LastName < b.LastName
+		}
+		if a.FirstName != b.FirstName {
+			return a.FirstName < b.FirstName
+		}
+		return a.ID.Hex() < b.ID.Hex()
+	})
+
+	total := int64(len(matched))
+	matched = page(matched, filter.Offset, filter.Limit)
+
+	users := make([]domain.User, len(matched))
+	for i, user := range matched {
+		users[i] = cloneUser(user)
+	}
+
+	return users, total, nil
+}
+
+func (r *UserRepository) Update(ctx context.Context, id string, update domain.UserUpdate) (domain.User, error) {
+	oid, err := parseID(id, "userID")
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[oid]
+	if !ok {
+		return domain.User{}, errors.Wrap(domain.ErrNotFound, "user not found")
+	}
+
+	if update.FirstName != nil {
+		user.FirstName = *update.FirstName
+	}
+	if update.LastName != nil {
+		user.LastName = *update.LastName
+	}
+	if update.DateOfBirth != nil {
+		user.DateOfBirth = *update.DateOfBirth
+	}
+	if update.Email != nil {
+		user.Email = *update.Email
+	}
+	if update.PhoneNumber != nil {
+		user.PhoneNumber = *update.PhoneNumber
+	}
+	if update.Timezone != nil {
+		user.Timezone = *update.Timezone
+	}
+	if update.TargetRange != nil {
+		targetRange := *update.TargetRange
+		user.TargetRange = &targetRange
+	}
+	if update.Unit != nil {
+		user.Unit = *update.Unit
+	}
+	if update.SupportQueue != nil {
+		user.SupportQueue = *update.SupportQueue
+	}
+	if update.CareTeam != nil {
+		user.CareTeam = slices.Clone(*update.CareTeam)
+	}
+	if update.NightscoutSecretHash != nil {
+		user.NightscoutSecretHash = *update.NightscoutSecretHash
+	}
+
+	r.store.users[oid] = user
+	return cloneUser(user), nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id string) error {
+	oid, err := parseID(id, "userID")
+	if err != nil {
+		return err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[oid]; !ok {
+		return errors.Wrap(domain.ErrNotFound, "user not found")
+	}
+	delete(r.store.users, oid)
+
+	return nil
+}
+
+// cloneUser copies the slices and pointers of user so callers never share state with the store.
+func cloneUser(user domain.User) domain.User {
+	if user.TargetRange != nil {
+		targetRange := *user.TargetRange
+		user.TargetRange = &targetRange
+	}
+	user.Devices = slices.Clone(user.Devices)
+	user.CareTeam = slices.Clone(user.CareTeam)
+	return user
+}
+
+// page applies an offset and, when positive, a limit to items.
+func page[T any](items []T, offset, limit int) []T {
+	if offset >= len(items) {
+		return items[:0]
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
@@ -0,0 +1,80 @@
+package mongodb
+
+import (
+	"context"
+	"glooko/internal/domain"
+	"glooko/internal/ports"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const AuditCollection = "audit"
+
+// AuditRepository only inserts and queries, the service's database user should be granted
+// no update or remove privileges on the collection.
+type AuditRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAuditRepository(db *MongoDB) ports.AuditRepository {
+	return &AuditRepository{
+		collection: db.Database.Collection(AuditCollection),
+	}
+}
+
+func (r *AuditRepository) Record(ctx context.Context, entry domain.AuditEntry) error {
+	_, err := r.collection.InsertOne(ctx, entry)
+	if err != nil {
+		return errors.Wrap(err, "failed to record audit entry")
+	}
+
+	return nil
+}
+
+func (r *AuditRepository) Find(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEntry, int64, error) {
+	query := bson.M{}
+	if filter.Actor != "" {
+		query["actor"] = filter.Actor
+	}
+	if filter.Subject != "" {
+		query["subject"] = filter.Subject
+	}
+	timeRange := bson.M{}
+	if !filter.From.IsZero() {
+		timeRange["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		timeRange["$lt"] = filter.To
+	}
+	if len(timeRange) > 0 {
+		query["time"] = timeRange
+	}
+
+	total, err := r.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count audit entries")
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(filter.Offset))
+	if filter.Limit > 0 {
+		findOptions.SetLimit(int64(filter.Limit))
+	}
+
+	cursor, err := r.collection.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to find audit entries")
+	}
+	defer cursor.Close(ctx)
+
+	entries := []domain.AuditEntry{}
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to decode audit entries")
+	}
+
+	return entries, total, nil
+}
@@ -0,0 +1,57 @@
+package mongodb
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"glooko/internal/ports"
+	"glooko/internal/ports/porttest"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newTestDB sets up a database of its own for a test and drops it afterwards. The tests run when
+// MONGODB_TEST_URI points to a MongoDB server.
+func newTestDB(t *testing.T) *MongoDB {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+
+	ctx := context.Background()
+	db, err := NewMongoDB(ctx, uri, "glooko_test_"+primitive.NewObjectID().Hex())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Database.Drop(context.Background())
+		db.Database.Client().Disconnect(context.Background())
+	})
+
+	require.NoError(t, SetUpCollections(ctx, db.Database))
+	return db
+}
+
+func TestUserRepositoryConformance(t *testing.T) {
+	porttest.TestUserRepository(t, func(t *testing.T) ports.UserRepository {
+		return NewUserRepository(newTestDB(t))
+	})
+}
+
+func TestDeviceRepositoryConformance(t *testing.T) {
+	porttest.TestDeviceRepository(t, func(t *testing.T) ports.DeviceRepository {
+		return NewDeviceRepository(newTestDB(t))
+	})
+}
+
+func TestReadingRepositoryConformance(t *testing.T) {
+	porttest.TestReadingRepository(t, func(t *testing.T) ports.ReadingRepository {
+		return NewReadingRepository(newTestDB(t))
+	})
+}
+
+func TestEventRepositoryConformance(t *testing.T) {
+	porttest.TestEventRepository(t, func(t *testing.T) ports.EventRepository {
+		return NewEventRepository(newTestDB(t))
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const DevicesCollection = "devices"
@@ -25,6 +26,9 @@ func NewDeviceRepository(db *MongoDB) *DeviceRepository {
 func (r *DeviceRepository) Save(ctx context.Context, device domain.Device) (domain.Device, error) {
 	result, err := r.collection.InsertOne(ctx, device)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return domain.Device{}, errors.Wrap(domain.ErrConflict, "device already exists")
+		}
 		return domain.Device{}, errors.Wrap(err, "failed to save device")
 	}
 
@@ -41,3 +45,109 @@ func (r *DeviceRepository) Save(ctx context.Context, device domain.Device) (doma
 
 	return savedDevice, nil
 }
+
+func (r *DeviceRepository) FindByID(ctx context.Context, id string) (domain.Device, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return domain.Device{}, errors.Wrap(domain.ErrInvalidID, "failed to parse deviceID")
+	}
+
+	var device domain.Device
+	err = r.collection.FindOne(ctx, bson.M{"_id": oid}).Decode(&device)
+	if err == mongo.ErrNoDocuments {
+		return domain.Device{}, errors.Wrap(domain.ErrNotFound, "device not found")
+	}
+	if err != nil {
+		return domain.Device{}, errors.Wrap(err, "failed to fetch device")
+	}
+
+	return device, nil
+}
+
+func (r *DeviceRepository) FindByUser(ctx context.Context, userID string) ([]domain.Device, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.Wrap(domain.ErrInvalidID, "failed to parse userID")
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, bson.M{"userId": userObjectID}, findOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find devices")
+	}
+	defer cursor.Close(ctx)
+
+	devices := []domain.Device{}
+	if err = cursor.All(ctx, &devices); err != nil {
+		return nil, errors.Wrap(err, "failed to decode devices")
+	}
+
+	return devices, nil
+}
+
+func (r *DeviceRepository) Update(ctx context.Context, id string, update domain.DeviceUpdate) (domain.Device, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return domain.Device{}, errors.Wrap(domain.ErrInvalidID, "failed to parse deviceID")
+	}
+
+	set := bson.M{}
+	if update.UserID != nil {
+		set["userId"] = *update.UserID
+	}
+	if update.Manufacturer != nil {
+		set["manufacturer"] = *update.Manufacturer
+	}
+	if update.Model != nil {
+		set["model"] = *update.Model
+	}
+	if update.SerialNumber != nil {
+		set["serialNumber"] = *update.SerialNumber
+	}
+	if update.Status != nil {
+		set["status"] = *update.Status
+	}
+	if update.ReplacedAt != nil {
+		set["replacedAt"] = *update.ReplacedAt
+	}
+	if update.ReplacedBy != nil {
+		set["replacedBy"] = *update.ReplacedBy
+	}
+	if update.RetiredAt != nil {
+		set["retiredAt"] = *update.RetiredAt
+	}
+
+	if len(set) == 0 {
+		return r.FindByID(ctx, id)
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updatedDevice domain.Device
+	err = r.collection.FindOneAndUpdate(ctx, bson.M{"_id": oid}, bson.M{"$set": set}, opts).Decode(&updatedDevice)
+	if err == mongo.ErrNoDocuments {
+		return domain.Device{}, errors.Wrap(domain.ErrNotFound, "device not found")
+	}
+	if err != nil {
+		return domain.Device{}, errors.Wrap(err, "failed to update device")
+	}
+
+	return updatedDevice, nil
+}
+
+func (r *DeviceRepository) Delete(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.Wrap(domain.ErrInvalidID, "failed to parse deviceID")
+	}
+
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return errors.Wrap(err, "failed to delete device")
+	}
+	if result.DeletedCount == 0 {
+		return errors.Wrap(domain.ErrNotFound, "device not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package mongodb
+
+import (
+	"context"
+	"glooko/internal/domain"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const EventsCollection = "events"
+
+type EventRepository struct {
+	collection *mongo.Collection
+}
+
+func NewEventRepository(db *MongoDB) *EventRepository {
+	return &EventRepository{
+		collection: db.Database.Collection(EventsCollection),
+	}
+}
+
+// ReplaceEvents deletes the device's events in the window and inserts events in one transaction,
+// which needs MongoDB to run as a replica set.
+func (r *EventRepository) ReplaceEvents(ctx context.Context, userID, deviceID string, startDate, endDate time.Time, events []domain.GlucoseEvent) error {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.Wrap(domain.ErrInvalidID, "failed to parse userID")
+	}
+
+	deviceObjID, err := primitive.ObjectIDFromHex(deviceID)
+	if err != nil {
+		return errors.Wrap(domain.ErrInvalidID, "failed to parse deviceID")
+	}
+
+	session, err := r.collection.Database().Client().StartSession()
+	if err != nil {
+		return errors.Wrap(err, "failed to start session")
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		filter := bson.M{
+			"userId":   userObjectID,
+			"deviceId": deviceObjID,
+			"start": bson.M{
+				"$gte": startDate,
+				"$lte": endDate,
+			},
+		}
+		if _, err := r.collection.DeleteMany(sc, filter); err != nil {
+			return nil, err
+		}
+
+		if len(events) == 0 {
+			return nil, nil
+		}
+		documents := make([]interface{}, len(events))
+		for i, event := range events {
+			event.ID = primitive.NilObjectID
+			documents[i] = event
+		}
+		_, err := r.collection.InsertMany(sc, documents)
+		return nil, err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to replace events")
+	}
+
+	return nil
+}
+
+func (r *EventRepository) FetchEvents(ctx context.Context, userID string, startDate, endDate time.Time) ([]domain.GlucoseEvent, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.Wrap(domain.ErrInvalidID, "failed to parse userID")
+	}
+
+	filter := bson.M{
+		"userId": userObjectID,
+		"start": bson.M{
+			"$gte": startDate,
+			"$lte": endDate,
+		},
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "start", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find events")
+	}
+	defer cursor.Close(ctx)
+
+	events := []domain.GlucoseEvent{}
+	if err = cursor.All(ctx, &events); err != nil {
+		return nil, errors.Wrap(err, "failed to decode events")
+	}
+
+	return events, nil
+}
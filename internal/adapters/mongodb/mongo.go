@@ -9,6 +9,17 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ReadingsBucketIndex enforces one readings document per user, device and day. Its key also
+// serves FetchReadings and FetchDevicesOverview.
+var ReadingsBucketIndex = mongo.IndexModel{
+	Keys: bson.D{
+		{Key: "userId", Value: 1},
+		{Key: "day", Value: 1},
+		{Key: "deviceId", Value: 1},
+	},
+	Options: options.Index().SetUnique(true),
+}
+
 type MongoDB struct {
 	Database *mongo.Database
 }
@@ -35,12 +46,29 @@ func SetUpCollections(ctx context.Context, db *mongo.Database) error {
 			"required": []string{"_id", "firstName", "lastName", "dateOfBirth", "phoneNumber", "email"},
 			"properties": bson.M{
 
-				"firstName":   bson.M{"bsonType": "string"},
-				"lastName":    bson.M{"bsonType": "string"},
-				"dateOfBirth": bson.M{"bsonType": "date"},
-				"phoneNumber": bson.M{"bsonType": "string"},
-				"email":       bson.M{"bsonType": "string"},
-				"devices":     bson.M{"bsonType": "array"},
+				"firstName":    bson.M{"bsonType": "string"},
+				"lastName":     bson.M{"bsonType": "string"},
+				"dateOfBirth":  bson.M{"bsonType": "date"},
+				"phoneNumber":  bson.M{"bsonType": "string"},
+				"email":        bson.M{"bsonType": "string"},
+				"timezone":     bson.M{"bsonType": "string"},
+				"unit":         bson.M{"enum": []string{"mg/dL", "mmol/L"}},
+				"devices":      bson.M{"bsonType": "array"},
+				"supportQueue": bson.M{"bsonType": "string"},
+				"careTeam": bson.M{
+					"bsonType": "array",
+					"items":    bson.M{"bsonType": "string"},
+				},
+				"targetRange": bson.M{
+					"bsonType": "object",
+					"required": []string{"veryLow", "low", "high", "veryHigh"},
+					"properties": bson.M{
+						"veryLow":  bson.M{"bsonType": "int"},
+						"low":      bson.M{"bsonType": "int"},
+						"high":     bson.M{"bsonType": "int"},
+						"veryHigh": bson.M{"bsonType": "int"},
+					},
+				},
 			},
 		},
 	}
@@ -64,6 +92,11 @@ func SetUpCollections(ctx context.Context, db *mongo.Database) error {
 				"model":        bson.M{"bsonType": "string"},
 				"serialNumber": bson.M{"bsonType": "string"},
 				"userId":       bson.M{"bsonType": "objectId"},
+				"status":       bson.M{"enum": []string{"active", "replaced", "retired"}},
+				"activatedAt":  bson.M{"bsonType": "date"},
+				"replacedAt":   bson.M{"bsonType": "date"},
+				"replacedBy":   bson.M{"bsonType": "objectId"},
+				"retiredAt":    bson.M{"bsonType": "date"},
 			},
 		},
 	}
@@ -111,6 +144,22 @@ func SetUpCollections(ctx context.Context, db *mongo.Database) error {
 		return errors.Wrap(err, "failed to create collection")
 	}
 
+	usersIndexSupportQueue := mongo.IndexModel{
+		Keys: bson.D{{Key: "supportQueue", Value: 1}},
+	}
+	_, err = db.Collection("users").Indexes().CreateOne(ctx, usersIndexSupportQueue)
+	if err != nil {
+		return errors.Wrap(err, "failed to create index for supportQueue")
+	}
+
+	devicesIndexFindByUser := mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}},
+	}
+	_, err = db.Collection("devices").Indexes().CreateOne(ctx, devicesIndexFindByUser)
+	if err != nil {
+		return errors.Wrap(err, "failed to create index for FindByUser")
+	}
+
 	readingsIndexFetchReadings := mongo.IndexModel{
 		Keys: bson.D{
 			{Key: "userId", Value: 1},
@@ -122,16 +171,96 @@ func SetUpCollections(ctx context.Context, db *mongo.Database) error {
 		return errors.Wrap(err, "failed to create index for FetchReadings")
 	}
 
-	readingsIndexFetchDevicesOverview := mongo.IndexModel{
+	_, err = db.Collection(ReadingsCollection).Indexes().CreateOne(ctx, ReadingsBucketIndex)
+	if err != nil {
+		return errors.Wrap(err, "failed to create index for reading buckets")
+	}
+
+	err = db.Collection("events").Drop(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to drop events collection")
+	}
+
+	eventsIndexUpsert := mongo.IndexModel{
 		Keys: bson.D{
 			{Key: "userId", Value: 1},
-			{Key: "day", Value: 1},
 			{Key: "deviceId", Value: 1},
+			{Key: "type", Value: 1},
+			{Key: "start", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	}
+	_, err = db.Collection("events").Indexes().CreateOne(ctx, eventsIndexUpsert)
+	if err != nil {
+		return errors.Wrap(err, "failed to create index for ReplaceEvents")
+	}
+
+	eventsIndexFetchEvents := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "userId", Value: 1},
+			{Key: "start", Value: 1},
+		},
+	}
+	_, err = db.Collection("events").Indexes().CreateOne(ctx, eventsIndexFetchEvents)
+	if err != nil {
+		return errors.Wrap(err, "failed to create index for FetchEvents")
+	}
+
+	return setUpAuditCollection(ctx, db)
+}
+
+// setUpAuditCollection creates the audit collection unless it exists, the audit trail has to
+// outlive reseeding so unlike the other collections it is never dropped.
+func setUpAuditCollection(ctx context.Context, db *mongo.Database) error {
+	names, err := db.ListCollectionNames(ctx, bson.M{"name": AuditCollection})
+	if err != nil {
+		return errors.Wrap(err, "failed to list collections")
+	}
+	if len(names) > 0 {
+		return nil
+	}
+
+	auditValidation := bson.M{
+		"$jsonSchema": bson.M{
+			"bsonType": "object",
+			"required": []string{"time", "actor", "subject", "method", "endpoint", "status", "outcome"},
+			"properties": bson.M{
+				"time":     bson.M{"bsonType": "date"},
+				"actor":    bson.M{"bsonType": "string"},
+				"subject":  bson.M{"bsonType": "string"},
+				"method":   bson.M{"bsonType": "string"},
+				"endpoint": bson.M{"bsonType": "string"},
+				"status":   bson.M{"bsonType": "int"},
+				"outcome":  bson.M{"enum": []string{"success", "denied", "failure"}},
+			},
+		},
+	}
+
+	opt := options.CreateCollection().SetValidator(auditValidation)
+	if err := db.CreateCollection(ctx, AuditCollection, opt); err != nil {
+		return errors.Wrap(err, "failed to create collection")
+	}
+
+	auditIndexFindByActor := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "actor", Value: 1},
+			{Key: "time", Value: -1},
+		},
+	}
+	_, err = db.Collection(AuditCollection).Indexes().CreateOne(ctx, auditIndexFindByActor)
+	if err != nil {
+		return errors.Wrap(err, "failed to create index for audit actor")
+	}
+
+	auditIndexFindBySubject := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "subject", Value: 1},
+			{Key: "time", Value: -1},
 		},
 	}
-	_, err = db.Collection("readings").Indexes().CreateOne(ctx, readingsIndexFetchDevicesOverview)
+	_, err = db.Collection(AuditCollection).Indexes().CreateOne(ctx, auditIndexFindBySubject)
 	if err != nil {
-		return errors.Wrap(err, "failed to create index for FetchDevicesOverview")
+		return errors.Wrap(err, "failed to create index for audit subject")
 	}
 
 	return nil
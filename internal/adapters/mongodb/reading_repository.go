@@ -3,6 +3,7 @@ package mongodb
 import (
 	"context"
 	"glooko/internal/domain"
+	"maps"
 	"time"
 
 	"github.com/pkg/errors"
@@ -12,60 +13,254 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const ReadingsCollection = "readings"
+
 type ReadingRepository struct {
 	collection *mongo.Collection
 }
 
 func NewReadingRepository(db *MongoDB) *ReadingRepository {
 	return &ReadingRepository{
-		collection: db.Database.Collection("readings"),
+		collection: db.Database.Collection(ReadingsCollection),
 	}
 }
 
+// AddReadingAndUpdateStats appends the reading to its daily bucket and recomputes the bucket's
+// statistics in a single pipeline update, so concurrent writers never leave avgValue out of step
+// with sumValues and countReadings. A reading the bucket already holds for the same time leaves
+// it unchanged.
 func (r *ReadingRepository) AddReadingAndUpdateStats(ctx context.Context, deviceID, userID string, value int, timestamp time.Time) error {
 	userObjectID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return errors.Wrap(err, "failed to parse userID")
+		return errors.Wrap(domain.ErrInvalidID, "failed to parse userID")
 	}
 
 	deviceObjID, err := primitive.ObjectIDFromHex(deviceID)
 	if err != nil {
-		return errors.Wrap(err, "failed to parse deviceID")
+		return errors.Wrap(domain.ErrInvalidID, "failed to parse deviceID")
+	}
+
+	day := domain.DayOf(timestamp)
+
+	filter := bucketFilter(userObjectID, deviceObjID, day)
+	update := statsPipeline(userObjectID, deviceObjID, day, bson.A{bson.M{"time": timestamp, "value": value}})
+
+	_, err = r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent upsert created the bucket first, the retry appends to it
+		_, err = r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to add reading")
+	}
+
+	return nil
+}
+
+// readingsBucket collects the readings of a batch falling into one daily bucket.
+type readingsBucket struct {
+	deviceID primitive.ObjectID
+	day      time.Time
+	readings bson.A
+	indexes  []int // Positions of the bucket's readings in the batch
+}
+
+// bucketKey identifies the daily bucket of a device within a batch.
+func bucketKey(deviceID primitive.ObjectID, day time.Time) string {
+	return deviceID.Hex() + day.Format(time.DateOnly)
+}
+
+// AddReadingsAndUpdateStats groups the readings by device and day and sends one statsPipeline
+// update per bucket in a single unordered bulk write, so a failing bucket doesn't hold up the
+// others, its readings all fail with it. The times the buckets hold are read first to report
+// readings already stored, or repeated within the batch, as duplicates. A reading another writer
+// stores in between is skipped by the update all the same, but reported as stored.
+func (r *ReadingRepository) AddReadingsAndUpdateStats(ctx context.Context, userID string, readings []domain.DeviceReading) ([]error, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.Wrap(domain.ErrInvalidID, "failed to parse userID")
+	}
+
+	results := make([]error, len(readings))
+	buckets := []*readingsBucket{}
+	bucketIndex := map[string]*readingsBucket{}
+	for i, reading := range readings {
+		deviceObjID, err := primitive.ObjectIDFromHex(reading.DeviceID)
+		if err != nil {
+			results[i] = errors.Wrap(domain.ErrInvalidID, "failed to parse deviceID")
+			continue
+		}
+
+		day := domain.DayOf(reading.Time)
+		key := bucketKey(deviceObjID, day)
+		bucket, ok := bucketIndex[key]
+		if !ok {
+			bucket = &readingsBucket{deviceID: deviceObjID, day: day}
+			bucketIndex[key] = bucket
+			buckets = append(buckets, bucket)
+		}
+		bucket.indexes = append(bucket.indexes, i)
+	}
+
+	stored, err := r.storedTimes(ctx, userObjectID, buckets)
+	if err != nil {
+		return nil, err
+	}
+
+	var writes []*readingsBucket
+	for _, bucket := range buckets {
+		// Unix milliseconds, the precision readings are stored with
+		times := stored[bucketKey(bucket.deviceID, bucket.day)]
+		if times == nil {
+			times = map[int64]bool{}
+		}
+		for _, i := range bucket.indexes {
+			reading := readings[i]
+			if times[reading.Time.UnixMilli()] {
+				results[i] = errors.Wrap(domain.ErrDuplicate, "reading already stored")
+				continue
+			}
+			times[reading.Time.UnixMilli()] = true
+			bucket.readings = append(bucket.readings, bson.M{"time": reading.Time, "value": reading.Value})
+		}
+		if len(bucket.readings) > 0 {
+			writes = append(writes, bucket)
+		}
+	}
+
+	failed, err := r.writeBuckets(ctx, userObjectID, writes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Concurrent upserts created these buckets first, the retry appends to them
+	var retries []*readingsBucket
+	for bucket, writeErr := range failed {
+		if mongo.IsDuplicateKeyError(writeErr) {
+			retries = append(retries, bucket)
+			delete(failed, bucket)
+		}
+	}
+	retryFailed, err := r.writeBuckets(ctx, userObjectID, retries)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(failed, retryFailed)
+
+	for bucket, writeErr := range failed {
+		for _, index := range bucket.indexes {
+			results[index] = errors.Wrap(writeErr, "failed to add reading")
+		}
+	}
+
+	return results, nil
+}
+
+// storedTimes returns the times, in Unix milliseconds, of the readings the buckets already hold,
+// keyed by bucketKey.
+func (r *ReadingRepository) storedTimes(ctx context.Context, userID primitive.ObjectID, buckets []*readingsBucket) (map[string]map[int64]bool, error) {
+	stored := map[string]map[int64]bool{}
+	if len(buckets) == 0 {
+		return stored, nil
 	}
 
-	day := timestamp.Truncate(24 * time.Hour)
+	keys := make(bson.A, len(buckets))
+	for i, bucket := range buckets {
+		keys[i] = bson.M{"deviceId": bucket.deviceID, "day": bucket.day}
+	}
+	filter := bson.M{"userId": userID, "$or": keys}
+	findOptions := options.Find().SetProjection(bson.M{"deviceId": 1, "day": 1, "readings.time": 1})
 
-	filter := bson.M{"deviceId": deviceID, "day": day}
-	update := bson.D{
-		{Key: "$push", Value: bson.M{"readings": bson.M{"time": timestamp, "value": value}}},
-		{Key: "$min", Value: bson.M{"minValue": value}},
-		{Key: "$max", Value: bson.M{"maxValue": value}},
-		{Key: "$inc", Value: bson.M{"sumValues": value, "countReadings": 1}},
-		{Key: "$setOnInsert", Value: bson.M{"userId": userObjectID, "day": day, "deviceId": deviceObjID}},
+	cursor, err := r.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find readings")
 	}
+	defer cursor.Close(ctx)
 
-	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(true)
-	var updatedReading domain.Reading
+	for cursor.Next(ctx) {
+		var reading domain.Reading
+		if err := cursor.Decode(&reading); err != nil {
+			return nil, errors.Wrap(err, "failed to decode reading")
+		}
+		times := map[int64]bool{}
+		for _, entry := range reading.Readings {
+			times[entry.Time.UnixMilli()] = true
+		}
+		stored[bucketKey(reading.DeviceID, reading.Day)] = times
+	}
 
-	// Add new reading and update min/max
-	err = r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updatedReading)
-	if err != nil && err != mongo.ErrNoDocuments {
-		return err
+	return stored, errors.Wrap(cursor.Err(), "failed to iterate readings")
+}
+
+// writeBuckets sends the statsPipeline updates of buckets in an unordered bulk write and returns
+// the errors of the buckets that failed. The error is set when the write failed as a whole.
+func (r *ReadingRepository) writeBuckets(ctx context.Context, userID primitive.ObjectID, buckets []*readingsBucket) (map[*readingsBucket]error, error) {
+	failed := map[*readingsBucket]error{}
+	if len(buckets) == 0 {
+		return failed, nil
 	}
 
-	if updatedReading.CountReadings > 0 {
-		newAvg := float64(updatedReading.SumValues) / float64(updatedReading.CountReadings)
-		statsUpdate := bson.M{"$set": bson.M{"avgValue": newAvg}}
-		_, err = r.collection.UpdateOne(ctx, filter, statsUpdate)
+	models := make([]mongo.WriteModel, len(buckets))
+	for i, bucket := range buckets {
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(bucketFilter(userID, bucket.deviceID, bucket.day)).
+			SetUpdate(statsPipeline(userID, bucket.deviceID, bucket.day, bucket.readings)).
+			SetUpsert(true)
 	}
 
-	return err
+	_, err := r.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			failed[buckets[writeErr.Index]] = writeErr
+		}
+		return failed, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to add readings")
+	}
+
+	return failed, nil
+}
+
+// bucketFilter matches the daily bucket of a device, the key of the unique readings index.
+func bucketFilter(userID, deviceID primitive.ObjectID, day time.Time) bson.M {
+	return bson.M{"userId": userID, "deviceId": deviceID, "day": day}
+}
+
+// statsPipeline returns the update appending readings, time and value documents with distinct
+// times, to a daily bucket and deriving the bucket's statistics from its fields after the append.
+// Readings at a time the bucket already holds are left out, so uploading them again is a no-op.
+// Fields missing on a bucket created by the upsert count as empty.
+func statsPipeline(userID, deviceID primitive.ObjectID, day time.Time, readings bson.A) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"newReadings": bson.M{"$filter": bson.M{
+				"input": readings,
+				"cond":  bson.M{"$not": bson.A{bson.M{"$in": bson.A{"$$this.time", bson.M{"$ifNull": bson.A{"$readings.time", bson.A{}}}}}}},
+			}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"userId":        userID,
+			"deviceId":      deviceID,
+			"day":           day,
+			"readings":      bson.M{"$concatArrays": bson.A{bson.M{"$ifNull": bson.A{"$readings", bson.A{}}}, "$newReadings"}},
+			"minValue":      bson.M{"$min": bson.A{"$minValue", bson.M{"$min": "$newReadings.value"}}},
+			"maxValue":      bson.M{"$max": bson.A{"$maxValue", bson.M{"$max": "$newReadings.value"}}},
+			"sumValues":     bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$sumValues", 0}}, bson.M{"$sum": "$newReadings.value"}}},
+			"countReadings": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$countReadings", 0}}, bson.M{"$size": "$newReadings"}}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"avgValue": bson.M{"$divide": bson.A{"$sumValues", "$countReadings"}},
+		}}},
+		{{Key: "$unset", Value: "newReadings"}},
+	}
 }
 
 func (r *ReadingRepository) FetchReadings(ctx context.Context, userID string, startDate, endDate time.Time) ([]domain.Reading, error) {
 	userObjectID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to parse userID")
+		return nil, errors.Wrap(domain.ErrInvalidID, "failed to parse userID")
 	}
 
 	filter := bson.M{
@@ -92,10 +287,45 @@ func (r *ReadingRepository) FetchReadings(ctx context.Context, userID string, st
 	return readings, nil
 }
 
+func (r *ReadingRepository) StreamReadings(ctx context.Context, userID string, startDate, endDate time.Time, fn func(domain.Reading) error) error {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return errors.Wrap(domain.ErrInvalidID, "failed to parse userID")
+	}
+
+	filter := bson.M{
+		"userId": userObjectID,
+		"day": bson.M{
+			"$gte": startDate,
+			"$lte": endDate,
+		},
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "day", Value: 1}, {Key: "deviceId", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return errors.Wrap(err, "failed to find readings")
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var reading domain.Reading
+		if err := cursor.Decode(&reading); err != nil {
+			return errors.Wrap(err, "failed to decode reading")
+		}
+		if err := fn(reading); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrap(cursor.Err(), "failed to iterate readings")
+}
+
 func (r *ReadingRepository) FetchDevicesOverview(ctx context.Context, userID string, days int) ([]domain.DayDeviceCounts, error) {
 	userObjectID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to parse userID")
+		return nil, errors.Wrap(domain.ErrInvalidID, "failed to parse userID")
 	}
 
 	startDate := time.Now().AddDate(0, 0, -days)
@@ -104,7 +334,7 @@ func (r *ReadingRepository) FetchDevicesOverview(ctx context.Context, userID str
 		{{Key: "$match", Value: bson.M{"userId": userObjectID, "day": bson.M{"$gte": startDate}}}},
 		{{Key: "$group", Value: bson.M{
 			"_id":   bson.M{"day": "$day", "deviceId": "$deviceId"},
-			"count": bson.M{"$sum": 1},
+			"count": bson.M{"$sum": "$countReadings"},
 		}}},
 		{{Key: "$group", Value: bson.M{
 			"_id":     "$_id.day",
@@ -0,0 +1,228 @@
+package mongodb
+
+import (
+	"context"
+	"glooko/internal/domain"
+	"sort"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReadingsRepair summarizes a run of RepairReadingBuckets.
+type ReadingsRepair struct {
+	DuplicateBuckets int  `json:"duplicateBuckets"` // Device days stored in more than one document
+	RemovedDocuments int  `json:"removedDocuments"` // Documents merged into another and deleted
+	IndexCreated     bool `json:"indexCreated"`     // Whether ReadingsBucketIndex is in place
+}
+
+// RepairReadingBuckets merges readings documents of the same user, device and day into the oldest
+// of them, recomputing its statistics, and then replaces the non-unique bucket index with
+// ReadingsBucketIndex. Such duplicates were left by upserts whose filter never matched the stored
+// bucket. With dryRun set duplicates are only counted.
+//
+// Each device day is merged in a transaction, so the repair can run while readings are uploaded,
+// which needs MongoDB to run as a replica set.
+func RepairReadingBuckets(ctx context.Context, db *mongo.Database, dryRun bool) (ReadingsRepair, error) {
+	collection := db.Collection(ReadingsCollection)
+	repair := ReadingsRepair{}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"userId": "$userId", "deviceId": "$deviceId", "day": "$day"},
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return repair, errors.Wrap(err, "failed to find duplicate buckets")
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var group struct {
+			IDs []primitive.ObjectID `bson:"ids"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return repair, errors.Wrap(err, "failed to decode duplicate buckets")
+		}
+
+		repair.DuplicateBuckets++
+		repair.RemovedDocuments += len(group.IDs) - 1
+		if dryRun {
+			continue
+		}
+
+		err := mergeBucket(ctx, collection, group.IDs)
+		if err != nil {
+			return repair, err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return repair, errors.Wrap(err, "failed to iterate duplicate buckets")
+	}
+
+	if dryRun {
+		return repair, nil
+	}
+
+	err = replaceBucketIndex(ctx, collection)
+	if err != nil {
+		return repair, err
+	}
+	repair.IndexCreated = true
+
+	return repair, nil
+}
+
+// mergeBucket merges the documents with ids into the oldest of them and deletes the others. The
+// merge runs in a transaction, a reading upserted into one of the documents meanwhile makes it
+// conflict and start over with the document read again, so the reading is merged too.
+func mergeBucket(ctx context.Context, collection *mongo.Collection, ids []primitive.ObjectID) error {
+	session, err := collection.Database().Client().StartSession()
+	if err != nil {
+		return errors.Wrap(err, "failed to start session")
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+		cursor, err := collection.Find(sc, bson.M{"_id": bson.M{"$in": ids}}, findOptions)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find duplicate bucket")
+		}
+
+		var buckets []domain.Reading
+		if err = cursor.All(sc, &buckets); err != nil {
+			return nil, errors.Wrap(err, "failed to decode duplicate bucket")
+		}
+		if len(buckets) < 2 {
+			return nil, nil
+		}
+
+		merged := mergeReadings(buckets)
+		_, err = collection.UpdateByID(sc, merged.ID, bson.M{"$set": bson.M{
+			"readings":      merged.Readings,
+			"minValue":      merged.MinValue,
+			"maxValue":      merged.MaxValue,
+			"sumValues":     merged.SumValues,
+			"countReadings": merged.CountReadings,
+			"avgValue":      merged.AvgValue,
+		}})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to update merged bucket")
+		}
+
+		duplicates := make([]primitive.ObjectID, 0, len(buckets)-1)
+		for _, bucket := range buckets[1:] {
+			duplicates = append(duplicates, bucket.ID)
+		}
+		_, err = collection.DeleteMany(sc, bson.M{"_id": bson.M{"$in": duplicates}})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to delete duplicate buckets")
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to merge duplicate buckets")
+	}
+
+	return nil
+}
+
+// mergeReadings merges buckets of one device day into the first, with the readings of all
+// buckets in time order and their statistics. Readings are identified by their time to the
+// millisecond, as on ingestion, and of readings at the same time the one of the oldest bucket is
+// kept.
+func mergeReadings(buckets []domain.Reading) domain.Reading {
+	merged := buckets[0]
+	merged.Readings = nil
+	seen := map[int64]bool{}
+	for _, bucket := range buckets {
+		for _, entry := range bucket.Readings {
+			millis := entry.Time.UnixMilli()
+			if seen[millis] {
+				continue
+			}
+			seen[millis] = true
+			merged.Readings = append(merged.Readings, entry)
+		}
+	}
+
+	sort.SliceStable(merged.Readings, func(i, j int) bool {
+		return merged.Readings[i].Time.Before(merged.Readings[j].Time)
+	})
+
+	merged.MinValue, merged.MaxValue, merged.SumValues, merged.CountReadings, merged.AvgValue = 0, 0, 0, 0, 0
+	for i, entry := range merged.Readings {
+		if i == 0 || entry.Value < merged.MinValue {
+			merged.MinValue = entry.Value
+		}
+		if i == 0 || entry.Value > merged.MaxValue {
+			merged.MaxValue = entry.Value
+		}
+		merged.SumValues += entry.Value
+		merged.CountReadings++
+	}
+	if merged.CountReadings > 0 {
+		merged.AvgValue = float64(merged.SumValues) / float64(merged.CountReadings)
+	}
+
+	return merged
+}
+
+// replaceBucketIndex drops a non-unique index on the bucket key, which keeps the unique one from
+// being created under the same name, and creates ReadingsBucketIndex.
+func replaceBucketIndex(ctx context.Context, collection *mongo.Collection) error {
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list indexes")
+	}
+
+	var indexes []struct {
+		Name   string `bson:"name"`
+		Key    bson.D `bson:"key"`
+		Unique bool   `bson:"unique"`
+	}
+	if err = cursor.All(ctx, &indexes); err != nil {
+		return errors.Wrap(err, "failed to decode indexes")
+	}
+
+	bucketKey, _ := ReadingsBucketIndex.Keys.(bson.D)
+	for _, index := range indexes {
+		if index.Unique || !sameKey(index.Key, bucketKey) {
+			continue
+		}
+		_, err = collection.Indexes().DropOne(ctx, index.Name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to drop index %s", index.Name)
+		}
+	}
+
+	_, err = collection.Indexes().CreateOne(ctx, ReadingsBucketIndex)
+	if err != nil {
+		return errors.Wrap(err, "failed to create index for reading buckets")
+	}
+
+	return nil
+}
+
+// sameKey reports whether the index keys name the same fields in the same order.
+func sameKey(a, b bson.D) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Key != b[i].Key {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMergeReadings(t *testing.T) {
+	day := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	keeper := primitive.NewObjectID()
+	entry := func(minute, value int) domain.ReadingEntry {
+		return domain.ReadingEntry{Time: day.Add(time.Duration(minute) * time.Minute), Value: value}
+	}
+	bucket := func(id primitive.ObjectID, entries ...domain.ReadingEntry) domain.Reading {
+		return domain.Reading{ID: id, Day: day, Readings: entries, CountReadings: len(entries)}
+	}
+
+	tests := []struct {
+		name     string
+		buckets  []domain.Reading
+		expected domain.Reading
+	}{
+		{
+			name: "One Reading Per Document",
+			buckets: []domain.Reading{
+				bucket(keeper, entry(10, 120)),
+				bucket(primitive.NewObjectID(), entry(5, 80)),
+				bucket(primitive.NewObjectID(), entry(15, 190)),
+			},
+			expected: domain.Reading{
+				ID:            keeper,
+				Day:           day,
+				Readings:      []domain.ReadingEntry{entry(5, 80), entry(10, 120), entry(15, 190)},
+				MinValue:      80,
+				MaxValue:      190,
+				SumValues:     390,
+				CountReadings: 3,
+				AvgValue:      130,
+			},
+		},
+		{
+			name: "Interrupted Repair",
+			buckets: []domain.Reading{
+				bucket(keeper, entry(5, 80), entry(10, 120)),
+				bucket(primitive.NewObjectID(), entry(10, 120)),
+			},
+			expected: domain.Reading{
+				ID:            keeper,
+				Day:           day,
+				Readings:      []domain.ReadingEntry{entry(5, 80), entry(10, 120)},
+				MinValue:      80,
+				MaxValue:      120,
+				SumValues:     200,
+				CountReadings: 2,
+				AvgValue:      100,
+			},
+		},
+		{
+			name: "Same Time Different Values",
+			buckets: []domain.Reading{
+				bucket(keeper, entry(5, 80)),
+				bucket(primitive.NewObjectID(), entry(5, 82)),
+			},
+			expected: domain.Reading{
+				ID:            keeper,
+				Day:           day,
+				Readings:      []domain.ReadingEntry{entry(5, 80)},
+				MinValue:      80,
+				MaxValue:      80,
+				SumValues:     80,
+				CountReadings: 1,
+				AvgValue:      80,
+			},
+		},
+		{
+			name: "Same Millisecond",
+			buckets: []domain.Reading{
+				bucket(keeper, entry(10, 120)),
+				bucket(primitive.NewObjectID(), entry(5, 82), domain.ReadingEntry{Time: day.Add(10*time.Minute + 500*time.Microsecond), Value: 125}),
+			},
+			expected: domain.Reading{
+				ID:            keeper,
+				Day:           day,
+				Readings:      []domain.ReadingEntry{entry(5, 82), entry(10, 120)},
+				MinValue:      82,
+				MaxValue:      120,
+				SumValues:     202,
+				CountReadings: 2,
+				AvgValue:      101,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, mergeReadings(tt.buckets))
+		})
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"glooko/internal/domain"
 	"glooko/internal/ports"
+	"regexp"
 
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const UsersCollection = "users"
@@ -26,6 +28,9 @@ func NewUserRepository(db *MongoDB) ports.UserRepository {
 func (r *UserRepository) Save(ctx context.Context, user domain.User) (domain.User, error) {
 	result, err := r.db.InsertOne(ctx, user)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return domain.User{}, errors.Wrap(domain.ErrConflict, "user already exists")
+		}
 		return domain.User{}, errors.Wrap(err, "failed to save user")
 	}
 
@@ -42,3 +47,134 @@ func (r *UserRepository) Save(ctx context.Context, user domain.User) (domain.Use
 
 	return savedUser, nil
 }
+
+func (r *UserRepository) FindByID(ctx context.Context, id string) (domain.User, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return domain.User{}, errors.Wrap(domain.ErrInvalidID, "failed to parse userID")
+	}
+
+	var user domain.User
+	err = r.db.FindOne(ctx, bson.M{"_id": oid}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return domain.User{}, errors.Wrap(domain.ErrNotFound, "user not found")
+	}
+	if err != nil {
+		return domain.User{}, errors.Wrap(err, "failed to fetch user")
+	}
+
+	return user, nil
+}
+
+func (r *UserRepository) Find(ctx context.Context, filter domain.UserFilter) ([]domain.User, int64, error) {
+	query := bson.M{}
+	if filter.Email != "" {
+		query["email"] = filter.Email
+	}
+	if filter.LastName != "" {
+		query["lastName"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(filter.LastName), Options: "i"}
+	}
+	if filter.SupportQueues != nil {
+		query["supportQueue"] = bson.M{"$in": filter.SupportQueues}
+	}
+
+	total, err := r.db.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count users")
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "lastName", Value: 1}, {Key: "firstName", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(filter.Offset))
+	if filter.Limit > 0 {
+		findOptions.SetLimit(int64(filter.Limit))
+	}
+
+	cursor, err := r.db.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to find users")
+	}
+	defer cursor.Close(ctx)
+
+	users := []domain.User{}
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to decode users")
+	}
+
+	return users, total, nil
+}
+
+func (r *UserRepository) Update(ctx context.Context, id string, update domain.UserUpdate) (domain.User, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return domain.User{}, errors.Wrap(domain.ErrInvalidID, "failed to parse userID")
+	}
+
+	set := bson.M{}
+	if update.FirstName != nil {
+		set["firstName"] = *update.FirstName
+	}
+	if update.LastName != nil {
+		set["lastName"] = *update.LastName
+	}
+	if update.DateOfBirth != nil {
+		set["dateOfBirth"] = *update.DateOfBirth
+	}
+	if update.Email != nil {
+		set["email"] = *update.Email
+	}
+	if update.PhoneNumber != nil {
+		set["phoneNumber"] = *update.PhoneNumber
+	}
+	if update.Timezone != nil {
+		set["timezone"] = *update.Timezone
+	}
+	if update.TargetRange != nil {
+		set["targetRange"] = *update.TargetRange
+	}
+	if update.Unit != nil {
+		set["unit"] = *update.Unit
+	}
+	if update.SupportQueue != nil {
+		set["supportQueue"] = *update.SupportQueue
+	}
+	if update.CareTeam != nil {
+		set["careTeam"] = *update.CareTeam
+	}
+	if update.NightscoutSecretHash != nil {
+		set["nightscoutSecretHash"] = *update.NightscoutSecretHash
+	}
+
+	if len(set) == 0 {
+		return r.FindByID(ctx, id)
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updatedUser domain.User
+	err = r.db.FindOneAndUpdate(ctx, bson.M{"_id": oid}, bson.M{"$set": set}, opts).Decode(&updatedUser)
+	if err == mongo.ErrNoDocuments {
+		return domain.User{}, errors.Wrap(domain.ErrNotFound, "user not found")
+	}
+	if err != nil {
+		return domain.User{}, errors.Wrap(err, "failed to update user")
+	}
+
+	return updatedUser, nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.Wrap(domain.ErrInvalidID, "failed to parse userID")
+	}
+
+	result, err := r.db.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return errors.Wrap(err, "failed to delete user")
+	}
+	if result.DeletedCount == 0 {
+		return errors.Wrap(domain.ErrNotFound, "user not found")
+	}
+
+	return nil
+}
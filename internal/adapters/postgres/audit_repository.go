@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"glooko/internal/domain"
+	"glooko/internal/ports"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditRepository only inserts and queries, the service's database role should be granted no
+// UPDATE or DELETE privileges on the table.
+type AuditRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewAuditRepository(db *Postgres) ports.AuditRepository {
+	return &AuditRepository{pool: db.Pool}
+}
+
+func (r *AuditRepository) Record(ctx context.Context, entry domain.AuditEntry) error {
+	_, err := r.pool.Exec(ctx, `INSERT INTO audit (id, time, actor, actor_role, subject, method, endpoint, parameters, status, outcome)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		primitive.NewObjectID().Hex(), entry.Time, entry.Actor, entry.ActorRole, entry.Subject, entry.Method,
+		entry.Endpoint, entry.Parameters, entry.Status, string(entry.Outcome))
+	if err != nil {
+		return errors.Wrap(err, "failed to record audit entry")
+	}
+
+	return nil
+}
+
+func (r *AuditRepository) Find(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEntry, int64, error) {
+	var conditions []string
+	var args []any
+	if filter.Actor != "" {
+		args = append(args, filter.Actor)
+		conditions = append(conditions, fmt.Sprintf("actor = $%d", len(args)))
+	}
+	if filter.Subject != "" {
+		args = append(args, filter.Subject)
+		conditions = append(conditions, fmt.Sprintf("subject = $%d", len(args)))
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		conditions = append(conditions, fmt.Sprintf("time >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		conditions = append(conditions, fmt.Sprintf("time < $%d", len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int64
+	err := r.pool.QueryRow(ctx, `SELECT count(*) FROM audit`+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count audit entries")
+	}
+
+	query := `SELECT id, time, actor, actor_role, subject, method, endpoint, parameters, status, outcome
+		FROM audit` + where + ` ORDER BY time DESC, id DESC`
+	query += fmt.Sprintf(" OFFSET %d", filter.Offset)
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to find audit entries")
+	}
+	defer rows.Close()
+
+	entries := []domain.AuditEntry{}
+	for rows.Next() {
+		var entry domain.AuditEntry
+		var id, outcome string
+		err := rows.Scan(&id, &entry.Time, &entry.Actor, &entry.ActorRole, &entry.Subject, &entry.Method,
+			&entry.Endpoint, &entry.Parameters, &entry.Status, &outcome)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to decode audit entries")
+		}
+		if entry.ID, err = scanID(id); err != nil {
+			return nil, 0, err
+		}
+		entry.Time = entry.Time.UTC()
+		entry.Outcome = domain.AuditOutcome(outcome)
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to find audit entries")
+	}
+
+	return entries, total, nil
+}
@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"glooko/internal/ports"
+	"glooko/internal/ports/porttest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDB connects to the database at POSTGRES_TEST_URL, tests using it are skipped when unset.
+// The conformance tests create their data under fresh IDs, so the database may be shared.
+func newTestDB(t *testing.T) *Postgres {
+	url := os.Getenv("POSTGRES_TEST_URL")
+	if url == "" {
+		t.Skip("POSTGRES_TEST_URL not set")
+	}
+
+	db, err := NewPostgres(context.Background(), url)
+	require.NoError(t, err)
+	t.Cleanup(db.Pool.Close)
+
+	return db
+}
+
+func TestUserRepositoryConformance(t *testing.T) {
+	porttest.TestUserRepository(t, func(t *testing.T) ports.UserRepository {
+		return NewUserRepository(newTestDB(t))
+	})
+}
+
+func TestDeviceRepositoryConformance(t *testing.T) {
+	porttest.TestDeviceRepository(t, func(t *testing.T) ports.DeviceRepository {
+		return NewDeviceRepository(newTestDB(t))
+	})
+}
+
+func TestReadingRepositoryConformance(t *testing.T) {
+	porttest.TestReadingRepository(t, func(t *testing.T) ports.ReadingRepository {
+		return NewReadingRepository(newTestDB(t))
+	})
+}
+
+func TestEventRepositoryConformance(t *testing.T) {
+	porttest.TestEventRepository(t, func(t *testing.T) ports.EventRepository {
+		return NewEventRepository(newTestDB(t))
+	})
+}
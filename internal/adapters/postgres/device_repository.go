@@ -0,0 +1,196 @@
+package postgres
+
+import (
+	"context"
+	"glooko/internal/domain"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const deviceColumns = `id, user_id, manufacturer, model, serial_number, status, activated_at,
+	replaced_at, replaced_by, retired_at`
+
+type DeviceRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewDeviceRepository(db *Postgres) *DeviceRepository {
+	return &DeviceRepository{pool: db.Pool}
+}
+
+func (r *DeviceRepository) Save(ctx context.Context, device domain.Device) (domain.Device, error) {
+	if device.ID.IsZero() {
+		device.ID = primitive.NewObjectID()
+	}
+
+	var activatedAt *time.Time
+	if !device.ActivatedAt.IsZero() {
+		activatedAt = &device.ActivatedAt
+	}
+
+	row := r.pool.QueryRow(ctx, `INSERT INTO devices (`+deviceColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING `+deviceColumns,
+		device.ID.Hex(), device.UserID.Hex(), device.Manufacturer, device.Model, device.SerialNumber,
+		string(device.Status), activatedAt, device.ReplacedAt, nullableID(device.ReplacedBy), device.RetiredAt)
+
+	savedDevice, err := scanDevice(row)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return domain.Device{}, errors.Wrap(domain.ErrConflict, "device already exists")
+		}
+		return domain.Device{}, errors.Wrap(err, "failed to save device")
+	}
+
+	return savedDevice, nil
+}
+
+func (r *DeviceRepository) FindByID(ctx context.Context, id string) (domain.Device, error) {
+	oid, err := parseID(id, "deviceID")
+	if err != nil {
+		return domain.Device{}, err
+	}
+
+	row := r.pool.QueryRow(ctx, `SELECT `+deviceColumns+` FROM devices WHERE id = $1`, oid.Hex())
+	device, err := scanDevice(row)
+	if err == pgx.ErrNoRows {
+		return domain.Device{}, errors.Wrap(domain.ErrNotFound, "device not found")
+	}
+	if err != nil {
+		return domain.Device{}, errors.Wrap(err, "failed to fetch device")
+	}
+
+	return device, nil
+}
+
+func (r *DeviceRepository) FindByUser(ctx context.Context, userID string) ([]domain.Device, error) {
+	userObjectID, err := parseID(userID, "userID")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.pool.Query(ctx, `SELECT `+deviceColumns+` FROM devices WHERE user_id = $1 ORDER BY id`, userObjectID.Hex())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find devices")
+	}
+	defer rows.Close()
+
+	devices := []domain.Device{}
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode devices")
+		}
+		devices = append(devices, device)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to find devices")
+	}
+
+	return devices, nil
+}
+
+func (r *DeviceRepository) Update(ctx context.Context, id string, update domain.DeviceUpdate) (domain.Device, error) {
+	oid, err := parseID(id, "deviceID")
+	if err != nil {
+		return domain.Device{}, err
+	}
+
+	set := setClause{}
+	if update.UserID != nil {
+		set.add("user_id", update.UserID.Hex())
+	}
+	if update.Manufacturer != nil {
+		set.add("manufacturer", *update.Manufacturer)
+	}
+	if update.Model != nil {
+		set.add("model", *update.Model)
+	}
+	if update.SerialNumber != nil {
+		set.add("serial_number", *update.SerialNumber)
+	}
+	if update.Status != nil {
+		set.add("status", string(*update.Status))
+	}
+	if update.ReplacedAt != nil {
+		set.add("replaced_at", *update.ReplacedAt)
+	}
+	if update.ReplacedBy != nil {
+		set.add("replaced_by", update.ReplacedBy.Hex())
+	}
+	if update.RetiredAt != nil {
+		set.add("retired_at", *update.RetiredAt)
+	}
+
+	if len(set.columns) == 0 {
+		return r.FindByID(ctx, id)
+	}
+
+	query, args := set.update("devices", oid.Hex())
+	row := r.pool.QueryRow(ctx, query+` RETURNING `+deviceColumns, args...)
+	updatedDevice, err := scanDevice(row)
+	if err == pgx.ErrNoRows {
+		return domain.Device{}, errors.Wrap(domain.ErrNotFound, "device not found")
+	}
+	if err != nil {
+		return domain.Device{}, errors.Wrap(err, "failed to update device")
+	}
+
+	return updatedDevice, nil
+}
+
+func (r *DeviceRepository) Delete(ctx context.Context, id string) error {
+	oid, err := parseID(id, "deviceID")
+	if err != nil {
+		return err
+	}
+
+	result, err := r.pool.Exec(ctx, `DELETE FROM devices WHERE id = $1`, oid.Hex())
+	if err != nil {
+		return errors.Wrap(err, "failed to delete device")
+	}
+	if result.RowsAffected() == 0 {
+		return errors.Wrap(domain.ErrNotFound, "device not found")
+	}
+
+	return nil
+}
+
+func scanDevice(row pgx.Row) (domain.Device, error) {
+	var device domain.Device
+	var id, userID, status string
+	var activatedAt *time.Time
+	var replacedBy *string
+	err := row.Scan(&id, &userID, &device.Manufacturer, &device.Model, &device.SerialNumber, &status,
+		&activatedAt, &device.ReplacedAt, &replacedBy, &device.RetiredAt)
+	if err != nil {
+		return domain.Device{}, err
+	}
+
+	if device.ID, err = scanID(id); err != nil {
+		return domain.Device{}, err
+	}
+	if device.UserID, err = scanID(userID); err != nil {
+		return domain.Device{}, err
+	}
+	if replacedBy != nil {
+		oid, err := scanID(*replacedBy)
+		if err != nil {
+			return domain.Device{}, err
+		}
+		device.ReplacedBy = &oid
+	}
+
+	device.Status = domain.DeviceStatus(status)
+	if activatedAt != nil {
+		device.ActivatedAt = activatedAt.UTC()
+	}
+	device.ReplacedAt = utc(device.ReplacedAt)
+	device.RetiredAt = utc(device.RetiredAt)
+
+	return device, nil
+}
@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"glooko/internal/domain"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type EventRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewEventRepository(db *Postgres) *EventRepository {
+	return &EventRepository{pool: db.Pool}
+}
+
+// ReplaceEvents deletes the device's events in the window and inserts events in one transaction.
+func (r *EventRepository) ReplaceEvents(ctx context.Context, userID, deviceID string, startDate, endDate time.Time, events []domain.GlucoseEvent) error {
+	userObjectID, err := parseID(userID, "userID")
+	if err != nil {
+		return err
+	}
+	deviceObjectID, err := parseID(deviceID, "deviceID")
+	if err != nil {
+		return err
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue(`DELETE FROM events WHERE user_id = $1 AND device_id = $2 AND start >= $3 AND start <= $4`,
+		userObjectID.Hex(), deviceObjectID.Hex(), startDate, endDate)
+	for _, event := range events {
+		batch.Queue(`INSERT INTO events (id, user_id, device_id, type, level, start, "end", extreme)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			primitive.NewObjectID().Hex(), event.UserID.Hex(), event.DeviceID.Hex(), string(event.Type),
+			event.Level, event.Start, event.End, event.Extreme)
+	}
+
+	err = pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		return tx.SendBatch(ctx, batch).Close()
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to replace events")
+	}
+
+	return nil
+}
+
+func (r *EventRepository) FetchEvents(ctx context.Context, userID string, startDate, endDate time.Time) ([]domain.GlucoseEvent, error) {
+	userObjectID, err := parseID(userID, "userID")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.pool.Query(ctx, `SELECT id, device_id, type, level, start, "end", extreme FROM events
+		WHERE user_id = $1 AND start >= $2 AND start <= $3
+		ORDER BY start`, userObjectID.Hex(), startDate, endDate)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find events")
+	}
+	defer rows.Close()
+
+	events := []domain.GlucoseEvent{}
+	for rows.Next() {
+		event := domain.GlucoseEvent{UserID: userObjectID}
+		var id, deviceID, eventType string
+		err := rows.Scan(&id, &deviceID, &eventType, &event.Level, &event.Start, &event.End, &event.Extreme)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode events")
+		}
+		if event.ID, err = scanID(id); err != nil {
+			return nil, err
+		}
+		if event.DeviceID, err = scanID(deviceID); err != nil {
+			return nil, err
+		}
+		event.Type = domain.EventType(eventType)
+		event.Start = event.Start.UTC()
+		event.End = event.End.UTC()
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to find events")
+	}
+
+	return events, nil
+}
@@ -0,0 +1,146 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// timescaleSuffix marks the variant of a migration applied instead when TimescaleDB is available.
+const timescaleSuffix = ".timescale.sql"
+
+// migrationLock serializes migrations of instances starting at the same time.
+const migrationLock = 7300150
+
+// Migrate applies the migrations not yet recorded in schema_migrations in order of their version,
+// the numeric prefix of the file name. A migration NNNN_name.sql may come with a
+// NNNN_name.timescale.sql variant which is applied instead on servers that offer the TimescaleDB
+// extension.
+//
+// Statements are separated by a semicolon at the end of a line and run one by one outside of a
+// transaction, continuous aggregates cannot be created in one. A failed migration is not recorded
+// and is retried from its first statement, so statements have to be safe to repeat.
+func Migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to acquire connection")
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLock)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock migrations")
+	}
+	defer conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", migrationLock)
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return errors.Wrap(err, "failed to create schema_migrations")
+	}
+
+	var timescale bool
+	err = conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'timescaledb')").Scan(&timescale)
+	if err != nil {
+		return errors.Wrap(err, "failed to check for TimescaleDB")
+	}
+
+	files, err := migrationFiles(timescale)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		version, _, _ := strings.Cut(file, "_")
+
+		var applied bool
+		err = conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", version).Scan(&applied)
+		if err != nil {
+			return errors.Wrap(err, "failed to read schema_migrations")
+		}
+		if applied {
+			continue
+		}
+
+		script, err := migrations.ReadFile("migrations/" + file)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read migration %s", file)
+		}
+
+		for _, statement := range splitStatements(string(script)) {
+			_, err = conn.Exec(ctx, statement)
+			if err != nil {
+				return errors.Wrapf(err, "failed to apply migration %s", file)
+			}
+		}
+
+		_, err = conn.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version)
+		if err != nil {
+			return errors.Wrapf(err, "failed to record migration %s", file)
+		}
+	}
+
+	return nil
+}
+
+// migrationFiles returns the migrations to apply in order, picking the TimescaleDB variants
+// when timescale is set.
+func migrationFiles(timescale bool) ([]string, error) {
+	entries, err := fs.ReadDir(migrations, "migrations")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list migrations")
+	}
+
+	variants := map[string]bool{}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), timescaleSuffix) {
+			variants[strings.TrimSuffix(entry.Name(), timescaleSuffix)+".sql"] = true
+		}
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		isVariant := strings.HasSuffix(name, timescaleSuffix)
+		switch {
+		case isVariant && timescale, !isVariant && !(timescale && variants[name]):
+			files = append(files, name)
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// splitStatements splits a migration into its statements, see Migrate.
+func splitStatements(script string) []string {
+	var statements []string
+	for _, statement := range strings.Split(script, ";\n") {
+		if isBlank(statement) {
+			continue
+		}
+		statements = append(statements, strings.TrimSpace(statement))
+	}
+	return statements
+}
+
+// isBlank reports whether statement holds nothing but whitespace and comments.
+func isBlank(statement string) bool {
+	for _, line := range strings.Split(statement, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
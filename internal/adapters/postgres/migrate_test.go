@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrationFiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		timescale bool
+		expected  []string
+	}{
+		{"Plain PostgreSQL", false, []string{"0001_schema.sql", "0002_daily_readings.sql", "0003_unique_readings.sql", "0004_nightscout_secret.sql"}},
+		{"TimescaleDB", true, []string{"0001_schema.sql", "0002_daily_readings.timescale.sql", "0003_unique_readings.sql", "0004_nightscout_secret.sql"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := migrationFiles(tt.timescale)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, files)
+		})
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- leading comment
+CREATE TABLE a (
+	id INTEGER -- trailing comment; not a separator
+);
+
+SELECT add_policy('a',
+	start_offset => NULL);
+-- nothing follows
+`
+
+	statements := splitStatements(script)
+	assert.Equal(t, []string{
+		"-- leading comment\nCREATE TABLE a (\n\tid INTEGER -- trailing comment; not a separator\n)",
+		"SELECT add_policy('a',\n\tstart_offset => NULL)",
+	}, statements)
+
+	for _, file := range []string{"0001_schema.sql", "0002_daily_readings.sql", "0002_daily_readings.timescale.sql", "0003_unique_readings.sql", "0004_nightscout_secret.sql"} {
+		script, err := migrations.ReadFile("migrations/" + file)
+		assert.NoError(t, err)
+		statements := splitStatements(string(script))
+		assert.NotEmpty(t, statements, file)
+		for _, statement := range statements {
+			assert.Regexp(t, `(?m)^(CREATE|ALTER|SELECT|DELETE) `, statement, file)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+-- IDs are the hex form of the domain's ObjectIDs. Like the Mongo collections the tables carry no
+-- foreign keys, deleting a user leaves their devices and readings in place.
+
+CREATE TABLE IF NOT EXISTS users (
+	id            CHAR(24) PRIMARY KEY,
+	first_name    TEXT NOT NULL,
+	last_name     TEXT NOT NULL,
+	date_of_birth TIMESTAMPTZ NOT NULL,
+	email         TEXT NOT NULL,
+	phone_number  TEXT NOT NULL,
+	timezone      TEXT NOT NULL DEFAULT '',
+	target_range  JSONB,
+	unit          TEXT NOT NULL DEFAULT '' CHECK (unit IN ('', 'mg/dL', 'mmol/L')),
+	support_queue TEXT NOT NULL DEFAULT '',
+	care_team     TEXT[] NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS users_support_queue_idx ON users (support_queue);
+
+CREATE INDEX IF NOT EXISTS users_last_name_idx ON users (lower(last_name) text_pattern_ops);
+
+CREATE TABLE IF NOT EXISTS devices (
+	id            CHAR(24) PRIMARY KEY,
+	user_id       CHAR(24) NOT NULL,
+	manufacturer  TEXT NOT NULL,
+	model         TEXT NOT NULL,
+	serial_number TEXT NOT NULL,
+	status        TEXT NOT NULL DEFAULT '' CHECK (status IN ('', 'active', 'replaced', 'retired')),
+	activated_at  TIMESTAMPTZ,
+	replaced_at   TIMESTAMPTZ,
+	replaced_by   CHAR(24),
+	retired_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS devices_user_id_idx ON devices (user_id);
+
+-- One row per reading. day is the local day the reading was taken on as midnight UTC, see
+-- domain.DayOf, and is the time dimension readings are partitioned and aggregated by.
+CREATE TABLE IF NOT EXISTS readings (
+	user_id   CHAR(24) NOT NULL,
+	device_id CHAR(24) NOT NULL,
+	day       TIMESTAMPTZ NOT NULL,
+	time      TIMESTAMPTZ NOT NULL,
+	value     INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS readings_user_id_day_idx ON readings (user_id, day, device_id, time);
+
+CREATE TABLE IF NOT EXISTS events (
+	id        CHAR(24) PRIMARY KEY,
+	user_id   CHAR(24) NOT NULL,
+	device_id CHAR(24) NOT NULL,
+	type      TEXT NOT NULL,
+	level     INTEGER NOT NULL,
+	start     TIMESTAMPTZ NOT NULL,
+	"end"     TIMESTAMPTZ NOT NULL,
+	extreme   INTEGER NOT NULL,
+	UNIQUE (user_id, device_id, type, start)
+);
+
+CREATE INDEX IF NOT EXISTS events_user_id_start_idx ON events (user_id, start);
+
+-- The audit trail is append-only, the service's database role should only be granted INSERT and
+-- SELECT on it.
+CREATE TABLE IF NOT EXISTS audit (
+	id         CHAR(24) PRIMARY KEY,
+	time       TIMESTAMPTZ NOT NULL,
+	actor      TEXT NOT NULL,
+	actor_role TEXT NOT NULL,
+	subject    TEXT NOT NULL,
+	method     TEXT NOT NULL,
+	endpoint   TEXT NOT NULL,
+	parameters JSONB,
+	status     INTEGER NOT NULL,
+	outcome    TEXT NOT NULL CHECK (outcome IN ('success', 'denied', 'failure'))
+);
+
+CREATE INDEX IF NOT EXISTS audit_actor_time_idx ON audit (actor, time DESC);
+
+CREATE INDEX IF NOT EXISTS audit_subject_time_idx ON audit (subject, time DESC);
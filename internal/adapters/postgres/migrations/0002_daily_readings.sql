@@ -0,0 +1,13 @@
+-- Daily min, max, sum and count of each device's readings, the statistics of domain.Reading.
+-- Without TimescaleDB this is a plain view aggregating on read.
+CREATE OR REPLACE VIEW daily_readings AS
+SELECT
+	user_id,
+	device_id,
+	day,
+	min(value)  AS min_value,
+	max(value)  AS max_value,
+	sum(value)  AS sum_values,
+	count(*)    AS count_readings
+FROM readings
+GROUP BY user_id, device_id, day;
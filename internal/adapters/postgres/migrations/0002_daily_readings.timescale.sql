@@ -0,0 +1,26 @@
+-- Readings become a hypertable chunked by week of day, daily_readings a continuous aggregate.
+-- Real-time aggregation keeps the aggregate current for days not yet materialized. Readings
+-- backfilled into materialized days, e.g. by imports, show once the policy refreshed them.
+CREATE EXTENSION IF NOT EXISTS timescaledb;
+
+SELECT create_hypertable('readings', 'day', chunk_time_interval => INTERVAL '7 days', if_not_exists => TRUE);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS daily_readings
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+	user_id,
+	device_id,
+	time_bucket(INTERVAL '1 day', day) AS day,
+	min(value)  AS min_value,
+	max(value)  AS max_value,
+	sum(value)  AS sum_values,
+	count(*)    AS count_readings
+FROM readings
+GROUP BY user_id, device_id, time_bucket(INTERVAL '1 day', day)
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('daily_readings',
+	start_offset => NULL,
+	end_offset => INTERVAL '1 day',
+	schedule_interval => INTERVAL '15 minutes',
+	if_not_exists => TRUE);
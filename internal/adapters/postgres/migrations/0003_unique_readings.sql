@@ -0,0 +1,8 @@
+-- Readings are identified by device and time, uploading one again is a no-op. day is part of the
+-- key because unique indexes of hypertables have to include the partitioning column, it is derived
+-- from time. Duplicates stored before are removed first.
+DELETE FROM readings a
+USING readings b
+WHERE a.device_id = b.device_id AND a.day = b.day AND a.time = b.time AND a.ctid > b.ctid;
+
+CREATE UNIQUE INDEX IF NOT EXISTS readings_device_id_day_time_key ON readings (device_id, day, time);
@@ -0,0 +1,2 @@
+-- Nightscout sites authenticate with a secret of their own, only its hash is stored.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS nightscout_secret_hash TEXT NOT NULL DEFAULT '';
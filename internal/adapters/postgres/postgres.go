@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"glooko/internal/domain"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Postgres struct {
+	Pool *pgxpool.Pool
+}
+
+// NewPostgres opens a connection pool and applies pending migrations.
+func NewPostgres(ctx context.Context, url string) (*Postgres, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to PostgreSQL")
+	}
+
+	err = Migrate(ctx, pool)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return &Postgres{Pool: pool}, nil
+}
+
+// IDs keep the ObjectID format of the domain and are stored as their 24 character hex form.
+func parseID(id, name string) (primitive.ObjectID, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, errors.Wrapf(domain.ErrInvalidID, "failed to parse %s", name)
+	}
+	return oid, nil
+}
+
+// scanID converts an ID read from the database.
+func scanID(id string) (primitive.ObjectID, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, errors.Wrapf(err, "malformed stored ID %q", id)
+	}
+	return oid, nil
+}
+
+// nullableID returns the hex form of id, nil for a nil pointer.
+func nullableID(id *primitive.ObjectID) *string {
+	if id == nil {
+		return nil
+	}
+	hex := id.Hex()
+	return &hex
+}
+
+// utc returns times read from the database in UTC, the way the Mongo driver decodes them.
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	converted := t.UTC()
+	return &converted
+}
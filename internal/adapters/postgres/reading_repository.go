@@ -0,0 +1,259 @@
+package postgres
+
+import (
+	"context"
+	"glooko/internal/domain"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+)
+
+type ReadingRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewReadingRepository(db *Postgres) *ReadingRepository {
+	return &ReadingRepository{pool: db.Pool}
+}
+
+// insertReading stores a reading unless the device has one at its time.
+const insertReading = `INSERT INTO readings (user_id, device_id, day, time, value) VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (device_id, day, time) DO NOTHING`
+
+// readingTime truncates timestamp to the millisecond readings are identified by, as MongoDB stores
+// them. PostgreSQL would keep microseconds.
+func readingTime(timestamp time.Time) time.Time {
+	return time.UnixMilli(timestamp.UnixMilli()).In(timestamp.Location())
+}
+
+// AddReadingAndUpdateStats inserts the reading, the daily statistics are maintained by the
+// daily_readings aggregate. A reading the device already has at the same time is skipped.
+func (r *ReadingRepository) AddReadingAndUpdateStats(ctx context.Context, deviceID, userID string, value int, timestamp time.Time) error {
+	userObjectID, err := parseID(userID, "userID")
+	if err != nil {
+		return err
+	}
+
+	deviceObjID, err := parseID(deviceID, "deviceID")
+	if err != nil {
+		return err
+	}
+
+	_, err = r.pool.Exec(ctx, insertReading, userObjectID.Hex(), deviceObjID.Hex(), domain.DayOf(timestamp), readingTime(timestamp), value)
+	if err != nil {
+		return errors.Wrap(err, "failed to add reading")
+	}
+
+	return nil
+}
+
+// AddReadingsAndUpdateStats inserts the readings in one transaction, pipelined in a single batch.
+// Each insert runs under a savepoint, a failing one is rolled back on its own and the batch is
+// resent from the next reading, so it costs a round trip per failed reading only. Readings the
+// insert skipped are reported as duplicates.
+func (r *ReadingRepository) AddReadingsAndUpdateStats(ctx context.Context, userID string, readings []domain.DeviceReading) ([]error, error) {
+	userObjectID, err := parseID(userID, "userID")
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]error, len(readings))
+	deviceIDs := make([]string, len(readings))
+	var pending []int // Positions in readings of the inserts to run
+	for i, reading := range readings {
+		deviceObjID, err := parseID(reading.DeviceID, "deviceID")
+		if err != nil {
+			results[i] = err
+			continue
+		}
+		deviceIDs[i] = deviceObjID.Hex()
+		pending = append(pending, i)
+	}
+
+	if len(pending) == 0 {
+		return results, nil
+	}
+
+	err = pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		var err error
+		for len(pending) > 0 {
+			pending, err = insertReadings(ctx, tx, userObjectID.Hex(), deviceIDs, readings, pending, results)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to add readings")
+	}
+
+	return results, nil
+}
+
+// insertReadings sends the pending inserts in a batch and records their outcome in results. It
+// stops at the first failing insert, rolls it back and returns the readings after it.
+func insertReadings(ctx context.Context, tx pgx.Tx, userID string, deviceIDs []string, readings []domain.DeviceReading, pending []int, results []error) ([]int, error) {
+	batch := &pgx.Batch{}
+	for _, i := range pending {
+		reading := readings[i]
+		batch.Queue("SAVEPOINT reading")
+		batch.Queue(insertReading, userID, deviceIDs[i], domain.DayOf(reading.Time), readingTime(reading.Time), reading.Value)
+		batch.Queue("RELEASE SAVEPOINT reading")
+	}
+
+	batchResults := tx.SendBatch(ctx, batch)
+	defer batchResults.Close()
+
+	for n, i := range pending {
+		_, err := batchResults.Exec()
+		if err != nil {
+			return nil, err
+		}
+
+		tag, err := batchResults.Exec()
+		if err != nil {
+			results[i] = errors.Wrap(err, "failed to add reading")
+
+			// The statements queued after the insert were skipped with the transaction aborted
+			_ = batchResults.Close()
+			_, err = tx.Exec(ctx, "ROLLBACK TO SAVEPOINT reading")
+			if err != nil {
+				return nil, err
+			}
+			return pending[n+1:], nil
+		}
+		if tag.RowsAffected() == 0 {
+			results[i] = errors.Wrap(domain.ErrDuplicate, "reading already stored")
+		}
+
+		_, err = batchResults.Exec()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, batchResults.Close()
+}
+
+func (r *ReadingRepository) FetchReadings(ctx context.Context, userID string, startDate, endDate time.Time) ([]domain.Reading, error) {
+	var readings []domain.Reading
+	err := r.StreamReadings(ctx, userID, startDate, endDate, func(reading domain.Reading) error {
+		readings = append(readings, reading)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return readings, nil
+}
+
+// StreamReadings reads the range ordered by day and device and assembles a daily document from
+// each run of rows. The statistics are computed from the same rows so they always match the
+// entries, readings backfilled into days the aggregate has not refreshed yet included.
+func (r *ReadingRepository) StreamReadings(ctx context.Context, userID string, startDate, endDate time.Time, fn func(domain.Reading) error) error {
+	userObjectID, err := parseID(userID, "userID")
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.pool.Query(ctx, `SELECT device_id, day, time, value FROM readings
+		WHERE user_id = $1 AND day >= $2 AND day <= $3
+		ORDER BY day, device_id, time`, userObjectID.Hex(), startDate, endDate)
+	if err != nil {
+		return errors.Wrap(err, "failed to find readings")
+	}
+	defer rows.Close()
+
+	var reading domain.Reading
+	var currentDevice string
+	for rows.Next() {
+		var deviceID string
+		var day, timestamp time.Time
+		var value int
+		if err := rows.Scan(&deviceID, &day, &timestamp, &value); err != nil {
+			return errors.Wrap(err, "failed to decode reading")
+		}
+
+		if reading.CountReadings > 0 && (deviceID != currentDevice || !day.Equal(reading.Day)) {
+			if err := fn(reading); err != nil {
+				return err
+			}
+			reading = domain.Reading{}
+		}
+
+		if reading.CountReadings == 0 {
+			deviceObjID, err := scanID(deviceID)
+			if err != nil {
+				return err
+			}
+			currentDevice = deviceID
+			reading = domain.Reading{
+				UserID:   userObjectID,
+				DeviceID: deviceObjID,
+				Day:      day.UTC(),
+				MinValue: value,
+				MaxValue: value,
+			}
+		}
+
+		reading.Readings = append(reading.Readings, domain.ReadingEntry{Time: timestamp.UTC(), Value: value})
+		reading.MinValue = min(reading.MinValue, value)
+		reading.MaxValue = max(reading.MaxValue, value)
+		reading.SumValues += value
+		reading.CountReadings++
+		reading.AvgValue = float64(reading.SumValues) / float64(reading.CountReadings)
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "failed to iterate readings")
+	}
+
+	if reading.CountReadings > 0 {
+		return fn(reading)
+	}
+
+	return nil
+}
+
+// FetchDevicesOverview counts the readings of each device per day over the last days from the
+// daily_readings aggregate.
+func (r *ReadingRepository) FetchDevicesOverview(ctx context.Context, userID string, days int) ([]domain.DayDeviceCounts, error) {
+	userObjectID, err := parseID(userID, "userID")
+	if err != nil {
+		return nil, err
+	}
+
+	startDate := time.Now().AddDate(0, 0, -days)
+
+	rows, err := r.pool.Query(ctx, `SELECT day, device_id, count_readings FROM daily_readings
+		WHERE user_id = $1 AND day >= $2
+		ORDER BY day, device_id`, userObjectID.Hex(), startDate)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to aggregate readings")
+	}
+	defer rows.Close()
+
+	var results []domain.DayDeviceCounts
+	for rows.Next() {
+		var day time.Time
+		var deviceCount domain.DeviceCount
+		if err := rows.Scan(&day, &deviceCount.DeviceID, &deviceCount.Count); err != nil {
+			return nil, errors.Wrap(err, "failed to decode device counts")
+		}
+
+		day = day.UTC()
+		if len(results) == 0 || !results[len(results)-1].Day.Equal(day) {
+			results = append(results, domain.DayDeviceCounts{Day: day})
+		}
+		last := &results[len(results)-1]
+		last.Devices = append(last.Devices, deviceCount)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to aggregate readings")
+	}
+
+	return results, nil
+}
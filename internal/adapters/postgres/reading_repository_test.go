@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// rejectedValue is refused by the constraint TestAddReadingsAndUpdateStats_FailingReading adds,
+// no device reports it.
+const rejectedValue = 4242
+
+func TestAddReadingsAndUpdateStats_FailingReading(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	// NOT VALID leaves the stored readings alone, the database may be shared
+	_, err := db.Pool.Exec(ctx, `ALTER TABLE readings ADD CONSTRAINT readings_test_rejected_value
+		CHECK (value <> 4242) NOT VALID`)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := db.Pool.Exec(ctx, "ALTER TABLE readings DROP CONSTRAINT readings_test_rejected_value")
+		assert.NoError(t, err)
+	})
+
+	repo := NewReadingRepository(db)
+	userID := primitive.NewObjectID().Hex()
+	deviceID := primitive.NewObjectID().Hex()
+	start := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	batch := []domain.DeviceReading{
+		{DeviceID: deviceID, Time: start, Value: 100},
+		{DeviceID: deviceID, Time: start.Add(5 * time.Minute), Value: rejectedValue},
+		{DeviceID: deviceID, Time: start.Add(10 * time.Minute), Value: 110},
+		{DeviceID: deviceID, Time: start, Value: 100},
+		{DeviceID: deviceID, Time: start.Add(15 * time.Minute), Value: rejectedValue},
+		{DeviceID: deviceID, Time: start.Add(20 * time.Minute), Value: 120},
+	}
+	results, err := repo.AddReadingsAndUpdateStats(ctx, userID, batch)
+	require.NoError(t, err)
+	require.Len(t, results, len(batch))
+
+	// The failing readings are rolled back on their own, the others are stored
+	assert.NoError(t, results[0])
+	assert.Error(t, results[1])
+	assert.NotErrorIs(t, results[1], domain.ErrDuplicate)
+	assert.NoError(t, results[2])
+	assert.ErrorIs(t, results[3], domain.ErrDuplicate)
+	assert.Error(t, results[4])
+	assert.NoError(t, results[5])
+
+	readings, err := repo.FetchReadings(ctx, userID, domain.DayOf(start), domain.DayOf(start))
+	require.NoError(t, err)
+	require.Len(t, readings, 1)
+	expected := []domain.ReadingEntry{
+		{Time: start, Value: 100},
+		{Time: start.Add(10 * time.Minute), Value: 110},
+		{Time: start.Add(20 * time.Minute), Value: 120},
+	}
+	require.Len(t, readings[0].Readings, len(expected))
+	for i, entry := range readings[0].Readings {
+		assert.True(t, expected[i].Time.Equal(entry.Time), "time of entry %d", i)
+		assert.Equal(t, expected[i].Value, entry.Value, "value of entry %d", i)
+	}
+}
@@ -0,0 +1,257 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"glooko/internal/domain"
+	"glooko/internal/ports"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// uniqueViolation is the SQLSTATE of a duplicate key.
+const uniqueViolation = "23505"
+
+const userColumns = `id, first_name, last_name, date_of_birth, email, phone_number, timezone,
+	target_range, unit, support_queue, care_team, nightscout_secret_hash`
+
+type UserRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewUserRepository(db *Postgres) ports.UserRepository {
+	return &UserRepository{pool: db.Pool}
+}
+
+func (r *UserRepository) Save(ctx context.Context, user domain.User) (domain.User, error) {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+
+	row := r.pool.QueryRow(ctx, `INSERT INTO users (`+userColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING `+userColumns,
+		user.ID.Hex(), user.FirstName, user.LastName, user.DateOfBirth, user.Email, user.PhoneNumber,
+		user.Timezone, user.TargetRange, string(user.Unit), user.SupportQueue, careTeam(user.CareTeam),
+		user.NightscoutSecretHash)
+
+	savedUser, err := scanUser(row)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return domain.User{}, errors.Wrap(domain.ErrConflict, "user already exists")
+		}
+		return domain.User{}, errors.Wrap(err, "failed to save user")
+	}
+
+	return savedUser, nil
+}
+
+func (r *UserRepository) FindByID(ctx context.Context, id string) (domain.User, error) {
+	oid, err := parseID(id, "userID")
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	row := r.pool.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, oid.Hex())
+	user, err := scanUser(row)
+	if err == pgx.ErrNoRows {
+		return domain.User{}, errors.Wrap(domain.ErrNotFound, "user not found")
+	}
+	if err != nil {
+		return domain.User{}, errors.Wrap(err, "failed to fetch user")
+	}
+
+	return user, nil
+}
+
+func (r *UserRepository) Find(ctx context.Context, filter domain.UserFilter) ([]domain.User, int64, error) {
+	var conditions []string
+	var args []any
+	if filter.Email != "" {
+		args = append(args, filter.Email)
+		conditions = append(conditions, fmt.Sprintf("email = $%d", len(args)))
+	}
+	if filter.LastName != "" {
+		args = append(args, escapeLike(strings.ToLower(filter.LastName))+"%")
+		conditions = append(conditions, fmt.Sprintf("lower(last_name) LIKE $%d", len(args)))
+	}
+	if filter.SupportQueues != nil {
+		args = append(args, filter.SupportQueues)
+		conditions = append(conditions, fmt.Sprintf("support_queue = ANY($%d)", len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int64
+	err := r.pool.QueryRow(ctx, `SELECT count(*) FROM users`+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count users")
+	}
+
+	query := `SELECT ` + userColumns + ` FROM users` + where + ` ORDER BY last_name, first_name, id`
+	query += fmt.Sprintf(" OFFSET %d", filter.Offset)
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to find users")
+	}
+	defer rows.Close()
+
+	users := []domain.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to decode users")
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to find users")
+	}
+
+	return users, total, nil
+}
+
+func (r *UserRepository) Update(ctx context.Context, id string, update domain.UserUpdate) (domain.User, error) {
+	oid, err := parseID(id, "userID")
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	set := setClause{}
+	if update.FirstName != nil {
+		set.add("first_name", *update.FirstName)
+	}
+	if update.LastName != nil {
+		set.add("last_name", *update.LastName)
+	}
+	if update.DateOfBirth != nil {
+		set.add("date_of_birth", *update.DateOfBirth)
+	}
+	if update.Email != nil {
+		set.add("email", *update.Email)
+	}
+	if update.PhoneNumber != nil {
+		set.add("phone_number", *update.PhoneNumber)
+	}
+	if update.Timezone != nil {
+		set.add("timezone", *update.Timezone)
+	}
+	if update.TargetRange != nil {
+		set.add("target_range", *update.TargetRange)
+	}
+	if update.Unit != nil {
+		set.add("unit", string(*update.Unit))
+	}
+	if update.SupportQueue != nil {
+		set.add("support_queue", *update.SupportQueue)
+	}
+	if update.CareTeam != nil {
+		set.add("care_team", careTeam(*update.CareTeam))
+	}
+	if update.NightscoutSecretHash != nil {
+		set.add("nightscout_secret_hash", *update.NightscoutSecretHash)
+	}
+
+	if len(set.columns) == 0 {
+		return r.FindByID(ctx, id)
+	}
+
+	query, args := set.update("users", oid.Hex())
+	row := r.pool.QueryRow(ctx, query+` RETURNING `+userColumns, args...)
+	updatedUser, err := scanUser(row)
+	if err == pgx.ErrNoRows {
+		return domain.User{}, errors.Wrap(domain.ErrNotFound, "user not found")
+	}
+	if err != nil {
+		return domain.User{}, errors.Wrap(err, "failed to update user")
+	}
+
+	return updatedUser, nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id string) error {
+	oid, err := parseID(id, "userID")
+	if err != nil {
+		return err
+	}
+
+	result, err := r.pool.Exec(ctx, `DELETE FROM users WHERE id = $1`, oid.Hex())
+	if err != nil {
+		return errors.Wrap(err, "failed to delete user")
+	}
+	if result.RowsAffected() == 0 {
+		return errors.Wrap(domain.ErrNotFound, "user not found")
+	}
+
+	return nil
+}
+
+func scanUser(row pgx.Row) (domain.User, error) {
+	var user domain.User
+	var id, unit string
+	err := row.Scan(&id, &user.FirstName, &user.LastName, &user.DateOfBirth, &user.Email, &user.PhoneNumber,
+		&user.Timezone, &user.TargetRange, &unit, &user.SupportQueue, &user.CareTeam,
+		&user.NightscoutSecretHash)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	user.ID, err = scanID(id)
+	if err != nil {
+		return domain.User{}, err
+	}
+	user.DateOfBirth = user.DateOfBirth.UTC()
+	user.Unit = domain.GlucoseUnit(unit)
+	if len(user.CareTeam) == 0 {
+		user.CareTeam = nil
+	}
+
+	return user, nil
+}
+
+// careTeam stores a missing care team as an empty array.
+func careTeam(members []string) []string {
+	if members == nil {
+		return []string{}
+	}
+	return members
+}
+
+// setClause collects the columns of a partial update.
+type setClause struct {
+	columns []string
+	args    []any
+}
+
+func (s *setClause) add(column string, value any) {
+	s.args = append(s.args, value)
+	s.columns = append(s.columns, fmt.Sprintf("%s = $%d", column, len(s.args)))
+}
+
+// update returns the statement updating the row of table with id.
+func (s *setClause) update(table, id string) (string, []any) {
+	args := append(s.args, id)
+	return fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d", table, strings.Join(s.columns, ", "), len(args)), args
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
@@ -0,0 +1,64 @@
+package analytics
+
+import (
+	"glooko/internal/domain"
+	"math"
+	"sort"
+	"time"
+)
+
+// AGPSlot holds the glucose percentiles of one time-of-day slot of an Ambulatory Glucose Profile.
+type AGPSlot struct {
+	Minute int // Minutes since local midnight at which the slot starts
+	Count  int
+	P5     float64
+	P25    float64
+	P50    float64
+	P75    float64
+	P95    float64
+}
+
+// ComputeAGP folds entries onto a single day in loc, split into slots of slotMinutes, and
+// returns the percentile curves for every slot holding at least one reading.
+func ComputeAGP(entries []domain.ReadingEntry, loc *time.Location, slotMinutes int) []AGPSlot {
+	slots := make(map[int][]float64)
+	for _, entry := range entries {
+		local := entry.Time.In(loc)
+		minute := (local.Hour()*60 + local.Minute()) / slotMinutes * slotMinutes
+		slots[minute] = append(slots[minute], float64(entry.Value))
+	}
+
+	result := make([]AGPSlot, 0, len(slots))
+	for minute, values := range slots {
+		sort.Float64s(values)
+		result = append(result, AGPSlot{
+			Minute: minute,
+			Count:  len(values),
+			P5:     percentile(values, 5),
+			P25:    percentile(values, 25),
+			P50:    percentile(values, 50),
+			P75:    percentile(values, 75),
+			P95:    percentile(values, 95),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Minute < result[j].Minute
+	})
+
+	return result
+}
+
+// percentile returns the p-th percentile of sorted values using linear interpolation
+// between closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	value := sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+	return round1(value)
+}
@@ -0,0 +1,53 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeAGP(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	var entries []domain.ReadingEntry
+	for day := 0; day < 5; day++ {
+		// 08:02 and 08:07 local on five consecutive days, values 100..140 and 200..240
+		morning := time.Date(2024, 4, 1+day, 8, 2, 0, 0, loc)
+		entries = append(entries,
+			domain.ReadingEntry{Time: morning.UTC(), Value: 100 + day*10},
+			domain.ReadingEntry{Time: morning.Add(5 * time.Minute).UTC(), Value: 200 + day*10},
+		)
+	}
+
+	t.Run("Five Minute Slots", func(t *testing.T) {
+		slots := ComputeAGP(entries, loc, 5)
+		assert.Len(t, slots, 2)
+
+		assert.Equal(t, 8*60, slots[0].Minute)
+		assert.Equal(t, 5, slots[0].Count)
+		assert.Equal(t, 102.0, slots[0].P5)
+		assert.Equal(t, 110.0, slots[0].P25)
+		assert.Equal(t, 120.0, slots[0].P50)
+		assert.Equal(t, 130.0, slots[0].P75)
+		assert.Equal(t, 138.0, slots[0].P95)
+
+		assert.Equal(t, 8*60+5, slots[1].Minute)
+		assert.Equal(t, 220.0, slots[1].P50)
+	})
+
+	t.Run("Fifteen Minute Slots", func(t *testing.T) {
+		slots := ComputeAGP(entries, loc, 15)
+		assert.Len(t, slots, 1)
+		assert.Equal(t, 8*60, slots[0].Minute)
+		assert.Equal(t, 10, slots[0].Count)
+		assert.Equal(t, 170.0, slots[0].P50)
+	})
+
+	t.Run("No Readings", func(t *testing.T) {
+		assert.Empty(t, ComputeAGP(nil, loc, 5))
+	})
+}
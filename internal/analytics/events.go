@@ -0,0 +1,103 @@
+package analytics
+
+import (
+	"glooko/internal/domain"
+	"sort"
+	"time"
+)
+
+const (
+	// minEventDuration is the consensus minimum duration of a glycemic episode.
+	minEventDuration = 15 * time.Minute
+	// maxReadingGap splits an episode when consecutive readings are further apart.
+	maxReadingGap = 20 * time.Minute
+)
+
+// Episode is a hypoglycemic or hyperglycemic episode detected in a series of readings.
+type Episode struct {
+	Type    domain.EventType
+	Level   int // 1 or 2 following the international consensus
+	Start   time.Time
+	End     time.Time
+	Extreme int // Nadir of a hypoglycemia or peak of a hyperglycemia, mg/dL
+}
+
+// DetectEvents walks entries in time order and returns episodes of at least 15 consecutive
+// minutes below targets.Low (level 2 below targets.VeryLow) or above targets.High (level 2
+// above targets.VeryHigh). A gap of more than 20 minutes between readings ends an episode.
+func DetectEvents(entries []domain.ReadingEntry, targets domain.TargetRange) []Episode {
+	sorted := make([]domain.ReadingEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	var episodes []Episode
+
+	for _, run := range runs(sorted, func(v int) bool { return v < targets.Low }) {
+		level := 1
+		if len(runs(run, func(v int) bool { return v < targets.VeryLow })) > 0 {
+			level = 2
+		}
+		episodes = append(episodes, newEpisode(domain.EventHypoglycemia, level, run, func(a, b int) bool { return a < b }))
+	}
+
+	for _, run := range runs(sorted, func(v int) bool { return v > targets.High }) {
+		level := 1
+		if len(runs(run, func(v int) bool { return v > targets.VeryHigh })) > 0 {
+			level = 2
+		}
+		episodes = append(episodes, newEpisode(domain.EventHyperglycemia, level, run, func(a, b int) bool { return a > b }))
+	}
+
+	sort.Slice(episodes, func(i, j int) bool {
+		return episodes[i].Start.Before(episodes[j].Start)
+	})
+
+	return episodes
+}
+
+// runs returns the stretches of consecutive entries matching match that last at least
+// minEventDuration.
+func runs(entries []domain.ReadingEntry, match func(int) bool) [][]domain.ReadingEntry {
+	var result [][]domain.ReadingEntry
+	var current []domain.ReadingEntry
+
+	flush := func() {
+		if len(current) > 0 && current[len(current)-1].Time.Sub(current[0].Time) >= minEventDuration {
+			result = append(result, current)
+		}
+		current = nil
+	}
+
+	for _, entry := range entries {
+		if !match(entry.Value) {
+			flush()
+			continue
+		}
+		if len(current) > 0 && entry.Time.Sub(current[len(current)-1].Time) > maxReadingGap {
+			flush()
+		}
+		current = append(current, entry)
+	}
+	flush()
+
+	return result
+}
+
+func newEpisode(eventType domain.EventType, level int, run []domain.ReadingEntry, moreExtreme func(a, b int) bool) Episode {
+	extreme := run[0].Value
+	for _, entry := range run {
+		if moreExtreme(entry.Value, extreme) {
+			extreme = entry.Value
+		}
+	}
+
+	return Episode{
+		Type:    eventType,
+		Level:   level,
+		Start:   run[0].Time,
+		End:     run[len(run)-1].Time,
+		Extreme: extreme,
+	}
+}
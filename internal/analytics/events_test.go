@@ -0,0 +1,65 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectEvents(t *testing.T) {
+	start := time.Date(2024, 4, 6, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Level 1 Hypoglycemia", func(t *testing.T) {
+		events := DetectEvents(series(start, 100, 65, 62, 60, 64, 90), domain.DefaultTargetRange)
+		assert.Len(t, events, 1)
+		assert.Equal(t, domain.EventHypoglycemia, events[0].Type)
+		assert.Equal(t, 1, events[0].Level)
+		assert.Equal(t, start.Add(5*time.Minute), events[0].Start)
+		assert.Equal(t, start.Add(20*time.Minute), events[0].End)
+		assert.Equal(t, 60, events[0].Extreme)
+	})
+
+	t.Run("Level 2 Hypoglycemia", func(t *testing.T) {
+		events := DetectEvents(series(start, 65, 50, 48, 45, 52, 66, 100), domain.DefaultTargetRange)
+		assert.Len(t, events, 1)
+		assert.Equal(t, 2, events[0].Level)
+		assert.Equal(t, 45, events[0].Extreme)
+	})
+
+	t.Run("Too Short To Count", func(t *testing.T) {
+		// 10 minutes below range
+		events := DetectEvents(series(start, 100, 60, 60, 60, 100), domain.DefaultTargetRange)
+		assert.Empty(t, events)
+	})
+
+	t.Run("Short Level 2 Dip Stays Level 1", func(t *testing.T) {
+		events := DetectEvents(series(start, 65, 50, 65, 65, 65, 100), domain.DefaultTargetRange)
+		assert.Len(t, events, 1)
+		assert.Equal(t, 1, events[0].Level)
+	})
+
+	t.Run("Gap Splits Episode", func(t *testing.T) {
+		entries := append(series(start, 60, 60, 60), series(start.Add(time.Hour), 60, 60, 60)...)
+		assert.Empty(t, DetectEvents(entries, domain.DefaultTargetRange))
+	})
+
+	t.Run("Hyperglycemia", func(t *testing.T) {
+		events := DetectEvents(series(start, 150, 200, 260, 280, 270, 255, 170), domain.DefaultTargetRange)
+		assert.Len(t, events, 1)
+		assert.Equal(t, domain.EventHyperglycemia, events[0].Type)
+		assert.Equal(t, 2, events[0].Level)
+		assert.Equal(t, 280, events[0].Extreme)
+		assert.Equal(t, 20*time.Minute, events[0].End.Sub(events[0].Start))
+	})
+
+	t.Run("Events Are Ordered", func(t *testing.T) {
+		entries := series(start, 200, 200, 200, 200, 100, 60, 60, 60, 60)
+		events := DetectEvents(entries, domain.DefaultTargetRange)
+		assert.Len(t, events, 2)
+		assert.Equal(t, domain.EventHyperglycemia, events[0].Type)
+		assert.Equal(t, domain.EventHypoglycemia, events[1].Type)
+	})
+}
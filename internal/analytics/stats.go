@@ -0,0 +1,133 @@
+package analytics
+
+import (
+	"glooko/internal/domain"
+	"math"
+	"sort"
+)
+
+// Statistics holds glycemic variability statistics over a series of readings (mg/dL).
+type Statistics struct {
+	Count int
+	Mean  float64
+	SD    float64 // Sample standard deviation
+	CV    float64 // Coefficient of variation in percent
+	GMI   float64 // Glucose Management Indicator, estimated A1c in percent
+	MAGE  float64 // Mean Amplitude of Glycemic Excursions
+}
+
+// ComputeStatistics computes variability statistics over entries, which do not need to be sorted.
+func ComputeStatistics(entries []domain.ReadingEntry) Statistics {
+	if len(entries) == 0 {
+		return Statistics{}
+	}
+
+	sorted := make([]domain.ReadingEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	values := make([]float64, len(sorted))
+	sum := 0.0
+	for i, entry := range sorted {
+		values[i] = float64(entry.Value)
+		sum += values[i]
+	}
+	mean := sum / float64(len(values))
+
+	sd := 0.0
+	if len(values) > 1 {
+		squares := 0.0
+		for _, v := range values {
+			squares += (v - mean) * (v - mean)
+		}
+		sd = math.Sqrt(squares / float64(len(values)-1))
+	}
+
+	cv := 0.0
+	if mean > 0 {
+		cv = sd / mean * 100
+	}
+
+	return Statistics{
+		Count: len(values),
+		Mean:  round1(mean),
+		SD:    round1(sd),
+		CV:    round1(cv),
+		GMI:   round1(3.31 + 0.02392*mean),
+		MAGE:  round1(mage(values, sd)),
+	}
+}
+
+// mage averages the peak-to-nadir excursions larger than one standard deviation. Only
+// excursions in the direction of the first qualifying one are counted, as in the original
+// Service et al. definition.
+func mage(values []float64, sd float64) float64 {
+	if sd == 0 {
+		return 0
+	}
+
+	extrema := turningPoints(values)
+
+	var total float64
+	var count int
+	direction := 0
+	for i := 1; i < len(extrema); i++ {
+		delta := extrema[i] - extrema[i-1]
+		if math.Abs(delta) <= sd {
+			continue
+		}
+
+		sign := 1
+		if delta < 0 {
+			sign = -1
+		}
+		if direction == 0 {
+			direction = sign
+		}
+		if sign != direction {
+			continue
+		}
+
+		total += math.Abs(delta)
+		count++
+	}
+
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
+
+// turningPoints returns the alternating sequence of local peaks and nadirs in values,
+// including both end points.
+func turningPoints(values []float64) []float64 {
+	if len(values) < 2 {
+		return values
+	}
+
+	points := []float64{values[0]}
+	direction := 0
+	for i := 1; i < len(values); i++ {
+		delta := values[i] - values[i-1]
+		if delta == 0 {
+			continue
+		}
+
+		sign := 1
+		if delta < 0 {
+			sign = -1
+		}
+		if direction != 0 && sign != direction {
+			points = append(points, values[i-1])
+		}
+		direction = sign
+	}
+
+	return append(points, values[len(values)-1])
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
@@ -0,0 +1,56 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func series(start time.Time, values ...int) []domain.ReadingEntry {
+	entries := make([]domain.ReadingEntry, len(values))
+	for i, v := range values {
+		entries[i] = domain.ReadingEntry{Time: start.Add(time.Duration(i) * 5 * time.Minute), Value: v}
+	}
+	return entries
+}
+
+func TestComputeStatistics(t *testing.T) {
+	start := time.Date(2024, 4, 6, 0, 0, 0, 0, time.UTC)
+
+	t.Run("No Readings", func(t *testing.T) {
+		assert.Equal(t, Statistics{}, ComputeStatistics(nil))
+	})
+
+	t.Run("Flat Series", func(t *testing.T) {
+		stats := ComputeStatistics(series(start, 154, 154, 154))
+		assert.Equal(t, 3, stats.Count)
+		assert.Equal(t, 154.0, stats.Mean)
+		assert.Equal(t, 0.0, stats.SD)
+		assert.Equal(t, 0.0, stats.CV)
+		assert.Equal(t, 7.0, stats.GMI) // 3.31 + 0.02392 * 154
+		assert.Equal(t, 0.0, stats.MAGE)
+	})
+
+	t.Run("Oscillating Series", func(t *testing.T) {
+		stats := ComputeStatistics(series(start, 100, 200, 100, 200, 100))
+		assert.Equal(t, 140.0, stats.Mean)
+		assert.Equal(t, 54.8, stats.SD)
+		assert.Equal(t, 39.1, stats.CV)
+		assert.Equal(t, 100.0, stats.MAGE)
+	})
+
+	t.Run("Small Excursions Are Ignored", func(t *testing.T) {
+		// Only the 100 -> 250 rise exceeds one SD, the 10 mg/dL wiggles do not count
+		stats := ComputeStatistics(series(start, 100, 110, 100, 250, 240, 250))
+		assert.Equal(t, 150.0, stats.MAGE)
+	})
+
+	t.Run("Unsorted Input", func(t *testing.T) {
+		entries := series(start, 100, 200, 100, 200, 100)
+		entries[0], entries[3] = entries[3], entries[0]
+		assert.Equal(t, 100.0, ComputeStatistics(entries).MAGE)
+	})
+}
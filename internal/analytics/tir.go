@@ -0,0 +1,53 @@
+package analytics
+
+import (
+	"glooko/internal/domain"
+	"math"
+)
+
+// TimeInRange holds the share of readings, in percent, falling into each consensus band.
+type TimeInRange struct {
+	VeryLow  float64
+	Low      float64
+	InRange  float64
+	High     float64
+	VeryHigh float64
+}
+
+// ComputeTimeInRange splits values (mg/dL) into the bands defined by targets. Readings are
+// assumed to be evenly spaced, so the share of readings approximates the share of time.
+func ComputeTimeInRange(values []int, targets domain.TargetRange) TimeInRange {
+	if len(values) == 0 {
+		return TimeInRange{}
+	}
+
+	var veryLow, low, inRange, high, veryHigh int
+	for _, v := range values {
+		switch {
+		case v < targets.VeryLow:
+			veryLow++
+		case v < targets.Low:
+			low++
+		case v <= targets.High:
+			inRange++
+		case v <= targets.VeryHigh:
+			high++
+		default:
+			veryHigh++
+		}
+	}
+
+	total := float64(len(values))
+	return TimeInRange{
+		VeryLow:  percent(veryLow, total),
+		Low:      percent(low, total),
+		InRange:  percent(inRange, total),
+		High:     percent(high, total),
+		VeryHigh: percent(veryHigh, total),
+	}
+}
+
+// percent returns count as a percentage of total rounded to one decimal place.
+func percent(count int, total float64) float64 {
+	return math.Round(float64(count)/total*1000) / 10
+}
@@ -0,0 +1,49 @@
+package analytics
+
+import (
+	"testing"
+
+	"glooko/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeTimeInRange(t *testing.T) {
+	testCases := []struct {
+		name    string
+		values  []int
+		targets domain.TargetRange
+		expect  TimeInRange
+	}{
+		{
+			name:    "No Readings",
+			values:  []int{},
+			targets: domain.DefaultTargetRange,
+			expect:  TimeInRange{},
+		},
+		{
+			name:    "Band Boundaries",
+			values:  []int{53, 54, 69, 70, 180, 181, 250, 251, 120, 100},
+			targets: domain.DefaultTargetRange,
+			expect:  TimeInRange{VeryLow: 10, Low: 20, InRange: 40, High: 20, VeryHigh: 10},
+		},
+		{
+			name:    "Custom Target Range",
+			values:  []int{65, 75, 150, 160},
+			targets: domain.TargetRange{VeryLow: 54, Low: 63, High: 140, VeryHigh: 250},
+			expect:  TimeInRange{InRange: 50, High: 50},
+		},
+		{
+			name:    "Rounding",
+			values:  []int{100, 100, 200},
+			targets: domain.DefaultTargetRange,
+			expect:  TimeInRange{InRange: 66.7, High: 33.3},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, ComputeTimeInRange(tc.values, tc.targets))
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"fmt"
+	"glooko/internal/analytics"
+	"glooko/internal/domain"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultAGPDays        = 14
+	defaultAGPSlotMinutes = 5
+)
+
+type AGPParams struct {
+	ID   string `validate:"required"`
+	End  string `validate:"omitempty,datetime=2006-01-02"`
+	Days int    `validate:"min=1,max=90"`
+	Slot int    `validate:"oneof=5 15"`
+}
+
+// AGPSlot holds the glucose percentiles for one time-of-day slot, in the unit of the response.
+type AGPSlot struct {
+	Time  string  `json:"time"` // Local time of day the slot starts at, HH:MM
+	Count int     `json:"count"`
+	P5    float64 `json:"p5"`
+	P25   float64 `json:"p25"`
+	P50   float64 `json:"p50"`
+	P75   float64 `json:"p75"`
+	P95   float64 `json:"p95"`
+}
+
+// AGPResponse holds the Ambulatory Glucose Profile of a user.
+type AGPResponse struct {
+	UserID      string    `json:"userId"`
+	Unit        string    `json:"unit"`
+	Start       string    `json:"start"`
+	End         string    `json:"end"`
+	Days        int       `json:"days"`
+	SlotMinutes int       `json:"slotMinutes"`
+	Slots       []AGPSlot `json:"slots"`
+}
+
+func (api *API) GetAGP(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "GetAGP")
+
+	days, err := queryInt(r, "days", defaultAGPDays)
+	if err != nil {
+		log.Errorf("invalid days: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	slot, err := queryInt(r, "slot", defaultAGPSlotMinutes)
+	if err != nil {
+		log.Errorf("invalid slot: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	params := AGPParams{
+		ID:   chi.URLParam(r, "id"),
+		End:  r.URL.Query().Get("end"),
+		Days: days,
+		Slot: slot,
+	}
+
+	err = api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, loc, err := api.findUserWithLocation(ctx, params.ID)
+	if err != nil {
+		log.Errorf("failed to fetch user: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	unit, err := resolveUnit(r, user)
+	if err != nil {
+		log.Errorf("invalid units: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	endDay := domain.DayOf(time.Now().In(loc))
+	if params.End != "" {
+		endDay, _ = time.Parse("2006-01-02", params.End)
+	}
+	startDay := endDay.AddDate(0, 0, -(params.Days - 1))
+
+	start, end, err := parseDates(startDay.Format("2006-01-02"), endDay.Format("2006-01-02"), loc)
+	if err != nil {
+		log.Errorf("invalid date range: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	fetchStart, fetchEnd := bucketRange(start, end)
+	readings, err := api.readingsRepo.FetchReadings(ctx, params.ID, fetchStart, fetchEnd)
+	if err != nil {
+		log.Errorf("failed to fetch readings: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	aggregatedData := aggregateReadings(readings, loc, start, end, user.Targets())
+	profile := analytics.ComputeAGP(windowEntries(aggregatedData), loc, params.Slot)
+
+	slots := make([]AGPSlot, len(profile))
+	for i, s := range profile {
+		slots[i] = AGPSlot{
+			Time:  fmt.Sprintf("%02d:%02d", s.Minute/60, s.Minute%60),
+			Count: s.Count,
+			P5:    unit.RoundDerived(unit.FromMgDL(s.P5)),
+			P25:   unit.RoundDerived(unit.FromMgDL(s.P25)),
+			P50:   unit.RoundDerived(unit.FromMgDL(s.P50)),
+			P75:   unit.RoundDerived(unit.FromMgDL(s.P75)),
+			P95:   unit.RoundDerived(unit.FromMgDL(s.P95)),
+		}
+	}
+
+	respondWithJSON(w, AGPResponse{
+		UserID:      params.ID,
+		Unit:        string(unit),
+		Start:       start.Format("2006-01-02"),
+		End:         end.Format("2006-01-02"),
+		Days:        params.Days,
+		SlotMinutes: params.Slot,
+		Slots:       slots,
+	})
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+	"glooko/internal/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGetAGP(t *testing.T) {
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+
+	testCases := []struct {
+		name       string
+		query      string
+		start      string
+		end        string
+		expectCode int
+		expectLen  int
+	}{
+		{
+			name:       "Default Window",
+			query:      "?end=2024-04-14",
+			start:      "2024-04-01",
+			end:        "2024-04-14",
+			expectCode: http.StatusOK,
+			expectLen:  2,
+		},
+		{
+			name:       "Custom Window And Slot",
+			query:      "?end=2024-04-14&days=7&slot=15",
+			start:      "2024-04-08",
+			end:        "2024-04-14",
+			expectCode: http.StatusOK,
+			expectLen:  1,
+		},
+		{
+			name:       "Unsupported Slot",
+			query:      "?slot=10",
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Window Too Long",
+			query:      "?days=365",
+			expectCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+			userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+			userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID}, nil).Maybe()
+
+			if tc.expectCode == http.StatusOK {
+				start, end, err := parseDates(tc.start, tc.end, time.UTC)
+				assert.NoError(t, err)
+
+				day := time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC)
+				readings := []domain.Reading{
+					{
+						UserID: userObjectID,
+						Day:    day,
+						Readings: []domain.ReadingEntry{
+							{Time: day.Add(8 * time.Hour), Value: 100},
+							{Time: day.Add(8*time.Hour + 5*time.Minute), Value: 120},
+						},
+					},
+				}
+				readingsRepo.On("FetchReadings", mock.Anything, userID, start.AddDate(0, 0, -1), end.AddDate(0, 0, 1)).Return(readings, nil)
+			}
+
+			req, err := http.NewRequest("GET", fmt.Sprintf("/users/%s/agp%s", userID, tc.query), nil)
+			assert.NoError(t, err)
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, tc.expectCode, w.Code)
+
+			if tc.expectCode == http.StatusOK {
+				var response AGPResponse
+				err = json.NewDecoder(w.Body).Decode(&response)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.start, response.Start)
+				assert.Equal(t, tc.end, response.End)
+				assert.Len(t, response.Slots, tc.expectLen)
+				assert.Equal(t, "08:00", response.Slots[0].Time)
+			}
+		})
+	}
+}
@@ -2,7 +2,10 @@ package api
 
 import (
 	"encoding/json"
+	"glooko/internal/analytics"
+	"glooko/internal/auth"
 	"glooko/internal/domain"
+	"glooko/internal/events"
 	"glooko/internal/ports"
 	"net/http"
 	"sort"
@@ -10,24 +13,38 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
 type API struct {
-	log          *zap.SugaredLogger
-	userRepo     ports.UserRepository
-	deviceRepo   ports.DeviceRepository
-	readingsRepo ports.ReadingRepository
-	validate     *validator.Validate
+	log           *zap.SugaredLogger
+	userRepo      ports.UserRepository
+	deviceRepo    ports.DeviceRepository
+	readingsRepo  ports.ReadingRepository
+	eventRepo     ports.EventRepository
+	detector      *events.Detector
+	auditRepo     ports.AuditRepository
+	validate      *validator.Validate
+	authenticator *auth.Authenticator
+	idempotency   *idempotencyCache
 }
 
-func NewAPI(log *zap.SugaredLogger, userRepo ports.UserRepository, deviceRepo ports.DeviceRepository, readingsRepo ports.ReadingRepository) *API {
+func NewAPI(log *zap.SugaredLogger, userRepo ports.UserRepository, deviceRepo ports.DeviceRepository, readingsRepo ports.ReadingRepository, eventRepo ports.EventRepository, auditRepo ports.AuditRepository, authenticator *auth.Authenticator) *API {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(jsonFieldName)
+
 	return &API{
-		log:          log,
-		userRepo:     userRepo,
-		deviceRepo:   deviceRepo,
-		readingsRepo: readingsRepo,
-		validate:     validator.New(),
+		log:           log,
+		userRepo:      userRepo,
+		deviceRepo:    deviceRepo,
+		readingsRepo:  readingsRepo,
+		eventRepo:     eventRepo,
+		detector:      events.NewDetector(readingsRepo, eventRepo),
+		auditRepo:     auditRepo,
+		validate:      validate,
+		authenticator: authenticator,
+		idempotency:   newIdempotencyCache(),
 	}
 }
 
@@ -42,10 +59,55 @@ func (api *API) Routes() *chi.Mux {
 		respondWithJSON(w, "Glooko API")
 	})
 
+	// FHIR R4 routes for partner EHRs
+	r.Route("/fhir", func(r chi.Router) {
+		r.Use(api.AuthMiddleware)
+		r.Use(api.AuditMiddleware)
+		r.Get("/Patient/{id}", api.GetFHIRPatient)
+		r.Get("/Observation", api.SearchFHIRObservations)
+		r.Get("/Observation/{observationId}", api.GetFHIRObservation)
+	})
+
+	// Nightscout compatible routes, one site per user
+	r.Route("/nightscout/{id}/api/v1", api.nightscoutRoutes)
+
+	// Audit trail of PHI accesses
+	r.Route("/audit", func(r chi.Router) {
+		r.Use(api.AuthMiddleware)
+		r.Get("/", api.ListAuditEntries)
+	})
+
 	// User routes
 	r.Route("/users", func(r chi.Router) {
-		r.Get("/{id}/overview", api.GetUserOverview)
-		r.Get("/{id}/devices-overview", api.GetDevicesOverview)
+		r.Use(api.AuthMiddleware)
+		r.Get("/", api.ListUsers)
+		r.Post("/", api.CreateUser)
+		r.Group(func(r chi.Router) {
+			r.Use(api.AuditMiddleware)
+			r.Use(api.UserPolicyMiddleware)
+			r.Get("/{id}", api.GetUser)
+			r.Patch("/{id}", api.UpdateUser)
+			r.Delete("/{id}", api.DeleteUser)
+			r.Get("/{id}/overview", api.GetUserOverview)
+			r.Get("/{id}/devices-overview", api.GetDevicesOverview)
+			r.Get("/{id}/statistics", api.GetStatistics)
+			r.Get("/{id}/agp", api.GetAGP)
+			r.Get("/{id}/events", api.GetEvents)
+			r.Get("/{id}/readings", api.ExportReadings)
+			r.With(api.IdempotencyMiddleware).Post("/{id}/readings", api.AddReadingsBatch)
+			r.Get("/{id}/readings.csv", api.ExportReadingsCSV)
+			r.With(api.IdempotencyMiddleware).Post("/{id}/imports", api.ImportReadings)
+			r.Post("/{id}/nightscout-secret", api.RotateNightscoutSecret)
+			r.Delete("/{id}/nightscout-secret", api.DeleteNightscoutSecret)
+			r.Get("/{id}/devices", api.ListDevices)
+			r.Post("/{id}/devices", api.CreateDevice)
+			r.Get("/{id}/devices/{deviceId}", api.GetDevice)
+			r.Patch("/{id}/devices/{deviceId}", api.UpdateDevice)
+			r.Delete("/{id}/devices/{deviceId}", api.DeleteDevice)
+			r.Post("/{id}/devices/{deviceId}/retire", api.RetireDevice)
+			r.Post("/{id}/devices/{deviceId}/replace", api.ReplaceDevice)
+			r.With(api.IdempotencyMiddleware).Post("/{id}/devices/{deviceId}/readings", api.AddReadings)
+		})
 	})
 
 	return r
@@ -60,14 +122,32 @@ type UserOverviewParams struct {
 // Measure represents a single glucose measurment.
 type Measure struct {
 	Time  time.Time `json:"time"`
-	Value int       `json:"value"`
+	Value float64   `json:"value"`
+}
+
+// GlucoseRange holds the target range thresholds in the unit of the response.
+type GlucoseRange struct {
+	VeryLow  float64 `json:"veryLow"`
+	Low      float64 `json:"low"`
+	High     float64 `json:"high"`
+	VeryHigh float64 `json:"veryHigh"`
+}
+
+// TimeInRange holds the percentage of readings in each glucose band.
+type TimeInRange struct {
+	VeryLow  float64 `json:"veryLow"`
+	Low      float64 `json:"low"`
+	InRange  float64 `json:"inRange"`
+	High     float64 `json:"high"`
+	VeryHigh float64 `json:"veryHigh"`
 }
 
 // DailyMetrics holds aggregated metrics for a day.
 type DailyMetrics struct {
-	MinValue int     `json:"minValue"`
-	MaxValue int     `json:"maxValue"`
-	AvgValue float64 `json:"avgValue"`
+	MinValue    float64     `json:"minValue"`
+	MaxValue    float64     `json:"maxValue"`
+	AvgValue    float64     `json:"avgValue"`
+	TimeInRange TimeInRange `json:"timeInRange"`
 }
 
 // DailyReadings contains all readings for a specific day along with calculated metrics.
@@ -80,13 +160,19 @@ type DailyReadings struct {
 
 // DailyReadingsResponse holds the response data for the user overview.
 type UserOverviewResponse struct {
-	Overview []DailyReadings `json:"overview"`
+	Unit        string          `json:"unit"` // Unit of all glucose values in the response
+	Overview    []DailyReadings `json:"overview"`
+	TargetRange GlucoseRange    `json:"targetRange"`
+	TimeInRange TimeInRange     `json:"timeInRange"` // Time in range over the whole requested window
+	Summary     Statistics      `json:"summary"`     // Variability statistics over the whole requested window
 }
 
 // DeviceCount represents the count of readings for a specific device on a given day.
+// Status tells a retired or replaced device apart from one that stopped uploading.
 type DeviceCount struct {
 	DeviceID string `json:"deviceId"`
 	Count    int    `json:"count"`
+	Status   string `json:"status,omitempty"`
 }
 
 // DayDeviceCounts aggregates the readings count for multiple devices on a specific day.
@@ -107,28 +193,51 @@ func (api *API) GetUserOverview(w http.ResponseWriter, r *http.Request) {
 	err := api.validate.Struct(params)
 	if err != nil {
 		log.Errorf("validation error: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respondWithError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, loc, err := api.findUserWithLocation(ctx, params.ID)
+	if err != nil {
+		log.Errorf("failed to fetch user: %v", err)
+		respondWithError(w, r, err)
 		return
 	}
 
-	start, end, err := parseDates(params.Start, params.End)
+	unit, err := resolveUnit(r, user)
+	if err != nil {
+		log.Errorf("invalid units: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	start, end, err := parseDates(params.Start, params.End, loc)
 	if err != nil {
 		log.Errorf("invalid date range: %v", err)
-		http.Error(w, "Invalid date range: "+err.Error(), http.StatusBadRequest)
+		respondWithError(w, r, err)
 		return
 	}
 
-	ctx := r.Context()
-	readings, err := api.readingsRepo.FetchReadings(ctx, params.ID, start, end)
+	fetchStart, fetchEnd := bucketRange(start, end)
+	readings, err := api.readingsRepo.FetchReadings(ctx, params.ID, fetchStart, fetchEnd)
 	if err != nil {
 		log.Errorf("failed to fetch readings: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondWithError(w, r, err)
 		return
 	}
 
-	aggregatedData := aggregateReadings(readings)
+	targets := user.Targets()
+	aggregatedData := aggregateReadings(readings, loc, start, end, targets)
+	timeInRange := analytics.ComputeTimeInRange(windowValues(aggregatedData), targets)
+	summary := analytics.ComputeStatistics(windowEntries(aggregatedData))
+
 	respondWithJSON(w, UserOverviewResponse{
-		Overview: aggregatedData,
+		Unit:        string(unit),
+		Overview:    convertDailyReadings(aggregatedData, unit),
+		TargetRange: toGlucoseRange(targets, unit),
+		TimeInRange: toTimeInRange(timeInRange),
+		Summary:     toStatistics(summary, unit),
 	})
 }
 
@@ -139,17 +248,29 @@ func (api *API) GetDevicesOverview(w http.ResponseWriter, r *http.Request) {
 	err := api.validate.Var(userID, "required")
 	if err != nil {
 		api.log.Errorf("validation error: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respondWithError(w, r, err)
 		return
 	}
 
 	results, err := api.readingsRepo.FetchDevicesOverview(ctx, userID, 30) // Last 30 days
 	if err != nil {
 		api.log.Errorf("Failed to fetch device overview: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondWithError(w, r, err)
+		return
+	}
+
+	devices, err := api.deviceRepo.FindByUser(ctx, userID)
+	if err != nil {
+		api.log.Errorf("Failed to fetch devices: %v", err)
+		respondWithError(w, r, err)
 		return
 	}
 
+	statuses := make(map[string]string, len(devices))
+	for _, device := range devices {
+		statuses[device.ID.Hex()] = string(device.Lifecycle())
+	}
+
 	// Map domain results to response struct
 	response := make([]DayDeviceCounts, len(results))
 	for i, dayCounts := range results {
@@ -158,6 +279,7 @@ func (api *API) GetDevicesOverview(w http.ResponseWriter, r *http.Request) {
 			deviceCounts[j] = DeviceCount{
 				DeviceID: device.DeviceID,
 				Count:    device.Count,
+				Status:   statuses[device.DeviceID],
 			}
 		}
 
@@ -179,76 +301,107 @@ func respondWithJSON(w http.ResponseWriter, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
+// respondWithStatus writes data as JSON with a non-default status code.
+func respondWithStatus(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
 // parseDates parses start and end date strings and ensures the date range includes
-// the full day from 00:00:00 of the start day to 23:59:59 of the end day.
-func parseDates(startStr, endStr string) (start, end time.Time, err error) {
+// the full day from 00:00:00 of the start day to 23:59:59 of the end day. Dates are
+// calendar days in loc, returned as the day keys produced by domain.DayOf. Malformed
+// dates and a start after the end are reported as domain.ErrInvalidRange.
+func parseDates(startStr, endStr string, loc *time.Location) (start, end time.Time, err error) {
+	today := domain.DayOf(time.Now().In(loc))
+
 	if startStr != "" {
 		start, err = time.Parse("2006-01-02", startStr)
 		if err != nil {
+			err = invalidRange("start date", err)
 			return
 		}
-		start = start.Truncate(24 * time.Hour) // Ensure time is at 00:00:00
 	} else {
 		// Default to the last 14 days, starting from 00:00:00
-		start = time.Now().Truncate(24*time.Hour).AddDate(0, 0, -14)
+		start = today.AddDate(0, 0, -14)
 	}
 
 	if endStr != "" {
 		end, err = time.Parse("2006-01-02", endStr)
 		if err != nil {
+			err = invalidRange("end date", err)
 			return
 		}
-		// Set to end of the day by adding one full day minus one nanosecond
-		end = end.Truncate(24 * time.Hour).Add(24*time.Hour - time.Nanosecond)
 	} else {
-		// Default to the current date, ending at 23:59:59
-		end = time.Now().Truncate(24 * time.Hour).Add(24*time.Hour - time.Nanosecond)
+		// Default to the current date
+		end = today
+	}
+
+	if start.After(end) {
+		err = errors.Wrapf(domain.ErrInvalidRange, "start %s is after end %s", start.Format("2006-01-02"), end.Format("2006-01-02"))
+		return
 	}
 
+	// Set to end of the day by adding one full day minus one nanosecond
+	end = end.Add(24*time.Hour - time.Nanosecond)
+
 	return
 }
 
-func aggregateReadings(readings []domain.Reading) []DailyReadings {
+// bucketRange returns the bucket days to fetch for the readings of the local days start to end.
+// Buckets stored before readings were keyed by the patient's local day, or before the patient
+// changed time zone, hold readings of the neighbouring local days, so a day is added on each side.
+func bucketRange(start, end time.Time) (time.Time, time.Time) {
+	return start.AddDate(0, 0, -1), end.AddDate(0, 0, 1)
+}
+
+// aggregateReadings groups the readings of the local days start to end by their day in loc and
+// computes daily metrics, time in range uses targets. Entries are grouped by their own time rather
+// than their bucket's day, see bucketRange. Values are in mg/dL, see convertDailyReadings.
+func aggregateReadings(readings []domain.Reading, loc *time.Location, start, end time.Time, targets domain.TargetRange) []DailyReadings {
 	dailyReadingsMap := make(map[string]DailyReadings)
 
 	for _, reading := range readings {
-		dayKey := reading.Day.Format("2006-01-02") // Using a string date as the key
-		daily, exists := dailyReadingsMap[dayKey]
-		if !exists {
-			daily = DailyReadings{
-				UserID:  reading.UserID.Hex(),
-				Day:     dayKey,
-				Measure: []Measure{},
-				Metrics: DailyMetrics{},
-			}
-		}
-
 		for _, entry := range reading.Readings {
+			localTime := entry.Time.In(loc)
+
 			// Only append if the entry is in the date range
-			if entry.Time.Format("2006-01-02") != dayKey {
+			day := domain.DayOf(localTime)
+			if day.Before(start) || day.After(end) {
 				continue
 			}
 
+			dayKey := day.Format("2006-01-02") // Using a string date as the key
+			daily, exists := dailyReadingsMap[dayKey]
+			if !exists {
+				daily = DailyReadings{
+					UserID:  reading.UserID.Hex(),
+					Day:     dayKey,
+					Measure: []Measure{},
+					Metrics: DailyMetrics{},
+				}
+			}
+
 			daily.Measure = append(daily.Measure, Measure{
-				Time:  entry.Time,
-				Value: entry.Value,
+				Time:  localTime,
+				Value: float64(entry.Value),
 			})
+			dailyReadingsMap[dayKey] = daily
 		}
-
-		// Update the map after appending
-		dailyReadingsMap[dayKey] = daily
 	}
 
 	// Recalculate metrics after all readings are processed for each day
 	for dayKey, daily := range dailyReadingsMap {
 		allValues := make([]int, len(daily.Measure))
 		for i, measure := range daily.Measure {
-			allValues[i] = measure.Value
+			allValues[i] = int(measure.Value)
 		}
 
 		if len(allValues) > 0 {
-			daily.Metrics.MinValue, daily.Metrics.MaxValue = minMax(allValues)
+			minValue, maxValue := minMax(allValues)
+			daily.Metrics.MinValue, daily.Metrics.MaxValue = float64(minValue), float64(maxValue)
 			daily.Metrics.AvgValue = average(allValues)
+			daily.Metrics.TimeInRange = toTimeInRange(analytics.ComputeTimeInRange(allValues, targets))
 			dailyReadingsMap[dayKey] = daily
 		}
 	}
@@ -266,6 +419,60 @@ func aggregateReadings(readings []domain.Reading) []DailyReadings {
 	return combinedReadings
 }
 
+// windowValues collects the values of all measures across the aggregated days.
+func windowValues(days []DailyReadings) []int {
+	var values []int
+	for _, daily := range days {
+		for _, measure := range daily.Measure {
+			values = append(values, int(measure.Value))
+		}
+	}
+	return values
+}
+
+// convertDailyReadings converts the mg/dL values produced by aggregateReadings to unit.
+func convertDailyReadings(days []DailyReadings, unit domain.GlucoseUnit) []DailyReadings {
+	for i := range days {
+		for j, measure := range days[i].Measure {
+			days[i].Measure[j].Value = unit.Round(unit.FromMgDL(measure.Value))
+		}
+		metrics := &days[i].Metrics
+		metrics.MinValue = unit.Round(unit.FromMgDL(metrics.MinValue))
+		metrics.MaxValue = unit.Round(unit.FromMgDL(metrics.MaxValue))
+		metrics.AvgValue = unit.RoundDerived(unit.FromMgDL(metrics.AvgValue))
+	}
+	return days
+}
+
+func toGlucoseRange(t domain.TargetRange, unit domain.GlucoseUnit) GlucoseRange {
+	return GlucoseRange{
+		VeryLow:  unit.Round(unit.FromMgDL(float64(t.VeryLow))),
+		Low:      unit.Round(unit.FromMgDL(float64(t.Low))),
+		High:     unit.Round(unit.FromMgDL(float64(t.High))),
+		VeryHigh: unit.Round(unit.FromMgDL(float64(t.VeryHigh))),
+	}
+}
+
+// resolveUnit picks the unit of a response, the units query parameter wins over the
+// user's preference.
+func resolveUnit(r *http.Request, user domain.User) (domain.GlucoseUnit, error) {
+	units := r.URL.Query().Get("units")
+	if units == "" {
+		return user.PreferredUnit(), nil
+	}
+	return domain.ParseGlucoseUnit(units)
+}
+
+func toTimeInRange(tir analytics.TimeInRange) TimeInRange {
+	return TimeInRange{
+		VeryLow:  tir.VeryLow,
+		Low:      tir.Low,
+		InRange:  tir.InRange,
+		High:     tir.High,
+		VeryHigh: tir.VeryHigh,
+	}
+}
+
 func minMax(values []int) (min, max int) {
 	min, max = values[0], values[0]
 	for _, v := range values {
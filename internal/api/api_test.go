@@ -4,14 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"net/http/httptest"
 	"testing"
 	"time"
 
+	"glooko/internal/auth"
 	"glooko/internal/domain"
 	"glooko/internal/mocks"
 
-	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -25,16 +25,40 @@ func setupAPI() *API {
 	userRepo := new(mocks.UserRepository)
 	deviceRepo := new(mocks.DeviceRepository)
 	readingsRepo := new(mocks.ReadingRepository)
+	eventRepo := new(mocks.EventRepository)
+	auditRepo := new(mocks.AuditRepository)
+	auditRepo.On("Record", mock.Anything, mock.Anything).Return(nil).Maybe()
 
-	return NewAPI(log, userRepo, deviceRepo, readingsRepo)
+	authenticator, _ := auth.NewAuthenticator(auth.Config{HMACSecret: testJWTSecret})
+
+	return NewAPI(log, userRepo, deviceRepo, readingsRepo, eventRepo, auditRepo, authenticator)
+}
+
+// testJWTSecret signs the bearer tokens of test requests.
+const testJWTSecret = "test-jwt-secret-0123456789abcdef"
+
+// testToken returns a bearer token for subject signed with testJWTSecret.
+func testToken(subject string, role auth.Role, queues ...string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Role:   role,
+		Queues: queues,
+	})
+	signed, _ := token.SignedString([]byte(testJWTSecret))
+	return signed
 }
 
 func TestGetUserOverview(t *testing.T) {
 	apiInstance := setupAPI()
 	readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
 
 	userID := "1234567890abcdef12345678"
 	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID}, nil)
 
 	testCases := []struct {
 		name        string
@@ -52,7 +76,7 @@ func TestGetUserOverview(t *testing.T) {
 			start:  "2006-04-06",
 			end:    "2006-04-20",
 			setupMock: func() {
-				start, end, _ := parseDates("2006-04-06", "2006-04-20")
+				start, end, _ := parseDates("2006-04-06", "2006-04-20", time.UTC)
 				readings := []domain.Reading{
 					{
 						UserID: userObjectID,
@@ -66,7 +90,7 @@ func TestGetUserOverview(t *testing.T) {
 						AvgValue: 102.5,
 					},
 				}
-				readingsRepo.On("FetchReadings", mock.Anything, userID, start, end).Return(readings, nil)
+				readingsRepo.On("FetchReadings", mock.Anything, userID, start.AddDate(0, 0, -1), end.AddDate(0, 0, 1)).Return(readings, nil)
 			},
 			expectCode:  http.StatusOK,
 			expectLen:   1,
@@ -87,8 +111,8 @@ func TestGetUserOverview(t *testing.T) {
 			start:  "2006-04-01",
 			end:    "2006-04-05",
 			setupMock: func() {
-				start, end, _ := parseDates("2006-04-01", "2006-04-05")
-				readingsRepo.On("FetchReadings", mock.Anything, userID, start, end).Return([]domain.Reading{}, nil)
+				start, end, _ := parseDates("2006-04-01", "2006-04-05", time.UTC)
+				readingsRepo.On("FetchReadings", mock.Anything, userID, start.AddDate(0, 0, -1), end.AddDate(0, 0, 1)).Return([]domain.Reading{}, nil)
 			},
 			expectCode:  http.StatusOK,
 			expectLen:   0,
@@ -105,10 +129,7 @@ func TestGetUserOverview(t *testing.T) {
 			req, err := http.NewRequest("GET", url, nil)
 			assert.NoError(t, err)
 
-			w := httptest.NewRecorder()
-			r := chi.NewRouter()
-			r.Mount("/", apiInstance.Routes())
-			r.ServeHTTP(w, req)
+			w := serve(apiInstance, req)
 
 			assert.Equal(t, tc.expectCode, w.Code)
 
@@ -125,12 +146,14 @@ func TestGetUserOverview(t *testing.T) {
 func TestGetUserOverview_MultipleDevices(t *testing.T) {
 	apiInstance := setupAPI()
 	readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository) // Cast to mocked type
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
 
 	userID := "1234567890abcdef12345678"
 	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID}, nil)
 
 	// Set up dates
-	start, end, err := parseDates("2006-04-06", "2006-04-20")
+	start, end, err := parseDates("2006-04-06", "2006-04-20", time.UTC)
 	assert.NoError(t, err)
 
 	readings := []domain.Reading{
@@ -153,7 +176,7 @@ func TestGetUserOverview_MultipleDevices(t *testing.T) {
 			Readings: []domain.ReadingEntry{
 				{Time: start.Add(10 * time.Hour), Value: 110},
 				{Time: start.Add(11 * time.Hour), Value: 115},
-				{Time: start.Add(25 * time.Hour), Value: 115}, // next day
+				{Time: start.Add(25 * time.Hour), Value: 115}, // Stored with the previous day, reported on its own
 			},
 			MinValue: 110,
 			MaxValue: 115,
@@ -161,16 +184,13 @@ func TestGetUserOverview_MultipleDevices(t *testing.T) {
 		},
 	}
 
-	readingsRepo.On("FetchReadings", mock.Anything, userID, start, end).Return(readings, nil)
+	readingsRepo.On("FetchReadings", mock.Anything, userID, start.AddDate(0, 0, -1), end.AddDate(0, 0, 1)).Return(readings, nil)
 
 	url := fmt.Sprintf("/users/%s/overview?start=%s&end=%s", userID, "2006-04-06", "2006-04-20")
 	req, err := http.NewRequest("GET", url, nil)
 	assert.NoError(t, err)
 
-	w := httptest.NewRecorder()
-	r := chi.NewRouter()
-	r.Mount("/", apiInstance.Routes())
-	r.ServeHTTP(w, req)
+	w := serve(apiInstance, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
@@ -178,19 +198,247 @@ func TestGetUserOverview_MultipleDevices(t *testing.T) {
 	err = json.NewDecoder(w.Body).Decode(&response)
 	assert.NoError(t, err)
 
-	assert.Len(t, response.Overview, 1)
+	assert.Len(t, response.Overview, 2)
 	assert.Equal(t, userID, response.Overview[0].UserID)
 	assert.Equal(t, 4, len(response.Overview[0].Measure))
-	assert.Equal(t, 100, response.Overview[0].Metrics.MinValue)
-	assert.Equal(t, 115, response.Overview[0].Metrics.MaxValue)
+	assert.Equal(t, 100.0, response.Overview[0].Metrics.MinValue)
+	assert.Equal(t, 115.0, response.Overview[0].Metrics.MaxValue)
 	assert.Equal(t, 107.5, response.Overview[0].Metrics.AvgValue)
+	assert.Equal(t, 100.0, response.Overview[0].Metrics.TimeInRange.InRange)
+	assert.Equal(t, "2006-04-07", response.Overview[1].Day)
+	assert.Equal(t, 1, len(response.Overview[1].Measure))
+	assert.Equal(t, 100.0, response.TimeInRange.InRange)
+	assert.Equal(t, 5, response.Summary.Count)
+	assert.Equal(t, 109.0, response.Summary.Mean)
+	assert.Equal(t, 70.0, response.TargetRange.Low)
+	assert.Equal(t, 180.0, response.TargetRange.High)
+	assert.Equal(t, "mg/dL", response.Unit)
+}
+
+func TestGetUserOverview_Timezone(t *testing.T) {
+	apiInstance := setupAPI()
+	readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	targets := domain.TargetRange{VeryLow: 54, Low: 70, High: 115, VeryHigh: 250}
+	userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID, Timezone: "America/Los_Angeles", TargetRange: &targets}, nil)
+
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	assert.NoError(t, err)
+
+	// 2024-03-10 is the spring forward day in Los Angeles, it only has 23 hours.
+	start, end, err := parseDates("2024-03-09", "2024-03-10", loc)
+	assert.NoError(t, err)
+
+	readings := []domain.Reading{
+		{
+			UserID: userObjectID,
+			Day:    time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC),
+			Readings: []domain.ReadingEntry{
+				{Time: time.Date(2024, 3, 10, 6, 30, 0, 0, time.UTC), Value: 100}, // 22:30 PST on the 9th
+			},
+		},
+		{
+			UserID: userObjectID,
+			Day:    time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC),
+			Readings: []domain.ReadingEntry{
+				{Time: time.Date(2024, 3, 10, 8, 30, 0, 0, time.UTC), Value: 110}, // 00:30 PST
+				{Time: time.Date(2024, 3, 11, 6, 30, 0, 0, time.UTC), Value: 120}, // 23:30 PDT
+			},
+		},
+	}
+	readingsRepo.On("FetchReadings", mock.Anything, userID, start.AddDate(0, 0, -1), end.AddDate(0, 0, 1)).Return(readings, nil)
+
+	url := fmt.Sprintf("/users/%s/overview?start=%s&end=%s", userID, "2024-03-09", "2024-03-10")
+	req, err := http.NewRequest("GET", url, nil)
+	assert.NoError(t, err)
+
+	w := serve(apiInstance, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response UserOverviewResponse
+	err = json.NewDecoder(w.Body).Decode(&response)
+	assert.NoError(t, err)
+
+	assert.Len(t, response.Overview, 2)
+	assert.Equal(t, "2024-03-09", response.Overview[0].Day)
+	assert.Len(t, response.Overview[0].Measure, 1)
+	assert.Equal(t, "2024-03-10", response.Overview[1].Day)
+	assert.Len(t, response.Overview[1].Measure, 2)
+	assert.Equal(t, 115.0, response.Overview[1].Metrics.AvgValue)
+	assert.Equal(t, TimeInRange{InRange: 50, High: 50}, response.Overview[1].Metrics.TimeInRange)
+	assert.Equal(t, TimeInRange{InRange: 66.7, High: 33.3}, response.TimeInRange)
+}
+
+func TestGetUserOverview_LegacyBuckets(t *testing.T) {
+	apiInstance := setupAPI()
+	readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID, Timezone: "America/Los_Angeles"}, nil)
+
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	assert.NoError(t, err)
+
+	start, end, err := parseDates("2024-04-06", "2024-04-06", loc)
+	assert.NoError(t, err)
+
+	// Bucket keyed by the UTC day, from before readings were bucketed by the patient's local day.
+	readings := []domain.Reading{
+		{
+			UserID: userObjectID,
+			Day:    time.Date(2024, 4, 7, 0, 0, 0, 0, time.UTC),
+			Readings: []domain.ReadingEntry{
+				{Time: time.Date(2024, 4, 7, 3, 0, 0, 0, time.UTC), Value: 150},  // 20:00 PDT on the 6th
+				{Time: time.Date(2024, 4, 7, 10, 0, 0, 0, time.UTC), Value: 200}, // 03:00 PDT on the 7th
+			},
+		},
+	}
+	readingsRepo.On("FetchReadings", mock.Anything, userID, start.AddDate(0, 0, -1), end.AddDate(0, 0, 1)).Return(readings, nil)
+
+	url := fmt.Sprintf("/users/%s/overview?start=%s&end=%s", userID, "2024-04-06", "2024-04-06")
+	req, err := http.NewRequest("GET", url, nil)
+	assert.NoError(t, err)
+
+	w := serve(apiInstance, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response UserOverviewResponse
+	err = json.NewDecoder(w.Body).Decode(&response)
+	assert.NoError(t, err)
+
+	assert.Len(t, response.Overview, 1)
+	assert.Equal(t, "2024-04-06", response.Overview[0].Day)
+	assert.Len(t, response.Overview[0].Measure, 1)
+	assert.Equal(t, 150.0, response.Overview[0].Metrics.AvgValue)
+	assert.Equal(t, 1, response.Summary.Count)
+}
+
+func TestGetUserOverview_Units(t *testing.T) {
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+
+	testCases := []struct {
+		name       string
+		user       domain.User
+		query      string
+		expectCode int
+		expectUnit string
+		expectMin  float64
+		expectAvg  float64
+		expectLow  float64
+	}{
+		{
+			name:       "Query Parameter",
+			user:       domain.User{ID: userObjectID},
+			query:      "&units=mmol",
+			expectCode: http.StatusOK,
+			expectUnit: "mmol/L",
+			expectMin:  5.5,
+			expectAvg:  5.83,
+			expectLow:  3.9,
+		},
+		{
+			name:       "User Preference",
+			user:       domain.User{ID: userObjectID, Unit: domain.MmolL},
+			expectCode: http.StatusOK,
+			expectUnit: "mmol/L",
+			expectMin:  5.5,
+			expectAvg:  5.83,
+			expectLow:  3.9,
+		},
+		{
+			name:       "Query Parameter Overrides Preference",
+			user:       domain.User{ID: userObjectID, Unit: domain.MmolL},
+			query:      "&units=mg/dL",
+			expectCode: http.StatusOK,
+			expectUnit: "mg/dL",
+			expectMin:  99,
+			expectAvg:  105,
+			expectLow:  70,
+		},
+		{
+			name:       "Unknown Unit",
+			user:       domain.User{ID: userObjectID},
+			query:      "&units=g/L",
+			expectCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+			userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+			userRepo.On("FindByID", mock.Anything, userID).Return(tc.user, nil)
+
+			start, end, err := parseDates("2024-04-06", "2024-04-06", time.UTC)
+			assert.NoError(t, err)
+
+			readings := []domain.Reading{
+				{
+					UserID: userObjectID,
+					Day:    start,
+					Readings: []domain.ReadingEntry{
+						{Time: start.Add(8 * time.Hour), Value: 99},
+						{Time: start.Add(9 * time.Hour), Value: 108},
+						{Time: start.Add(10 * time.Hour), Value: 108},
+					},
+				},
+			}
+			readingsRepo.On("FetchReadings", mock.Anything, userID, start.AddDate(0, 0, -1), end.AddDate(0, 0, 1)).Return(readings, nil).Maybe()
+
+			url := fmt.Sprintf("/users/%s/overview?start=2024-04-06&end=2024-04-06%s", userID, tc.query)
+			req, err := http.NewRequest("GET", url, nil)
+			assert.NoError(t, err)
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, tc.expectCode, w.Code)
+
+			if tc.expectCode == http.StatusOK {
+				var response UserOverviewResponse
+				err = json.NewDecoder(w.Body).Decode(&response)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectUnit, response.Unit)
+				assert.Equal(t, tc.expectMin, response.Overview[0].Measure[0].Value)
+				assert.Equal(t, tc.expectMin, response.Overview[0].Metrics.MinValue)
+				assert.Equal(t, tc.expectAvg, response.Overview[0].Metrics.AvgValue)
+				assert.Equal(t, tc.expectAvg, response.Summary.Mean)
+				assert.Equal(t, tc.expectLow, response.TargetRange.Low)
+				assert.Equal(t, 100.0, response.TimeInRange.InRange)
+			}
+		})
+	}
+}
+
+func TestParseDates(t *testing.T) {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	assert.NoError(t, err)
+
+	start, end, err := parseDates("2024-03-10", "2024-03-10", loc)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond), end)
+
+	// The bucket key of a late evening reading is the patient's local day
+	evening := time.Date(2024, 3, 11, 6, 30, 0, 0, time.UTC).In(loc)
+	assert.Equal(t, start, domain.DayOf(evening))
 }
 
 func TestGetDevicesOverview(t *testing.T) {
 	apiInstance := setupAPI()
 	readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+	deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
 
 	userID := "1234567890abcdef12345678"
+	activeDevice := primitive.NewObjectID()
+	retiredDevice := primitive.NewObjectID()
 
 	testCases := []struct {
 		name        string
@@ -211,12 +459,17 @@ func TestGetDevicesOverview(t *testing.T) {
 					{
 						Day: start,
 						Devices: []domain.DeviceCount{
-							{DeviceID: "device1", Count: 10},
-							{DeviceID: "device2", Count: 15},
+							{DeviceID: activeDevice.Hex(), Count: 10},
+							{DeviceID: retiredDevice.Hex(), Count: 15},
 						},
 					},
 				}
+				devices := []domain.Device{
+					{ID: activeDevice, Status: domain.DeviceActive},
+					{ID: retiredDevice, Status: domain.DeviceRetired},
+				}
 				readingsRepo.On("FetchDevicesOverview", mock.Anything, userID, 30).Return(deviceOverviews, nil)
+				deviceRepo.On("FindByUser", mock.Anything, userID).Return(devices, nil)
 			},
 			expectCode:  http.StatusOK,
 			expectLen:   1,
@@ -232,10 +485,7 @@ func TestGetDevicesOverview(t *testing.T) {
 			req, err := http.NewRequest("GET", url, nil)
 			assert.NoError(t, err)
 
-			w := httptest.NewRecorder()
-			r := chi.NewRouter()
-			r.Mount("/", apiInstance.Routes())
-			r.ServeHTTP(w, req)
+			w := serve(apiInstance, req)
 
 			assert.Equal(t, tc.expectCode, w.Code)
 
@@ -244,6 +494,13 @@ func TestGetDevicesOverview(t *testing.T) {
 				err = json.NewDecoder(w.Body).Decode(&response)
 				assert.NoError(t, err)
 				assert.Len(t, response, tc.expectLen)
+
+				statuses := map[string]string{}
+				for _, device := range response[0].Devices {
+					statuses[device.DeviceID] = device.Status
+				}
+				assert.Equal(t, "active", statuses[activeDevice.Hex()])
+				assert.Equal(t, "retired", statuses[retiredDevice.Hex()])
 			}
 		})
 	}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"glooko/internal/auth"
+	"glooko/internal/domain"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultAuditLimit is the page size used when the audit listing does not specify one.
+const defaultAuditLimit = 100
+
+// nightscoutActor is recorded as the actor of Nightscout requests, which carry the site's secret
+// instead of a bearer token. Authenticated requests record the site, nightscout:{id}.
+const nightscoutActor = "nightscout"
+
+// redactedParameters are query parameters never written to the audit trail.
+var redactedParameters = []string{"secret", "access_token"}
+
+// AuditEntryResponse is the API representation of an audit entry.
+type AuditEntryResponse struct {
+	ID         string              `json:"id"`
+	Time       time.Time           `json:"time"`
+	Actor      string              `json:"actor"`
+	ActorRole  string              `json:"actorRole,omitempty"`
+	Subject    string              `json:"subject"`
+	Method     string              `json:"method"`
+	Endpoint   string              `json:"endpoint"`
+	Parameters map[string][]string `json:"parameters,omitempty"`
+	Status     int                 `json:"status"`
+	Outcome    string              `json:"outcome"`
+}
+
+// AuditListResponse holds a single page of the audit trail.
+type AuditListResponse struct {
+	Entries []AuditEntryResponse `json:"entries"`
+	Total   int64                `json:"total"`
+	Limit   int                  `json:"limit"`
+	Offset  int                  `json:"offset"`
+}
+
+type ListAuditParams struct {
+	Actor   string
+	Subject string `validate:"omitempty,mongodb"`
+	From    string `validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	To      string `validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Limit   int    `validate:"min=1,max=1000"`
+	Offset  int    `validate:"min=0"`
+}
+
+// auditDetails holds what handlers and middlewares resolved for the audit entry of a request.
+type auditDetails struct {
+	subject string
+	actor   string
+}
+
+// auditDetailsKey holds the request's *auditDetails in the request context.
+type auditDetailsKey struct{}
+
+// setAuditSubject names the patient of the request's audit entry, for routes whose URL identifies
+// another resource of the patient.
+func setAuditSubject(r *http.Request, subject string) {
+	if details, ok := r.Context().Value(auditDetailsKey{}).(*auditDetails); ok {
+		details.subject = subject
+	}
+}
+
+// setAuditActor names the caller of the request's audit entry, for callers authenticated without
+// a bearer token.
+func setAuditActor(r *http.Request, actor string) {
+	if details, ok := r.Context().Value(auditDetailsKey{}).(*auditDetails); ok {
+		details.actor = actor
+	}
+}
+
+// AuditMiddleware records every request for a patient's data, including denied ones, in the audit
+// trail. The patient is the id URL parameter, for FHIR searches the patient query parameter and
+// otherwise the one the handler named with setAuditSubject. A failure to record is logged and does
+// not fail the already served request.
+func (api *API) AuditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := NewWrapResponseWriter(w, r.ProtoMajor)
+		details := &auditDetails{}
+		r = r.WithContext(context.WithValue(r.Context(), auditDetailsKey{}, details))
+
+		// Handlers abort responses they already started with a panic, the access is recorded anyway
+		defer func() {
+			aborted := recover()
+
+			// The route is only resolved once the request went through the router
+			entry := domain.AuditEntry{
+				Time:       time.Now().UTC(),
+				Actor:      nightscoutActor,
+				Subject:    chi.URLParam(r, "id"),
+				Method:     r.Method,
+				Endpoint:   chi.RouteContext(r.Context()).RoutePattern(),
+				Parameters: auditParameters(r),
+				Status:     ww.Status(),
+				Outcome:    auditOutcome(ww.Status()),
+			}
+			if aborted != nil {
+				entry.Outcome = domain.AuditFailure
+			}
+			if details.actor != "" {
+				entry.Actor = details.actor
+			}
+			if principal, ok := auth.PrincipalFrom(r.Context()); ok {
+				entry.Actor = principal.Subject
+				entry.ActorRole = string(principal.Role)
+			}
+			if entry.Subject == "" {
+				entry.Subject = strings.TrimPrefix(r.URL.Query().Get("patient"), "Patient/")
+			}
+			if entry.Subject == "" {
+				entry.Subject = details.subject
+			}
+
+			err := api.auditRepo.Record(context.WithoutCancel(r.Context()), entry)
+			if err != nil {
+				api.log.With("method", "AuditMiddleware").Errorf("failed to record audit entry %+v: %v", entry, err)
+			}
+
+			if aborted != nil {
+				panic(aborted)
+			}
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// ListAuditEntries returns the audit trail newest first, filtered by actor, subject and an RFC 3339
+// time range. Only admins may read it.
+func (api *API) ListAuditEntries(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "ListAuditEntries")
+
+	principal, _ := auth.PrincipalFrom(r.Context())
+	if principal.Role != auth.RoleAdmin {
+		log.Errorf("%s %s may not read the audit trail", principal.Role, principal.Subject)
+		respondWithError(w, r, auth.ErrForbidden)
+		return
+	}
+
+	limit, err := queryInt(r, "limit", defaultAuditLimit)
+	if err != nil {
+		log.Errorf("invalid limit: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		log.Errorf("invalid offset: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	params := ListAuditParams{
+		Actor:   r.URL.Query().Get("actor"),
+		Subject: r.URL.Query().Get("subject"),
+		From:    r.URL.Query().Get("from"),
+		To:      r.URL.Query().Get("to"),
+		Limit:   limit,
+		Offset:  offset,
+	}
+
+	err = api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	filter := domain.AuditFilter{
+		Actor:   params.Actor,
+		Subject: params.Subject,
+		Limit:   params.Limit,
+		Offset:  params.Offset,
+	}
+	if params.From != "" {
+		filter.From, _ = time.Parse(time.RFC3339, params.From)
+	}
+	if params.To != "" {
+		filter.To, _ = time.Parse(time.RFC3339, params.To)
+	}
+
+	entries, total, err := api.auditRepo.Find(r.Context(), filter)
+	if err != nil {
+		log.Errorf("failed to find audit entries: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	response := AuditListResponse{
+		Entries: make([]AuditEntryResponse, len(entries)),
+		Total:   total,
+		Limit:   params.Limit,
+		Offset:  params.Offset,
+	}
+	for i, entry := range entries {
+		response.Entries[i] = AuditEntryResponse{
+			ID:         entry.ID.Hex(),
+			Time:       entry.Time,
+			Actor:      entry.Actor,
+			ActorRole:  entry.ActorRole,
+			Subject:    entry.Subject,
+			Method:     entry.Method,
+			Endpoint:   entry.Endpoint,
+			Parameters: entry.Parameters,
+			Status:     entry.Status,
+			Outcome:    string(entry.Outcome),
+		}
+	}
+	respondWithJSON(w, response)
+}
+
+// auditParameters returns the query parameters of r without credentials.
+func auditParameters(r *http.Request) map[string][]string {
+	query := r.URL.Query()
+	for _, name := range redactedParameters {
+		query.Del(name)
+	}
+	if len(query) == 0 {
+		return nil
+	}
+	return query
+}
+
+func auditOutcome(status int) domain.AuditOutcome {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return domain.AuditDenied
+	case status >= http.StatusBadRequest:
+		return domain.AuditFailure
+	}
+	return domain.AuditSuccess
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"glooko/internal/auth"
+	"glooko/internal/domain"
+	"glooko/internal/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAuditMiddleware(t *testing.T) {
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	otherPatient := "abcdef1234567890abcdef12"
+
+	testCases := []struct {
+		name        string
+		path        string
+		token       string
+		secret      string
+		expectEntry domain.AuditEntry
+	}{
+		{
+			name:  "Success",
+			path:  "/users/" + userID + "/devices-overview?units=mmol%2FL",
+			token: testToken("admin-1", auth.RoleAdmin),
+			expectEntry: domain.AuditEntry{
+				Actor:      "admin-1",
+				ActorRole:  "admin",
+				Subject:    userID,
+				Method:     "GET",
+				Endpoint:   "/users/{id}/devices-overview",
+				Parameters: map[string][]string{"units": {"mmol/L"}},
+				Status:     http.StatusOK,
+				Outcome:    domain.AuditSuccess,
+			},
+		},
+		{
+			name:  "Denied",
+			path:  "/users/" + userID + "/devices-overview",
+			token: testToken(otherPatient, auth.RolePatient),
+			expectEntry: domain.AuditEntry{
+				Actor:     otherPatient,
+				ActorRole: "patient",
+				Subject:   userID,
+				Method:    "GET",
+				Endpoint:  "/users/{id}/devices-overview",
+				Status:    http.StatusForbidden,
+				Outcome:   domain.AuditDenied,
+			},
+		},
+		{
+			name:  "FHIR Search",
+			path:  "/fhir/Observation?patient=Patient/" + otherPatient,
+			token: testToken(userID, auth.RolePatient),
+			expectEntry: domain.AuditEntry{
+				Actor:      userID,
+				ActorRole:  "patient",
+				Subject:    otherPatient,
+				Method:     "GET",
+				Endpoint:   "/fhir/Observation",
+				Parameters: map[string][]string{"patient": {"Patient/" + otherPatient}},
+				Status:     http.StatusNotFound,
+				Outcome:    domain.AuditFailure,
+			},
+		},
+		{
+			name:   "Nightscout Site",
+			path:   "/nightscout/" + userID + "/api/v1/entries?count=5",
+			secret: nightscoutSecretHeader(nightscoutTestSecret),
+			expectEntry: domain.AuditEntry{
+				Actor:      "nightscout:" + userID,
+				Subject:    userID,
+				Method:     "GET",
+				Endpoint:   "/nightscout/{id}/api/v1/entries",
+				Parameters: map[string][]string{"count": {"5"}},
+				Status:     http.StatusOK,
+				Outcome:    domain.AuditSuccess,
+			},
+		},
+		{
+			name:   "Nightscout Wrong Secret",
+			path:   "/nightscout/" + userID + "/api/v1/entries",
+			secret: nightscoutSecretHeader("another-secret"),
+			expectEntry: domain.AuditEntry{
+				Actor:    "nightscout",
+				Subject:  userID,
+				Method:   "GET",
+				Endpoint: "/nightscout/{id}/api/v1/*", // Refused before the route was resolved
+				Status:   http.StatusUnauthorized,
+				Outcome:  domain.AuditDenied,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+			readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+			deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+			auditRepo := new(mocks.AuditRepository)
+			apiInstance.auditRepo = auditRepo
+
+			userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID, NightscoutSecretHash: nightscoutTestHash}, nil).Maybe()
+			userRepo.On("FindByID", mock.Anything, otherPatient).Return(domain.User{}, domain.ErrNotFound).Maybe()
+			readingsRepo.On("FetchDevicesOverview", mock.Anything, userID, 30).Return([]domain.DayDeviceCounts{}, nil).Maybe()
+			deviceRepo.On("FindByUser", mock.Anything, userID).Return([]domain.Device{}, nil).Maybe()
+			readingsRepo.On("FetchReadings", mock.Anything, userID, mock.Anything, mock.Anything).Return([]domain.Reading{}, nil).Maybe()
+
+			var recorded domain.AuditEntry
+			auditRepo.On("Record", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				recorded = args.Get(1).(domain.AuditEntry)
+			}).Return(nil).Once()
+
+			req, err := http.NewRequest("GET", tc.path, nil)
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			if tc.secret != "" {
+				req.Header.Set("api-secret", tc.secret)
+			}
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, tc.expectEntry.Status, w.Code)
+			auditRepo.AssertExpectations(t)
+
+			assert.WithinDuration(t, time.Now(), recorded.Time, time.Minute)
+			recorded.Time = time.Time{}
+			assert.Equal(t, tc.expectEntry, recorded)
+		})
+	}
+}
+
+func TestAuditMiddlewareRedactsSecrets(t *testing.T) {
+	req, err := http.NewRequest("GET", "/nightscout/1234567890abcdef12345678/api/v1/entries?count=5&secret=abc", nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string][]string{"count": {"5"}}, auditParameters(req))
+}
+
+func TestListAuditEntries(t *testing.T) {
+	entryID := primitive.NewObjectID()
+	entryTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name         string
+		query        string
+		token        string
+		expectFilter *domain.AuditFilter
+		expectCode   int
+	}{
+		{
+			name:         "By Actor",
+			query:        "?actor=clinician-1",
+			token:        testToken("admin-1", auth.RoleAdmin),
+			expectFilter: &domain.AuditFilter{Actor: "clinician-1", Limit: defaultAuditLimit},
+			expectCode:   http.StatusOK,
+		},
+		{
+			name:  "By Subject And Time",
+			query: "?subject=1234567890abcdef12345678&from=2024-03-01T00:00:00Z&to=2024-03-02T00:00:00%2B01:00&limit=10&offset=20",
+			token: testToken("admin-1", auth.RoleAdmin),
+			expectFilter: &domain.AuditFilter{
+				Subject: "1234567890abcdef12345678",
+				From:    time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+				To:      time.Date(2024, 3, 2, 0, 0, 0, 0, time.FixedZone("", 3600)),
+				Limit:   10,
+				Offset:  20,
+			},
+			expectCode: http.StatusOK,
+		},
+		{name: "Invalid From", query: "?from=yesterday", token: testToken("admin-1", auth.RoleAdmin), expectCode: http.StatusBadRequest},
+		{name: "Support", query: "", token: testToken("agent-1", auth.RoleSupport, "emea"), expectCode: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			auditRepo := new(mocks.AuditRepository)
+			apiInstance.auditRepo = auditRepo
+
+			if tc.expectFilter != nil {
+				auditRepo.On("Find", mock.Anything, mock.MatchedBy(func(filter domain.AuditFilter) bool {
+					return filter.Actor == tc.expectFilter.Actor && filter.Subject == tc.expectFilter.Subject &&
+						filter.From.Equal(tc.expectFilter.From) && filter.To.Equal(tc.expectFilter.To) &&
+						filter.Limit == tc.expectFilter.Limit && filter.Offset == tc.expectFilter.Offset
+				})).Return([]domain.AuditEntry{{ID: entryID, Time: entryTime, Actor: "clinician-1", Outcome: domain.AuditSuccess}}, int64(1), nil)
+			}
+
+			req, err := http.NewRequest("GET", "/audit"+tc.query, nil)
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, tc.expectCode, w.Code)
+			auditRepo.AssertExpectations(t)
+
+			if tc.expectCode == http.StatusOK {
+				var response AuditListResponse
+				assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+				assert.Equal(t, int64(1), response.Total)
+				assert.Equal(t, entryID.Hex(), response.Entries[0].ID)
+				assert.Equal(t, "success", response.Entries[0].Outcome)
+			}
+		})
+	}
+}
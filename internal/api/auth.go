@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"glooko/internal/auth"
+	"glooko/internal/domain"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AuthMiddleware rejects requests without a valid bearer token and stores the caller's
+// principal on the request context.
+func (api *API) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := api.authenticator.AuthenticateRequest(r)
+		if err != nil {
+			api.log.With("method", "AuthMiddleware").Errorf("failed to authenticate: %v", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="glooko"`)
+			respondWithError(w, r, auth.ErrUnauthenticated)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// UserPolicyMiddleware rejects requests for a user's data the caller is not entitled to, see auth.Authorize.
+// Reads are GET requests, deleting the user itself needs the delete action and anything else is a write.
+func (api *API) UserPolicyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := api.log.With("method", "UserPolicyMiddleware")
+		userID := chi.URLParam(r, "id")
+
+		err := api.validate.Var(userID, "required,mongodb")
+		if err != nil {
+			log.Errorf("validation error: %v", err)
+			respondWithError(w, r, err)
+			return
+		}
+
+		action := auth.ActionWrite
+		switch {
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+			action = auth.ActionRead
+		case r.Method == http.MethodDelete && chi.RouteContext(r.Context()).RoutePattern() == "/users/{id}":
+			action = auth.ActionDelete
+		}
+
+		err = api.authorizeUser(r.Context(), action, userID)
+		if err != nil {
+			log.Errorf("failed to authorize: %v", err)
+			respondWithError(w, r, err)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizeUser checks the caller may perform action on the data of the user with userID.
+func (api *API) authorizeUser(ctx context.Context, action auth.Action, userID string) error {
+	principal, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return auth.ErrUnauthenticated
+	}
+
+	// Admins are entitled to every user, so the user is only loaded for other roles
+	user := domain.User{}
+	if principal.Role != auth.RoleAdmin {
+		var err error
+		user, err = api.userRepo.FindByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return auth.Authorize(principal, action, user)
+}
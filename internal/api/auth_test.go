@@ -0,0 +1,128 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"glooko/internal/auth"
+	"glooko/internal/domain"
+	"glooko/internal/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	testCases := []struct {
+		name       string
+		path       string
+		header     string
+		expectCode int
+	}{
+		{name: "Home Is Public", path: "/", expectCode: http.StatusOK},
+		{name: "Users Without Token", path: "/users/1234567890abcdef12345678", expectCode: http.StatusUnauthorized},
+		{name: "Users With Invalid Token", path: "/users/1234567890abcdef12345678", header: "Bearer invalid", expectCode: http.StatusUnauthorized},
+		{name: "FHIR Without Token", path: "/fhir/Patient/1234567890abcdef12345678", expectCode: http.StatusUnauthorized},
+		{name: "Users With Token", path: "/users/123", header: "Bearer " + testToken("user-1", auth.RoleAdmin), expectCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+
+			req, err := http.NewRequest("GET", tc.path, nil)
+			assert.NoError(t, err)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+
+			w := httptest.NewRecorder()
+			apiInstance.Routes().ServeHTTP(w, req)
+
+			assert.Equal(t, tc.expectCode, w.Code)
+			if tc.expectCode == http.StatusUnauthorized {
+				assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewarePrincipal(t *testing.T) {
+	apiInstance := setupAPI()
+
+	var principal auth.Principal
+	handler := apiInstance.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = auth.PrincipalFrom(r.Context())
+	}))
+
+	req, err := http.NewRequest("GET", "/users", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+testToken("user-1", auth.RoleAdmin))
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "user-1", principal.Subject)
+}
+
+func TestUserPolicy(t *testing.T) {
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	user := domain.User{ID: userObjectID, SupportQueue: "emea", CareTeam: []string{"clinician-1", "caregiver-1"}}
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		token      string
+		userErr    error
+		expectCode int
+	}{
+		{name: "Patient Reads Own Data", method: "GET", path: "/users/" + userID, token: testToken(userID, auth.RolePatient), expectCode: http.StatusOK},
+		{name: "Patient Reads Other User", method: "GET", path: "/users/" + userID, token: testToken("abcdef1234567890abcdef12", auth.RolePatient), expectCode: http.StatusForbidden},
+		{name: "Patient Deletes Self", method: "DELETE", path: "/users/" + userID, token: testToken(userID, auth.RolePatient), expectCode: http.StatusForbidden},
+		{name: "Patient Changes Care Team", method: "PATCH", path: "/users/" + userID, body: `{"careTeam":["someone"]}`, token: testToken(userID, auth.RolePatient), expectCode: http.StatusForbidden},
+		{name: "Caregiver Reads", method: "GET", path: "/users/" + userID, token: testToken("caregiver-1", auth.RoleCaregiver), expectCode: http.StatusOK},
+		{name: "Caregiver Writes", method: "PATCH", path: "/users/" + userID, body: `{"firstName":"Jane"}`, token: testToken("caregiver-1", auth.RoleCaregiver), expectCode: http.StatusForbidden},
+		{name: "Clinician Off Care Team", method: "GET", path: "/users/" + userID, token: testToken("clinician-2", auth.RoleClinician), expectCode: http.StatusForbidden},
+		{name: "Support In Queue", method: "GET", path: "/users/" + userID, token: testToken("agent-1", auth.RoleSupport, "emea"), expectCode: http.StatusOK},
+		{name: "Support Other Queue", method: "GET", path: "/users/" + userID, token: testToken("agent-1", auth.RoleSupport, "apac"), expectCode: http.StatusForbidden},
+		{name: "Unknown User", method: "GET", path: "/users/" + userID, token: testToken(userID, auth.RolePatient), userErr: domain.ErrNotFound, expectCode: http.StatusNotFound},
+		{name: "Patient Lists Users", method: "GET", path: "/users", token: testToken(userID, auth.RolePatient), expectCode: http.StatusForbidden},
+		{name: "Clinician Creates User", method: "POST", path: "/users", body: `{}`, token: testToken("clinician-1", auth.RoleClinician), expectCode: http.StatusForbidden},
+		{name: "Caregiver FHIR Patient", method: "GET", path: "/fhir/Patient/" + userID, token: testToken("caregiver-1", auth.RoleCaregiver), expectCode: http.StatusOK},
+		{name: "Patient FHIR Other Patient", method: "GET", path: "/fhir/Patient/" + userID, token: testToken("abcdef1234567890abcdef12", auth.RolePatient), expectCode: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+			userRepo.On("FindByID", mock.Anything, userID).Return(user, tc.userErr).Maybe()
+
+			req, err := http.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, tc.expectCode, w.Code)
+		})
+	}
+}
+
+func TestListUsersRestrictedToSupportQueues(t *testing.T) {
+	apiInstance := setupAPI()
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+	userRepo.On("Find", mock.Anything, domain.UserFilter{SupportQueues: []string{"emea", "apac"}, Limit: defaultUsersLimit}).
+		Return([]domain.User{}, int64(0), nil)
+
+	req, err := http.NewRequest("GET", "/users", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+testToken("agent-1", auth.RoleSupport, "emea", "apac"))
+
+	w := serve(apiInstance, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	userRepo.AssertExpectations(t)
+}
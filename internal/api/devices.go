@@ -0,0 +1,438 @@
+package api
+
+import (
+	"encoding/json"
+	"glooko/internal/auth"
+	"glooko/internal/domain"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// errDeviceNotOwned is returned when a device exists but belongs to a different user.
+var errDeviceNotOwned = errors.Wrap(domain.ErrNotFound, "device does not belong to user")
+
+// DeviceResponse is the API representation of a device.
+type DeviceResponse struct {
+	ID           string     `json:"id"`
+	UserID       string     `json:"userId"`
+	Manufacturer string     `json:"manufacturer"`
+	Model        string     `json:"model"`
+	SerialNumber string     `json:"serialNumber"`
+	Status       string     `json:"status"`
+	ActivatedAt  *time.Time `json:"activatedAt,omitempty"`
+	ReplacedAt   *time.Time `json:"replacedAt,omitempty"`
+	ReplacedBy   string     `json:"replacedBy,omitempty"`
+	RetiredAt    *time.Time `json:"retiredAt,omitempty"`
+}
+
+// CreateDeviceRequest is the payload for registering a device.
+type CreateDeviceRequest struct {
+	Manufacturer string `json:"manufacturer" validate:"required"`
+	Model        string `json:"model" validate:"required"`
+	SerialNumber string `json:"serialNumber" validate:"required"`
+}
+
+// UpdateDeviceRequest is the payload for partially updating a device. Setting userId reassigns
+// the device to another user, the readings and events stored for it stay with the previous one.
+type UpdateDeviceRequest struct {
+	UserID       *string `json:"userId" validate:"omitempty,mongodb"`
+	Manufacturer *string `json:"manufacturer" validate:"omitempty,min=1"`
+	Model        *string `json:"model" validate:"omitempty,min=1"`
+	SerialNumber *string `json:"serialNumber" validate:"omitempty,min=1"`
+}
+
+// RetireDeviceRequest is the payload for retiring a device, retiredAt defaults to now.
+type RetireDeviceRequest struct {
+	RetiredAt *time.Time `json:"retiredAt"`
+}
+
+// ReplaceDeviceRequest is the payload for replacing a device with another active device
+// of the same user, replacedAt defaults to now.
+type ReplaceDeviceRequest struct {
+	ReplacementDeviceID string     `json:"replacementDeviceId" validate:"required,mongodb"`
+	ReplacedAt          *time.Time `json:"replacedAt"`
+}
+
+type DeviceParams struct {
+	ID       string `validate:"required,mongodb"`
+	DeviceID string `validate:"required,mongodb"`
+}
+
+func (api *API) ListDevices(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "ListDevices")
+	userID := chi.URLParam(r, "id")
+
+	err := api.validate.Var(userID, "required,mongodb")
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	devices, err := api.deviceRepo.FindByUser(r.Context(), userID)
+	if err != nil {
+		log.Errorf("failed to fetch devices: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	response := make([]DeviceResponse, len(devices))
+	for i, device := range devices {
+		response[i] = toDeviceResponse(device)
+	}
+	respondWithJSON(w, response)
+}
+
+func (api *API) CreateDevice(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "CreateDevice")
+	userID := chi.URLParam(r, "id")
+
+	err := api.validate.Var(userID, "required,mongodb")
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	var req CreateDeviceRequest
+	err = json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req)
+	if err != nil {
+		log.Errorf("invalid request body: %v", err)
+		respondWithError(w, r, invalidInput("request body", err))
+		return
+	}
+
+	err = api.validate.Struct(req)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := api.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		log.Errorf("failed to fetch user: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	device, err := api.deviceRepo.Save(ctx, domain.Device{
+		UserID:       user.ID,
+		Manufacturer: req.Manufacturer,
+		Model:        req.Model,
+		SerialNumber: req.SerialNumber,
+		Status:       domain.DeviceActive,
+		ActivatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		log.Errorf("failed to save device: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithStatus(w, http.StatusCreated, toDeviceResponse(device))
+}
+
+func (api *API) GetDevice(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "GetDevice")
+
+	params := DeviceParams{
+		ID:       chi.URLParam(r, "id"),
+		DeviceID: chi.URLParam(r, "deviceId"),
+	}
+
+	err := api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	device, err := api.findUserDevice(r, params)
+	if err != nil {
+		log.Errorf("failed to fetch device: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, toDeviceResponse(device))
+}
+
+func (api *API) UpdateDevice(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "UpdateDevice")
+
+	params := DeviceParams{
+		ID:       chi.URLParam(r, "id"),
+		DeviceID: chi.URLParam(r, "deviceId"),
+	}
+
+	err := api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	var req UpdateDeviceRequest
+	err = json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req)
+	if err != nil {
+		log.Errorf("invalid request body: %v", err)
+		respondWithError(w, r, invalidInput("request body", err))
+		return
+	}
+
+	err = api.validate.Struct(req)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	_, err = api.findUserDevice(r, params)
+	if err != nil {
+		log.Errorf("failed to fetch device: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	update := domain.DeviceUpdate{
+		Manufacturer: req.Manufacturer,
+		Model:        req.Model,
+		SerialNumber: req.SerialNumber,
+	}
+
+	ctx := r.Context()
+	if req.UserID != nil {
+		// Readings uploaded for the device from now on are stored for the new owner, who the caller
+		// has to be entitled to. Its history stays with the previous owner.
+		err = api.authorizeUser(ctx, auth.ActionWrite, *req.UserID)
+		if err != nil {
+			log.Errorf("failed to authorize new owner: %v", err)
+			respondWithError(w, r, err)
+			return
+		}
+
+		newOwner, err := api.userRepo.FindByID(ctx, *req.UserID)
+		if err != nil {
+			log.Errorf("failed to fetch new owner: %v", err)
+			respondWithError(w, r, err)
+			return
+		}
+		update.UserID = &newOwner.ID
+	}
+
+	device, err := api.deviceRepo.Update(ctx, params.DeviceID, update)
+	if err != nil {
+		log.Errorf("failed to update device: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, toDeviceResponse(device))
+}
+
+func (api *API) DeleteDevice(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "DeleteDevice")
+
+	params := DeviceParams{
+		ID:       chi.URLParam(r, "id"),
+		DeviceID: chi.URLParam(r, "deviceId"),
+	}
+
+	err := api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	_, err = api.findUserDevice(r, params)
+	if err != nil {
+		log.Errorf("failed to fetch device: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	err = api.deviceRepo.Delete(r.Context(), params.DeviceID)
+	if err != nil {
+		log.Errorf("failed to delete device: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) RetireDevice(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "RetireDevice")
+
+	params := DeviceParams{
+		ID:       chi.URLParam(r, "id"),
+		DeviceID: chi.URLParam(r, "deviceId"),
+	}
+
+	err := api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	var req RetireDeviceRequest
+	if r.ContentLength != 0 {
+		err = json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req)
+		if err != nil {
+			log.Errorf("invalid request body: %v", err)
+			respondWithError(w, r, invalidInput("request body", err))
+			return
+		}
+	}
+
+	device, err := api.findUserDevice(r, params)
+	if err != nil {
+		log.Errorf("failed to fetch device: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	if device.Lifecycle() != domain.DeviceActive {
+		respondWithError(w, r, errors.Wrapf(domain.ErrConflict, "device is already %s", device.Lifecycle()))
+		return
+	}
+
+	retiredAt := time.Now().UTC()
+	if req.RetiredAt != nil {
+		retiredAt = req.RetiredAt.UTC()
+	}
+
+	status := domain.DeviceRetired
+	device, err = api.deviceRepo.Update(r.Context(), params.DeviceID, domain.DeviceUpdate{
+		Status:    &status,
+		RetiredAt: &retiredAt,
+	})
+	if err != nil {
+		log.Errorf("failed to retire device: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, toDeviceResponse(device))
+}
+
+func (api *API) ReplaceDevice(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "ReplaceDevice")
+
+	params := DeviceParams{
+		ID:       chi.URLParam(r, "id"),
+		DeviceID: chi.URLParam(r, "deviceId"),
+	}
+
+	err := api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	var req ReplaceDeviceRequest
+	err = json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req)
+	if err != nil {
+		log.Errorf("invalid request body: %v", err)
+		respondWithError(w, r, invalidInput("request body", err))
+		return
+	}
+
+	err = api.validate.Struct(req)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	if req.ReplacementDeviceID == params.DeviceID {
+		respondWithError(w, r, errors.Wrap(domain.ErrInvalidInput, "a device cannot replace itself"))
+		return
+	}
+
+	device, err := api.findUserDevice(r, params)
+	if err != nil {
+		log.Errorf("failed to fetch device: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	if device.Lifecycle() != domain.DeviceActive {
+		respondWithError(w, r, errors.Wrapf(domain.ErrConflict, "device is already %s", device.Lifecycle()))
+		return
+	}
+
+	replacement, err := api.findUserDevice(r, DeviceParams{ID: params.ID, DeviceID: req.ReplacementDeviceID})
+	if err != nil {
+		log.Errorf("failed to fetch replacement device: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	if replacement.Lifecycle() != domain.DeviceActive {
+		respondWithError(w, r, errors.Wrapf(domain.ErrConflict, "replacement device is %s", replacement.Lifecycle()))
+		return
+	}
+
+	replacedAt := time.Now().UTC()
+	if req.ReplacedAt != nil {
+		replacedAt = req.ReplacedAt.UTC()
+	}
+
+	status := domain.DeviceReplaced
+	device, err = api.deviceRepo.Update(r.Context(), params.DeviceID, domain.DeviceUpdate{
+		Status:     &status,
+		ReplacedAt: &replacedAt,
+		ReplacedBy: &replacement.ID,
+	})
+	if err != nil {
+		log.Errorf("failed to replace device: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, toDeviceResponse(device))
+}
+
+// findUserDevice fetches a device and makes sure it belongs to the user in the path.
+func (api *API) findUserDevice(r *http.Request, params DeviceParams) (domain.Device, error) {
+	device, err := api.deviceRepo.FindByID(r.Context(), params.DeviceID)
+	if err != nil {
+		return domain.Device{}, err
+	}
+
+	if device.UserID.Hex() != params.ID {
+		return domain.Device{}, errDeviceNotOwned
+	}
+
+	return device, nil
+}
+
+func toDeviceResponse(device domain.Device) DeviceResponse {
+	response := DeviceResponse{
+		ID:           device.ID.Hex(),
+		UserID:       device.UserID.Hex(),
+		Manufacturer: device.Manufacturer,
+		Model:        device.Model,
+		SerialNumber: device.SerialNumber,
+		Status:       string(device.Lifecycle()),
+		ReplacedAt:   device.ReplacedAt,
+		RetiredAt:    device.RetiredAt,
+	}
+	if !device.ActivatedAt.IsZero() {
+		response.ActivatedAt = &device.ActivatedAt
+	}
+	if device.ReplacedBy != nil && *device.ReplacedBy != primitive.NilObjectID {
+		response.ReplacedBy = device.ReplacedBy.Hex()
+	}
+	return response
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"glooko/internal/auth"
+	"glooko/internal/domain"
+	"glooko/internal/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCreateDevice(t *testing.T) {
+	apiInstance := setupAPI()
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+	deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	deviceObjectID := primitive.NewObjectID()
+
+	userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID}, nil)
+	deviceRepo.On("Save", mock.Anything, mock.MatchedBy(func(d domain.Device) bool {
+		return d.UserID == userObjectID && d.Status == domain.DeviceActive && !d.ActivatedAt.IsZero()
+	})).Return(domain.Device{ID: deviceObjectID, UserID: userObjectID, SerialNumber: "SN1", Status: domain.DeviceActive}, nil)
+
+	body := `{"manufacturer":"Acme","model":"X100","serialNumber":"SN1"}`
+	req, err := http.NewRequest("POST", fmt.Sprintf("/users/%s/devices", userID), strings.NewReader(body))
+	assert.NoError(t, err)
+
+	w := serve(apiInstance, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response DeviceResponse
+	err = json.NewDecoder(w.Body).Decode(&response)
+	assert.NoError(t, err)
+	assert.Equal(t, deviceObjectID.Hex(), response.ID)
+	assert.Equal(t, "active", response.Status)
+}
+
+func TestRetireDevice(t *testing.T) {
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	deviceObjectID := primitive.NewObjectID()
+
+	testCases := []struct {
+		name       string
+		device     domain.Device
+		expectCode int
+	}{
+		{
+			name:       "Active Device",
+			device:     domain.Device{ID: deviceObjectID, UserID: userObjectID, Status: domain.DeviceActive},
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "Legacy Device Without Status",
+			device:     domain.Device{ID: deviceObjectID, UserID: userObjectID},
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "Already Retired",
+			device:     domain.Device{ID: deviceObjectID, UserID: userObjectID, Status: domain.DeviceRetired},
+			expectCode: http.StatusConflict,
+		},
+		{
+			name:       "Device Of Another User",
+			device:     domain.Device{ID: deviceObjectID, UserID: primitive.NewObjectID()},
+			expectCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+
+			deviceRepo.On("FindByID", mock.Anything, deviceObjectID.Hex()).Return(tc.device, nil)
+			deviceRepo.On("Update", mock.Anything, deviceObjectID.Hex(), mock.MatchedBy(func(u domain.DeviceUpdate) bool {
+				return u.Status != nil && *u.Status == domain.DeviceRetired && u.RetiredAt != nil
+			})).Return(domain.Device{ID: deviceObjectID, UserID: userObjectID, Status: domain.DeviceRetired}, nil).Maybe()
+
+			url := fmt.Sprintf("/users/%s/devices/%s/retire", userID, deviceObjectID.Hex())
+			req, err := http.NewRequest("POST", url, nil)
+			assert.NoError(t, err)
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, tc.expectCode, w.Code)
+		})
+	}
+}
+
+func TestUpdateDevice_MoveToUser(t *testing.T) {
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	newOwnerID := "abcdef1234567890abcdef12"
+	newOwnerObjectID, _ := primitive.ObjectIDFromHex(newOwnerID)
+	deviceObjectID := primitive.NewObjectID()
+
+	testCases := []struct {
+		name          string
+		token         string
+		newOwnerTeam  []string
+		newOwnerFound bool
+		expectCode    int
+	}{
+		{name: "Admin", token: testToken("admin-1", auth.RoleAdmin), newOwnerFound: true, expectCode: http.StatusOK},
+		{name: "Clinician Of Both", token: testToken("clinician-1", auth.RoleClinician), newOwnerTeam: []string{"clinician-1"}, newOwnerFound: true, expectCode: http.StatusOK},
+		{name: "Clinician Of Owner Only", token: testToken("clinician-1", auth.RoleClinician), newOwnerFound: true, expectCode: http.StatusForbidden},
+		{name: "Patient To Another Patient", token: testToken(userID, auth.RolePatient), newOwnerFound: true, expectCode: http.StatusForbidden},
+		{name: "Caregiver Of Both", token: testToken("caregiver-1", auth.RoleCaregiver), newOwnerTeam: []string{"caregiver-1"}, newOwnerFound: true, expectCode: http.StatusForbidden},
+		{name: "Unknown New Owner", token: testToken("admin-1", auth.RoleAdmin), expectCode: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+			deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+
+			owner := domain.User{ID: userObjectID, CareTeam: []string{"clinician-1", "caregiver-1"}}
+			userRepo.On("FindByID", mock.Anything, userID).Return(owner, nil).Maybe()
+			if tc.newOwnerFound {
+				newOwner := domain.User{ID: newOwnerObjectID, CareTeam: tc.newOwnerTeam}
+				userRepo.On("FindByID", mock.Anything, newOwnerID).Return(newOwner, nil).Maybe()
+			} else {
+				userRepo.On("FindByID", mock.Anything, newOwnerID).Return(domain.User{}, domain.ErrNotFound).Maybe()
+			}
+			deviceRepo.On("FindByID", mock.Anything, deviceObjectID.Hex()).Return(domain.Device{ID: deviceObjectID, UserID: userObjectID}, nil).Maybe()
+			deviceRepo.On("Update", mock.Anything, deviceObjectID.Hex(), domain.DeviceUpdate{UserID: &newOwnerObjectID}).
+				Return(domain.Device{ID: deviceObjectID, UserID: newOwnerObjectID}, nil).Maybe()
+
+			url := fmt.Sprintf("/users/%s/devices/%s", userID, deviceObjectID.Hex())
+			req, err := http.NewRequest("PATCH", url, strings.NewReader(`{"userId":"`+newOwnerID+`"}`))
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, tc.expectCode, w.Code)
+			if tc.expectCode != http.StatusOK {
+				deviceRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+
+			var response DeviceResponse
+			err = json.NewDecoder(w.Body).Decode(&response)
+			assert.NoError(t, err)
+			assert.Equal(t, newOwnerID, response.UserID)
+		})
+	}
+}
+
+func TestReplaceDevice(t *testing.T) {
+	apiInstance := setupAPI()
+	deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	oldDevice := primitive.NewObjectID()
+	newDevice := primitive.NewObjectID()
+
+	deviceRepo.On("FindByID", mock.Anything, oldDevice.Hex()).Return(domain.Device{ID: oldDevice, UserID: userObjectID}, nil)
+	deviceRepo.On("FindByID", mock.Anything, newDevice.Hex()).Return(domain.Device{ID: newDevice, UserID: userObjectID}, nil)
+	deviceRepo.On("Update", mock.Anything, oldDevice.Hex(), mock.MatchedBy(func(u domain.DeviceUpdate) bool {
+		return *u.Status == domain.DeviceReplaced && *u.ReplacedBy == newDevice
+	})).Return(domain.Device{ID: oldDevice, UserID: userObjectID, Status: domain.DeviceReplaced, ReplacedBy: &newDevice}, nil)
+
+	url := fmt.Sprintf("/users/%s/devices/%s/replace", userID, oldDevice.Hex())
+	body := fmt.Sprintf(`{"replacementDeviceId":%q}`, newDevice.Hex())
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	assert.NoError(t, err)
+
+	w := serve(apiInstance, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response DeviceResponse
+	err = json.NewDecoder(w.Body).Decode(&response)
+	assert.NoError(t, err)
+	assert.Equal(t, "replaced", response.Status)
+	assert.Equal(t, newDevice.Hex(), response.ReplacedBy)
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"glooko/internal/auth"
+	"glooko/internal/domain"
+	"glooko/internal/importer"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+)
+
+const problemContentType = "application/problem+json"
+
+// problemTypeBase prefixes the code of a problem to form its type URI.
+const problemTypeBase = "/problems/"
+
+// Problem is an RFC 7807 problem details response. Code is stable and meant for clients to branch
+// on, Detail is only set for client errors. Messages of repository and other internal errors may
+// carry connection details or patient data and are only logged.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Code     string       `json:"code"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes a request field that failed validation.
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+}
+
+// problemKind is the status, code and title reported for errors wrapping err.
+type problemKind struct {
+	err    error
+	status int
+	code   string
+	title  string
+}
+
+// problemKinds maps typed errors to problems, the first kind err wraps wins.
+var problemKinds = []problemKind{
+	{domain.ErrNotFound, http.StatusNotFound, "not_found", "Resource not found"},
+	{domain.ErrInvalidID, http.StatusBadRequest, "invalid_id", "Invalid ID"},
+	{domain.ErrInvalidRange, http.StatusBadRequest, "invalid_range", "Invalid range"},
+	{domain.ErrInvalidInput, http.StatusBadRequest, "invalid_input", "Invalid input"},
+	{domain.ErrConflict, http.StatusConflict, "conflict", "Conflict with the current state"},
+	{importer.ErrInvalidFile, http.StatusBadRequest, "invalid_file", "Invalid import file"},
+	{auth.ErrUnauthenticated, http.StatusUnauthorized, "unauthenticated", "Authentication required"},
+	{auth.ErrForbidden, http.StatusForbidden, "forbidden", "Access denied"},
+	{errIdempotencyKeysPending, http.StatusServiceUnavailable, "unavailable", "Service temporarily unavailable"},
+}
+
+// respondWithError writes err as problem details, see problemFor.
+func respondWithError(w http.ResponseWriter, r *http.Request, err error) {
+	problem := problemFor(err)
+	problem.Instance = r.URL.Path
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// problemFor maps err to problem details, errors of no known kind are internal errors.
+func problemFor(err error) Problem {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		problem := newProblem(http.StatusBadRequest, "validation_failed", "Validation failed")
+		problem.Detail = "One or more fields are invalid"
+		for _, fieldError := range validationErrors {
+			problem.Errors = append(problem.Errors, FieldError{Field: fieldError.Field(), Rule: fieldError.Tag()})
+		}
+		return problem
+	}
+
+	for _, kind := range problemKinds {
+		if errors.Is(err, kind.err) {
+			problem := newProblem(kind.status, kind.code, kind.title)
+			problem.Detail = strings.TrimSuffix(err.Error(), ": "+kind.err.Error())
+			return problem
+		}
+	}
+
+	return newProblem(http.StatusInternalServerError, "internal_error", "Internal server error")
+}
+
+func newProblem(status int, code, title string) Problem {
+	return Problem{Type: problemTypeBase + code, Title: title, Status: status, Code: code}
+}
+
+// statusForError maps errors to HTTP status codes.
+func statusForError(err error) int {
+	return problemFor(err).Status
+}
+
+// invalidInput marks err, found in the named part of the request, as domain.ErrInvalidInput.
+func invalidInput(name string, err error) error {
+	if errors.Is(err, domain.ErrInvalidInput) {
+		return err
+	}
+	return errors.Wrapf(domain.ErrInvalidInput, "invalid %s: %v", name, err)
+}
+
+// invalidRange marks err, found in the named range of the request, as domain.ErrInvalidRange.
+func invalidRange(name string, err error) error {
+	if errors.Is(err, domain.ErrInvalidRange) {
+		return err
+	}
+	return errors.Wrapf(domain.ErrInvalidRange, "invalid %s: %v", name, err)
+}
+
+// jsonFieldName reports fields in validation errors by their JSON name, falling back to the Go name.
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"glooko/internal/auth"
+	"glooko/internal/domain"
+	"glooko/internal/importer"
+	"glooko/internal/mocks"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestProblemFor(t *testing.T) {
+	testCases := []struct {
+		name         string
+		err          error
+		expectStatus int
+		expectCode   string
+		expectDetail string
+	}{
+		{name: "Not Found", err: errors.Wrap(domain.ErrNotFound, "user not found"), expectStatus: http.StatusNotFound, expectCode: "not_found", expectDetail: "user not found"},
+		{name: "Invalid ID", err: errors.Wrap(domain.ErrInvalidID, "failed to parse userID"), expectStatus: http.StatusBadRequest, expectCode: "invalid_id", expectDetail: "failed to parse userID"},
+		{name: "Invalid Range", err: invalidRange("date", errors.New("ge after le")), expectStatus: http.StatusBadRequest, expectCode: "invalid_range", expectDetail: "invalid date: ge after le"},
+		{name: "Invalid Input", err: invalidInput("limit", errors.New("not a number")), expectStatus: http.StatusBadRequest, expectCode: "invalid_input", expectDetail: "invalid limit: not a number"},
+		{name: "Conflict", err: errors.Wrap(domain.ErrConflict, "device is already retired"), expectStatus: http.StatusConflict, expectCode: "conflict", expectDetail: "device is already retired"},
+		{name: "Invalid File", err: errors.Wrap(importer.ErrInvalidFile, "no header"), expectStatus: http.StatusBadRequest, expectCode: "invalid_file", expectDetail: "no header"},
+		{name: "Forbidden", err: auth.ErrForbidden, expectStatus: http.StatusForbidden, expectCode: "forbidden", expectDetail: "forbidden"},
+		{name: "Internal", err: errors.New("server selection error: mongodb://admin:hunter2@db"), expectStatus: http.StatusInternalServerError, expectCode: "internal_error"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			problem := problemFor(tc.err)
+			assert.Equal(t, tc.expectStatus, problem.Status)
+			assert.Equal(t, tc.expectCode, problem.Code)
+			assert.Equal(t, "/problems/"+tc.expectCode, problem.Type)
+			assert.Equal(t, tc.expectDetail, problem.Detail)
+		})
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	userID := "1234567890abcdef12345678"
+
+	testCases := []struct {
+		name         string
+		path         string
+		err          error
+		expectStatus int
+		expectCode   string
+		expectErrors []FieldError
+	}{
+		{
+			name:         "Internal Error Is Not Leaked",
+			path:         "/users/" + userID,
+			err:          errors.New("server selection error: mongodb://admin:hunter2@db:27017"),
+			expectStatus: http.StatusInternalServerError,
+			expectCode:   "internal_error",
+		},
+		{
+			name:         "Not Found",
+			path:         "/users/" + userID,
+			err:          errors.Wrap(domain.ErrNotFound, "user not found"),
+			expectStatus: http.StatusNotFound,
+			expectCode:   "not_found",
+		},
+		{
+			name:         "Invalid ObjectID From Repository",
+			path:         "/users/" + userID,
+			err:          errors.Wrap(domain.ErrInvalidID, "failed to parse userID"),
+			expectStatus: http.StatusBadRequest,
+			expectCode:   "invalid_id",
+		},
+		{
+			name:         "Validation",
+			path:         "/users/" + userID + "/overview?start=yesterday",
+			expectStatus: http.StatusBadRequest,
+			expectCode:   "validation_failed",
+			expectErrors: []FieldError{{Field: "Start", Rule: "datetime"}},
+		},
+		{
+			name:         "Start After End",
+			path:         "/users/" + userID + "/overview?start=2024-03-02&end=2024-03-01",
+			expectStatus: http.StatusBadRequest,
+			expectCode:   "invalid_range",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+			userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{}, tc.err)
+
+			req, err := http.NewRequest("GET", tc.path, nil)
+			assert.NoError(t, err)
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, tc.expectStatus, w.Code)
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			assert.False(t, strings.Contains(w.Body.String(), "hunter2"))
+
+			var problem Problem
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+			assert.Equal(t, tc.expectStatus, problem.Status)
+			assert.Equal(t, tc.expectCode, problem.Code)
+			assert.Equal(t, strings.Split(tc.path, "?")[0], problem.Instance)
+			assert.Equal(t, tc.expectErrors, problem.Errors)
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"glooko/internal/domain"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type EventsParams struct {
+	ID    string `validate:"required"`
+	Start string `validate:"omitempty,datetime=2006-01-02"`
+	End   string `validate:"omitempty,datetime=2006-01-02"`
+	Type  string `validate:"omitempty,oneof=hypoglycemia hyperglycemia"`
+}
+
+// Event represents a detected hypoglycemic or hyperglycemic episode.
+type Event struct {
+	DeviceID        string    `json:"deviceId"`
+	Type            string    `json:"type"`
+	Level           int       `json:"level"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationMinutes int       `json:"durationMinutes"`
+	Extreme         float64   `json:"extreme"` // Nadir of a hypoglycemia or peak of a hyperglycemia
+}
+
+// EventsResponse holds the episodes of a user in the requested window.
+type EventsResponse struct {
+	UserID string  `json:"userId"`
+	Unit   string  `json:"unit"`
+	Events []Event `json:"events"`
+}
+
+func (api *API) GetEvents(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "GetEvents")
+
+	params := EventsParams{
+		ID:    chi.URLParam(r, "id"),
+		Start: r.URL.Query().Get("start"),
+		End:   r.URL.Query().Get("end"),
+		Type:  r.URL.Query().Get("type"),
+	}
+
+	err := api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, loc, err := api.findUserWithLocation(ctx, params.ID)
+	if err != nil {
+		log.Errorf("failed to fetch user: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	unit, err := resolveUnit(r, user)
+	if err != nil {
+		log.Errorf("invalid units: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	startDay, endDay, err := parseDates(params.Start, params.End, loc)
+	if err != nil {
+		log.Errorf("invalid date range: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	// Events are stored with absolute start times, convert the local days to instants
+	start := domain.LocalMidnight(startDay, loc)
+	end := domain.LocalMidnight(endDay.AddDate(0, 0, 1), loc).Add(-time.Nanosecond)
+
+	events, err := api.eventRepo.FetchEvents(ctx, params.ID, start, end)
+	if err != nil {
+		log.Errorf("failed to fetch events: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	response := EventsResponse{
+		UserID: params.ID,
+		Unit:   string(unit),
+		Events: []Event{},
+	}
+	for _, event := range events {
+		if params.Type != "" && string(event.Type) != params.Type {
+			continue
+		}
+		response.Events = append(response.Events, Event{
+			DeviceID:        event.DeviceID.Hex(),
+			Type:            string(event.Type),
+			Level:           event.Level,
+			Start:           event.Start.In(loc),
+			End:             event.End.In(loc),
+			DurationMinutes: int(event.End.Sub(event.Start).Minutes()),
+			Extreme:         unit.Round(unit.FromMgDL(float64(event.Extreme))),
+		})
+	}
+
+	respondWithJSON(w, response)
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+	"glooko/internal/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGetEvents(t *testing.T) {
+	apiInstance := setupAPI()
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+	eventRepo := apiInstance.eventRepo.(*mocks.EventRepository)
+
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID, Timezone: "America/Los_Angeles"}, nil)
+
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	assert.NoError(t, err)
+
+	// The local days are converted to the instants they start and end at in Los Angeles
+	start := time.Date(2024, 4, 6, 0, 0, 0, 0, loc)
+	end := time.Date(2024, 4, 7, 0, 0, 0, 0, loc).Add(-time.Nanosecond)
+
+	eventStart := time.Date(2024, 4, 6, 15, 0, 0, 0, time.UTC)
+	events := []domain.GlucoseEvent{
+		{UserID: userObjectID, Type: domain.EventHypoglycemia, Level: 2, Start: eventStart, End: eventStart.Add(40 * time.Minute), Extreme: 48},
+		{UserID: userObjectID, Type: domain.EventHyperglycemia, Level: 1, Start: eventStart.Add(3 * time.Hour), End: eventStart.Add(4 * time.Hour), Extreme: 220},
+	}
+	eventRepo.On("FetchEvents", mock.Anything, userID, start, end).Return(events, nil)
+
+	testCases := []struct {
+		name       string
+		query      string
+		expectCode int
+		expectLen  int
+	}{
+		{name: "All Events", query: "", expectCode: http.StatusOK, expectLen: 2},
+		{name: "Only Lows", query: "&type=hypoglycemia", expectCode: http.StatusOK, expectLen: 1},
+		{name: "Unknown Type", query: "&type=sideways", expectCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url := fmt.Sprintf("/users/%s/events?start=2024-04-06&end=2024-04-06%s", userID, tc.query)
+			req, err := http.NewRequest("GET", url, nil)
+			assert.NoError(t, err)
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, tc.expectCode, w.Code)
+
+			if tc.expectCode == http.StatusOK {
+				var response EventsResponse
+				err = json.NewDecoder(w.Body).Decode(&response)
+				assert.NoError(t, err)
+				assert.Len(t, response.Events, tc.expectLen)
+				assert.Equal(t, 40, response.Events[0].DurationMinutes)
+				assert.Equal(t, 48.0, response.Events[0].Extreme)
+			}
+		})
+	}
+}
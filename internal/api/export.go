@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"glooko/internal/domain"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ExportedReading is a single reading as streamed by the readings export.
+type ExportedReading struct {
+	DeviceID     string    `json:"deviceId"`
+	Manufacturer string    `json:"manufacturer"`
+	Model        string    `json:"model"`
+	SerialNumber string    `json:"serialNumber"`
+	Time         time.Time `json:"time"`
+	Value        float64   `json:"value"`
+	Unit         string    `json:"unit"`
+}
+
+var csvHeader = []string{"device_id", "manufacturer", "model", "serial_number", "timestamp", "value", "unit"}
+
+// ExportReadingsCSV always responds with CSV, regardless of the Accept header.
+func (api *API) ExportReadingsCSV(w http.ResponseWriter, r *http.Request) {
+	api.exportReadings(w, r, true)
+}
+
+// ExportReadings responds with CSV when the client accepts text/csv and with a JSON array otherwise.
+func (api *API) ExportReadings(w http.ResponseWriter, r *http.Request) {
+	api.exportReadings(w, r, strings.Contains(r.Header.Get("Accept"), "text/csv"))
+}
+
+func (api *API) exportReadings(w http.ResponseWriter, r *http.Request, asCSV bool) {
+	log := api.log.With("method", "ExportReadings")
+
+	params := UserOverviewParams{
+		ID:    chi.URLParam(r, "id"),
+		Start: r.URL.Query().Get("start"),
+		End:   r.URL.Query().Get("end"),
+	}
+
+	err := api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, loc, err := api.findUserWithLocation(ctx, params.ID)
+	if err != nil {
+		log.Errorf("failed to fetch user: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	unit, err := resolveUnit(r, user)
+	if err != nil {
+		log.Errorf("invalid units: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	start, end, err := parseDates(params.Start, params.End, loc)
+	if err != nil {
+		log.Errorf("invalid date range: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	devices, err := api.deviceRepo.FindByUser(ctx, params.ID)
+	if err != nil {
+		log.Errorf("failed to fetch devices: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	devicesByID := make(map[string]domain.Device, len(devices))
+	for _, device := range devices {
+		devicesByID[device.ID.Hex()] = device
+	}
+
+	// Nothing is written before the first bucket arrived, so a query failing up front still gets a
+	// problem response. Once the body started, errors abort the response and the client sees a
+	// truncated transfer rather than a complete looking export.
+	var begin func()
+	var write func(ExportedReading) error
+	var flush, finish func() error
+
+	if asCSV {
+		writer := csv.NewWriter(w)
+		begin = func() {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="readings-`+params.ID+`.csv"`)
+			writer.Write(csvHeader)
+		}
+		write = func(e ExportedReading) error {
+			return writer.Write([]string{
+				e.DeviceID,
+				e.Manufacturer,
+				e.Model,
+				e.SerialNumber,
+				e.Time.Format(time.RFC3339),
+				strconv.FormatFloat(e.Value, 'f', -1, 64),
+				e.Unit,
+			})
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+		finish = flush
+	} else {
+		encoder := json.NewEncoder(w)
+		first := true
+		begin = func() {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("["))
+		}
+		write = func(e ExportedReading) error {
+			if !first {
+				w.Write([]byte(","))
+			}
+			first = false
+			return encoder.Encode(e)
+		}
+		flush = func() error {
+			return nil
+		}
+		finish = func() error {
+			_, err := w.Write([]byte("]"))
+			return err
+		}
+	}
+
+	started := false
+	fetchStart, fetchEnd := bucketRange(start, end)
+	err = api.readingsRepo.StreamReadings(ctx, params.ID, fetchStart, fetchEnd, func(reading domain.Reading) error {
+		if !started {
+			begin()
+			started = true
+		}
+
+		device := devicesByID[reading.DeviceID.Hex()]
+
+		entries := make([]domain.ReadingEntry, len(reading.Readings))
+		copy(entries, reading.Readings)
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].Time.Before(entries[j].Time)
+		})
+
+		for _, entry := range entries {
+			localTime := entry.Time.In(loc)
+			day := domain.DayOf(localTime)
+			if day.Before(start) || day.After(end) {
+				continue
+			}
+
+			err := write(ExportedReading{
+				DeviceID:     reading.DeviceID.Hex(),
+				Manufacturer: device.Manufacturer,
+				Model:        device.Model,
+				SerialNumber: device.SerialNumber,
+				Time:         localTime,
+				Value:        unit.Round(unit.FromMgDL(float64(entry.Value))),
+				Unit:         string(unit),
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil && !started {
+		log.Errorf("failed to fetch readings: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+	if err != nil {
+		log.Errorf("failed to stream readings: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+
+	if !started {
+		begin()
+	}
+	if err := finish(); err != nil {
+		log.Errorf("failed to finish export: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+	"glooko/internal/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func setupExport(t *testing.T, apiInstance *API) (string, primitive.ObjectID) {
+	readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+	deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	deviceID := primitive.NewObjectID()
+	userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID}, nil)
+	deviceRepo.On("FindByUser", mock.Anything, userID).Return([]domain.Device{
+		{ID: deviceID, UserID: userObjectID, Manufacturer: "Dexcom", Model: "G7", SerialNumber: "SN-1"},
+	}, nil)
+
+	start, end, err := parseDates("2024-04-06", "2024-04-06", time.UTC)
+	assert.NoError(t, err)
+
+	readings := []domain.Reading{
+		{
+			UserID:   userObjectID,
+			DeviceID: deviceID,
+			Day:      start,
+			Readings: []domain.ReadingEntry{
+				{Time: start.Add(9 * time.Hour), Value: 180},
+				{Time: start.Add(8 * time.Hour), Value: 90},
+			},
+		},
+	}
+	readingsRepo.On("StreamReadings", mock.Anything, userID, start.AddDate(0, 0, -1), end.AddDate(0, 0, 1), mock.Anything).
+		Run(func(args mock.Arguments) {
+			fn := args.Get(4).(func(domain.Reading) error)
+			for _, reading := range readings {
+				assert.NoError(t, fn(reading))
+			}
+		}).
+		Return(nil)
+
+	return userID, deviceID
+}
+
+func TestExportReadingsCSV(t *testing.T) {
+	apiInstance := setupAPI()
+	userID, deviceID := setupExport(t, apiInstance)
+
+	url := fmt.Sprintf("/users/%s/readings.csv?start=2024-04-06&end=2024-04-06&units=mmol/L", userID)
+	req, err := http.NewRequest("GET", url, nil)
+	assert.NoError(t, err)
+
+	w := serve(apiInstance, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		csvHeader,
+		{deviceID.Hex(), "Dexcom", "G7", "SN-1", "2024-04-06T08:00:00Z", "5", "mmol/L"},
+		{deviceID.Hex(), "Dexcom", "G7", "SN-1", "2024-04-06T09:00:00Z", "10", "mmol/L"},
+	}, rows)
+}
+
+func TestExportReadingsNegotiation(t *testing.T) {
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+	}{
+		{name: "CSV requested", accept: "text/csv", contentType: "text/csv"},
+		{name: "JSON by default", accept: "", contentType: "application/json"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			userID, _ := setupExport(t, apiInstance)
+
+			url := fmt.Sprintf("/users/%s/readings?start=2024-04-06&end=2024-04-06", userID)
+			req, err := http.NewRequest("GET", url, nil)
+			assert.NoError(t, err)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tc.contentType, w.Header().Get("Content-Type"))
+
+			if tc.contentType == "application/json" {
+				var response []ExportedReading
+				assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+				assert.Len(t, response, 2)
+				assert.Equal(t, 90.0, response[0].Value)
+				assert.Equal(t, "mg/dL", response[0].Unit)
+			}
+		})
+	}
+}
+
+func TestExportReadingsInvalidRange(t *testing.T) {
+	apiInstance := setupAPI()
+
+	req, err := http.NewRequest("GET", "/users/1234567890abcdef12345678/readings.csv?start=06-04-2024", nil)
+	assert.NoError(t, err)
+
+	w := serve(apiInstance, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestExportReadingsStreamErrors(t *testing.T) {
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	day := time.Date(2024, 4, 6, 0, 0, 0, 0, time.UTC)
+
+	setup := func(t *testing.T, buckets int) *API {
+		apiInstance := setupAPI()
+		apiInstance.userRepo.(*mocks.UserRepository).On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID}, nil)
+		apiInstance.deviceRepo.(*mocks.DeviceRepository).On("FindByUser", mock.Anything, userID).Return([]domain.Device{}, nil)
+
+		auditRepo := new(mocks.AuditRepository)
+		auditRepo.On("Record", mock.Anything, mock.MatchedBy(func(entry domain.AuditEntry) bool {
+			return entry.Subject == userID && entry.Outcome == domain.AuditFailure
+		})).Return(nil).Once()
+		apiInstance.auditRepo = auditRepo
+		t.Cleanup(func() { auditRepo.AssertExpectations(t) })
+
+		apiInstance.readingsRepo.(*mocks.ReadingRepository).On("StreamReadings", mock.Anything, userID, mock.Anything, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				fn := args.Get(4).(func(domain.Reading) error)
+				for i := 0; i < buckets; i++ {
+					assert.NoError(t, fn(domain.Reading{UserID: userObjectID, Day: day, Readings: []domain.ReadingEntry{{Time: day.Add(8 * time.Hour), Value: 100}}}))
+				}
+			}).
+			Return(fmt.Errorf("cursor lost"))
+
+		return apiInstance
+	}
+
+	for format, path := range map[string]string{"CSV": "readings.csv", "JSON": "readings"} {
+		t.Run("Before Output "+format, func(t *testing.T) {
+			apiInstance := setup(t, 0)
+
+			url := fmt.Sprintf("/users/%s/%s?start=2024-04-06&end=2024-04-06", userID, path)
+			req, err := http.NewRequest("GET", url, nil)
+			assert.NoError(t, err)
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			assert.Empty(t, w.Header().Get("Content-Disposition"))
+		})
+
+		t.Run("After Output "+format, func(t *testing.T) {
+			apiInstance := setup(t, 1)
+
+			url := fmt.Sprintf("/users/%s/%s?start=2024-04-06&end=2024-04-06", userID, path)
+			req, err := http.NewRequest("GET", url, nil)
+			assert.NoError(t, err)
+
+			assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+				serve(apiInstance, req)
+			})
+		})
+	}
+}
@@ -0,0 +1,598 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"glooko/internal/auth"
+	"glooko/internal/domain"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	fhirContentType = "application/fhir+json"
+	loincSystem     = "http://loinc.org"
+	ucumSystem      = "http://unitsofmeasure.org"
+	categorySystem  = "http://terminology.hl7.org/CodeSystem/observation-category"
+
+	// LOINC codes for glucose in blood by mass and by substance concentration
+	loincGlucoseMass  = "2339-0"
+	loincGlucoseMoles = "15074-8"
+
+	defaultFHIRPageSize = 100
+	maxFHIRSearchDays   = 90
+)
+
+// FHIR R4 resources, limited to the elements this API fills in.
+
+type FHIRCoding struct {
+	System  string `json:"system"`
+	Code    string `json:"code"`
+	Display string `json:"display,omitempty"`
+}
+
+type FHIRCodeableConcept struct {
+	Coding []FHIRCoding `json:"coding"`
+	Text   string       `json:"text,omitempty"`
+}
+
+type FHIRIdentifier struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value"`
+}
+
+type FHIRReference struct {
+	Reference  string          `json:"reference,omitempty"`
+	Identifier *FHIRIdentifier `json:"identifier,omitempty"`
+	Display    string          `json:"display,omitempty"`
+}
+
+type FHIRQuantity struct {
+	Value  float64 `json:"value"`
+	Unit   string  `json:"unit"`
+	System string  `json:"system"`
+	Code   string  `json:"code"`
+}
+
+type FHIRHumanName struct {
+	Family string   `json:"family"`
+	Given  []string `json:"given"`
+}
+
+type FHIRContactPoint struct {
+	System string `json:"system"`
+	Value  string `json:"value"`
+}
+
+type FHIRPatient struct {
+	ResourceType string             `json:"resourceType"`
+	ID           string             `json:"id"`
+	Name         []FHIRHumanName    `json:"name"`
+	BirthDate    string             `json:"birthDate,omitempty"`
+	Telecom      []FHIRContactPoint `json:"telecom,omitempty"`
+}
+
+type FHIRObservation struct {
+	ResourceType      string                `json:"resourceType"`
+	ID                string                `json:"id"`
+	Status            string                `json:"status"`
+	Category          []FHIRCodeableConcept `json:"category"`
+	Code              FHIRCodeableConcept   `json:"code"`
+	Subject           FHIRReference         `json:"subject"`
+	EffectiveDateTime string                `json:"effectiveDateTime"`
+	ValueQuantity     FHIRQuantity          `json:"valueQuantity"`
+	Device            *FHIRReference        `json:"device,omitempty"`
+}
+
+type FHIRBundleLink struct {
+	Relation string `json:"relation"`
+	URL      string `json:"url"`
+}
+
+type FHIRBundleSearch struct {
+	Mode string `json:"mode"`
+}
+
+type FHIRBundleEntry struct {
+	FullURL  string            `json:"fullUrl"`
+	Resource interface{}       `json:"resource"`
+	Search   *FHIRBundleSearch `json:"search,omitempty"`
+}
+
+type FHIRBundle struct {
+	ResourceType string            `json:"resourceType"`
+	Type         string            `json:"type"`
+	Total        int               `json:"total"`
+	Link         []FHIRBundleLink  `json:"link"`
+	Entry        []FHIRBundleEntry `json:"entry"`
+}
+
+type FHIRIssue struct {
+	Severity    string `json:"severity"`
+	Code        string `json:"code"`
+	Diagnostics string `json:"diagnostics"`
+}
+
+// FHIROperationOutcome reports errors to FHIR clients, which do not understand plain text bodies.
+type FHIROperationOutcome struct {
+	ResourceType string      `json:"resourceType"`
+	Issue        []FHIRIssue `json:"issue"`
+}
+
+// FHIRPatientParams identifies the patient to read.
+type FHIRPatientParams struct {
+	ID string `validate:"required,mongodb"`
+}
+
+// FHIRObservationReadParams identifies the observation to read.
+type FHIRObservationReadParams struct {
+	ID string `validate:"required"`
+}
+
+// FHIRObservationParams holds the supported Observation search parameters.
+type FHIRObservationParams struct {
+	Patient string `validate:"required,mongodb"`
+	Count   int    `validate:"min=1,max=1000"`
+	Offset  int    `validate:"min=0"`
+}
+
+func (api *API) GetFHIRPatient(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "GetFHIRPatient")
+
+	params := FHIRPatientParams{
+		ID: chi.URLParam(r, "id"),
+	}
+
+	err := api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	user, err := api.userRepo.FindByID(r.Context(), params.ID)
+	if err != nil {
+		log.Errorf("failed to fetch user: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	principal, _ := auth.PrincipalFrom(r.Context())
+	err = auth.Authorize(principal, auth.ActionRead, user)
+	if err != nil {
+		log.Errorf("failed to authorize: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	respondWithFHIR(w, toFHIRPatient(user))
+}
+
+// SearchFHIRObservations returns the glucose readings of a patient as a searchset Bundle.
+// The date parameter may be repeated and accepts the eq, ge, gt, le and lt prefixes, dates without
+// a time are days in the patient's time zone. Without a date the last 14 days are returned.
+// Pages are selected with _count and _offset.
+func (api *API) SearchFHIRObservations(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "SearchFHIRObservations")
+
+	query := r.URL.Query()
+	count, err := queryInt(r, "_count", defaultFHIRPageSize)
+	if err != nil {
+		log.Errorf("invalid _count: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	offset, err := queryInt(r, "_offset", 0)
+	if err != nil {
+		log.Errorf("invalid _offset: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	params := FHIRObservationParams{
+		Patient: strings.TrimPrefix(query.Get("patient"), "Patient/"),
+		Count:   count,
+		Offset:  offset,
+	}
+
+	err = api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, loc, err := api.findUserWithLocation(ctx, params.Patient)
+	if err != nil {
+		log.Errorf("failed to fetch user: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	principal, _ := auth.PrincipalFrom(r.Context())
+	err = auth.Authorize(principal, auth.ActionRead, user)
+	if err != nil {
+		log.Errorf("failed to authorize: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	unit, err := resolveUnit(r, user)
+	if err != nil {
+		log.Errorf("invalid units: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	from, to, err := parseFHIRDates(query["date"], loc, time.Now())
+	if err != nil {
+		log.Errorf("invalid date: %v", err)
+		respondWithOperationOutcome(w, invalidRange("date", err))
+		return
+	}
+
+	// to is exclusive, the last bucket needed is the one of the instant before it
+	startDay, endDay := bucketRange(domain.DayOf(from.In(loc)), domain.DayOf(to.Add(-time.Nanosecond).In(loc)))
+	readings, err := api.readingsRepo.FetchReadings(ctx, params.Patient, startDay, endDay.AddDate(0, 0, 1).Add(-time.Nanosecond))
+	if err != nil {
+		log.Errorf("failed to fetch readings: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	devices, err := api.deviceRepo.FindByUser(ctx, params.Patient)
+	if err != nil {
+		log.Errorf("failed to fetch devices: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	devicesByID := make(map[string]domain.Device, len(devices))
+	for _, device := range devices {
+		devicesByID[device.ID.Hex()] = device
+	}
+
+	type match struct {
+		deviceID string
+		entry    domain.ReadingEntry
+	}
+	var matches []match
+	for _, reading := range readings {
+		for _, entry := range reading.Readings {
+			if entry.Time.Before(from) || !entry.Time.Before(to) {
+				continue
+			}
+			matches = append(matches, match{deviceID: reading.DeviceID.Hex(), entry: entry})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].entry.Time.Before(matches[j].entry.Time)
+	})
+
+	base := fhirBaseURL(r)
+	bundle := FHIRBundle{
+		ResourceType: "Bundle",
+		Type:         "searchset",
+		Total:        len(matches),
+		Link:         fhirPageLinks(base+"/Observation", query, params.Offset, params.Count, len(matches)),
+		Entry:        []FHIRBundleEntry{},
+	}
+
+	for i := params.Offset; i < len(matches) && i < params.Offset+params.Count; i++ {
+		m := matches[i]
+		observation := toFHIRObservation(params.Patient, devicesByID[m.deviceID], m.deviceID, m.entry, loc, unit)
+		bundle.Entry = append(bundle.Entry, FHIRBundleEntry{
+			FullURL:  base + "/Observation/" + observation.ID,
+			Resource: observation,
+			Search:   &FHIRBundleSearch{Mode: "match"},
+		})
+	}
+
+	respondWithFHIR(w, bundle)
+}
+
+// GetFHIRObservation reads a single glucose reading by the ID it has in search results.
+func (api *API) GetFHIRObservation(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "GetFHIRObservation")
+
+	params := FHIRObservationReadParams{
+		ID: chi.URLParam(r, "observationId"),
+	}
+
+	err := api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	deviceID, timestamp, err := parseObservationID(params.ID)
+	if err != nil {
+		log.Errorf("invalid observation ID: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	device, err := api.deviceRepo.FindByID(ctx, deviceID)
+	if err != nil {
+		log.Errorf("failed to fetch device: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	patientID := device.UserID.Hex()
+	setAuditSubject(r, patientID)
+
+	user, loc, err := api.findUserWithLocation(ctx, patientID)
+	if err != nil {
+		log.Errorf("failed to fetch user: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	principal, _ := auth.PrincipalFrom(r.Context())
+	err = auth.Authorize(principal, auth.ActionRead, user)
+	if err != nil {
+		log.Errorf("failed to authorize: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	unit, err := resolveUnit(r, user)
+	if err != nil {
+		log.Errorf("invalid units: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	day := domain.DayOf(timestamp.In(loc))
+	startDay, endDay := bucketRange(day, day)
+	readings, err := api.readingsRepo.FetchReadings(ctx, patientID, startDay, endDay.AddDate(0, 0, 1).Add(-time.Nanosecond))
+	if err != nil {
+		log.Errorf("failed to fetch readings: %v", err)
+		respondWithOperationOutcome(w, err)
+		return
+	}
+
+	for _, reading := range readings {
+		if reading.DeviceID != device.ID {
+			continue
+		}
+		for _, entry := range reading.Readings {
+			if entry.Time.Unix() == timestamp.Unix() {
+				respondWithFHIR(w, toFHIRObservation(patientID, device, deviceID, entry, loc, unit))
+				return
+			}
+		}
+	}
+
+	log.Errorf("no reading of device %s at %s", deviceID, timestamp)
+	respondWithOperationOutcome(w, errors.Wrap(domain.ErrNotFound, "observation not found"))
+}
+
+// parseObservationID splits an observation ID, as assigned by toFHIRObservation, into the device
+// ID and the time of the reading.
+func parseObservationID(id string) (string, time.Time, error) {
+	deviceID, seconds, ok := strings.Cut(id, "-")
+	if !ok || !primitive.IsValidObjectID(deviceID) {
+		return "", time.Time{}, errors.Wrapf(domain.ErrInvalidID, "malformed observation ID %q", id)
+	}
+
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(domain.ErrInvalidID, "malformed observation ID %q", id)
+	}
+
+	return deviceID, time.Unix(unix, 0), nil
+}
+
+func toFHIRPatient(user domain.User) FHIRPatient {
+	patient := FHIRPatient{
+		ResourceType: "Patient",
+		ID:           user.ID.Hex(),
+		Name:         []FHIRHumanName{{Family: user.LastName, Given: []string{user.FirstName}}},
+	}
+	if !user.DateOfBirth.IsZero() {
+		patient.BirthDate = user.DateOfBirth.Format("2006-01-02")
+	}
+	if user.Email != "" {
+		patient.Telecom = append(patient.Telecom, FHIRContactPoint{System: "email", Value: user.Email})
+	}
+	if user.PhoneNumber != "" {
+		patient.Telecom = append(patient.Telecom, FHIRContactPoint{System: "phone", Value: user.PhoneNumber})
+	}
+	return patient
+}
+
+// toFHIRObservation maps a reading onto an Observation coded by unit, LOINC 2339-0 for mg/dL and
+// 15074-8 for mmol/L. Entries have no ID of their own, the device and timestamp identify them.
+func toFHIRObservation(patientID string, device domain.Device, deviceID string, entry domain.ReadingEntry, loc *time.Location, unit domain.GlucoseUnit) FHIRObservation {
+	code := FHIRCoding{System: loincSystem, Code: loincGlucoseMass, Display: "Glucose [Mass/volume] in Blood"}
+	if unit == domain.MmolL {
+		code = FHIRCoding{System: loincSystem, Code: loincGlucoseMoles, Display: "Glucose [Moles/volume] in Blood"}
+	}
+
+	observation := FHIRObservation{
+		ResourceType: "Observation",
+		ID:           fmt.Sprintf("%s-%d", deviceID, entry.Time.Unix()),
+		Status:       "final",
+		Category: []FHIRCodeableConcept{{
+			Coding: []FHIRCoding{{System: categorySystem, Code: "laboratory", Display: "Laboratory"}},
+		}},
+		Code:              FHIRCodeableConcept{Coding: []FHIRCoding{code}, Text: "Glucose"},
+		Subject:           FHIRReference{Reference: "Patient/" + patientID},
+		EffectiveDateTime: entry.Time.In(loc).Format(time.RFC3339),
+		ValueQuantity: FHIRQuantity{
+			Value:  unit.Round(unit.FromMgDL(float64(entry.Value))),
+			Unit:   string(unit),
+			System: ucumSystem,
+			Code:   string(unit),
+		},
+	}
+
+	if device.SerialNumber != "" {
+		observation.Device = &FHIRReference{
+			Identifier: &FHIRIdentifier{Value: device.SerialNumber},
+			Display:    strings.TrimSpace(device.Manufacturer + " " + device.Model),
+		}
+	}
+
+	return observation
+}
+
+// parseFHIRDates narrows [from, to) down by each date search parameter. Missing bounds default to
+// now and 14 days before the upper bound, ranges longer than 90 days are rejected.
+func parseFHIRDates(values []string, loc *time.Location, now time.Time) (from, to time.Time, err error) {
+	for _, value := range values {
+		prefix := "eq"
+		if len(value) > 2 && strings.Trim(value[:2], "abcdefghijklmnopqrstuvwxyz") == "" {
+			prefix, value = value[:2], value[2:]
+		}
+
+		start, end, err := parseFHIRDate(value, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+
+		switch prefix {
+		case "eq":
+			from, to = later(from, start), earlier(to, end)
+		case "ge":
+			from = later(from, start)
+		case "gt":
+			from = later(from, end)
+		case "le":
+			to = earlier(to, end)
+		case "lt":
+			to = earlier(to, start)
+		default:
+			return time.Time{}, time.Time{}, errors.Errorf("unsupported prefix %q", prefix)
+		}
+	}
+
+	if to.IsZero() {
+		to = now
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -14)
+	}
+	if to.Sub(from) > maxFHIRSearchDays*24*time.Hour {
+		return time.Time{}, time.Time{}, errors.Errorf("range exceeds %d days", maxFHIRSearchDays)
+	}
+
+	return from, to, nil
+}
+
+// parseFHIRDate returns the period covered by a date, a full day in loc or a single instant.
+func parseFHIRDate(value string, loc *time.Location) (start, end time.Time, err error) {
+	day, err := time.ParseInLocation("2006-01-02", value, loc)
+	if err == nil {
+		return day, time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc), nil
+	}
+
+	instant, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.Errorf("%q is neither a date nor a dateTime", value)
+	}
+	return instant, instant.Add(time.Nanosecond), nil
+}
+
+func later(a, b time.Time) time.Time {
+	if a.IsZero() || b.After(a) {
+		return b
+	}
+	return a
+}
+
+func earlier(a, b time.Time) time.Time {
+	if a.IsZero() || b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// fhirPageLinks builds the self, first, previous and next links of a searchset page.
+func fhirPageLinks(endpoint string, query url.Values, offset, count, total int) []FHIRBundleLink {
+	page := func(offset int) string {
+		q := url.Values{}
+		for key, values := range query {
+			q[key] = values
+		}
+		q.Set("_count", strconv.Itoa(count))
+		q.Set("_offset", strconv.Itoa(offset))
+		return endpoint + "?" + q.Encode()
+	}
+
+	links := []FHIRBundleLink{
+		{Relation: "self", URL: page(offset)},
+		{Relation: "first", URL: page(0)},
+	}
+	if offset > 0 {
+		links = append(links, FHIRBundleLink{Relation: "previous", URL: page(max(offset-count, 0))})
+	}
+	if offset+count < total {
+		links = append(links, FHIRBundleLink{Relation: "next", URL: page(offset + count)})
+	}
+	return links
+}
+
+// fhirBaseURL returns the absolute URL of the FHIR endpoint, honouring a TLS terminating proxy.
+func fhirBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/fhir"
+}
+
+// issueCodes maps problem codes to FHIR issue type codes, anything else is an exception.
+var issueCodes = map[string]string{
+	"validation_failed": "invalid",
+	"invalid_id":        "invalid",
+	"invalid_range":     "invalid",
+	"invalid_input":     "invalid",
+	"not_found":         "not-found",
+	"conflict":          "conflict",
+	"unauthenticated":   "login",
+	"forbidden":         "forbidden",
+}
+
+func respondWithFHIR(w http.ResponseWriter, resource interface{}) {
+	w.Header().Set("Content-Type", fhirContentType)
+	json.NewEncoder(w).Encode(resource)
+}
+
+// respondWithOperationOutcome writes err as an OperationOutcome, with the status and diagnostics
+// of its problem details, see problemFor.
+func respondWithOperationOutcome(w http.ResponseWriter, err error) {
+	problem := problemFor(err)
+	code, ok := issueCodes[problem.Code]
+	if !ok {
+		code = "exception"
+	}
+	diagnostics := problem.Title
+	if problem.Detail != "" {
+		diagnostics = problem.Detail
+	}
+	for _, fieldError := range problem.Errors {
+		diagnostics += fmt.Sprintf("; %s failed %s", fieldError.Field, fieldError.Rule)
+	}
+
+	w.Header().Set("Content-Type", fhirContentType)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(FHIROperationOutcome{
+		ResourceType: "OperationOutcome",
+		Issue:        []FHIRIssue{{Severity: "error", Code: code, Diagnostics: diagnostics}},
+	})
+}
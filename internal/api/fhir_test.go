@@ -0,0 +1,309 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"glooko/internal/auth"
+	"glooko/internal/domain"
+	"glooko/internal/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fhirObservationBundle decodes a searchset whose entries are all Observations.
+type fhirObservationBundle struct {
+	FHIRBundle
+	Entry []struct {
+		FullURL  string          `json:"fullUrl"`
+		Resource FHIRObservation `json:"resource"`
+	} `json:"entry"`
+}
+
+func TestGetFHIRPatient(t *testing.T) {
+	apiInstance := setupAPI()
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	missingID := "1234567890abcdef12345679"
+	userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{
+		ID:          userObjectID,
+		FirstName:   "Jane",
+		LastName:    "Doe",
+		DateOfBirth: time.Date(1980, 5, 17, 0, 0, 0, 0, time.UTC),
+		Email:       "jane@example.com",
+	}, nil)
+	userRepo.On("FindByID", mock.Anything, missingID).Return(domain.User{}, domain.ErrNotFound)
+
+	testCases := []struct {
+		name       string
+		id         string
+		expectCode int
+	}{
+		{name: "Found", id: userID, expectCode: http.StatusOK},
+		{name: "Not Found", id: missingID, expectCode: http.StatusNotFound},
+		{name: "Invalid ID", id: "123", expectCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/fhir/Patient/"+tc.id, nil)
+			assert.NoError(t, err)
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, tc.expectCode, w.Code)
+			assert.Equal(t, fhirContentType, w.Header().Get("Content-Type"))
+
+			if tc.expectCode != http.StatusOK {
+				var outcome FHIROperationOutcome
+				assert.NoError(t, json.NewDecoder(w.Body).Decode(&outcome))
+				assert.Equal(t, "OperationOutcome", outcome.ResourceType)
+				return
+			}
+
+			var patient FHIRPatient
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&patient))
+			assert.Equal(t, "Patient", patient.ResourceType)
+			assert.Equal(t, userID, patient.ID)
+			assert.Equal(t, []FHIRHumanName{{Family: "Doe", Given: []string{"Jane"}}}, patient.Name)
+			assert.Equal(t, "1980-05-17", patient.BirthDate)
+			assert.Equal(t, []FHIRContactPoint{{System: "email", Value: "jane@example.com"}}, patient.Telecom)
+		})
+	}
+}
+
+func TestSearchFHIRObservations(t *testing.T) {
+	apiInstance := setupAPI()
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+	deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+	readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	deviceID := primitive.NewObjectID()
+	userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID}, nil)
+	deviceRepo.On("FindByUser", mock.Anything, userID).Return([]domain.Device{
+		{ID: deviceID, Manufacturer: "Dexcom", Model: "G7", SerialNumber: "SN-1"},
+	}, nil)
+
+	day := time.Date(2024, 4, 6, 0, 0, 0, 0, time.UTC)
+	readings := []domain.Reading{
+		{
+			UserID:   userObjectID,
+			DeviceID: deviceID,
+			Day:      day,
+			Readings: []domain.ReadingEntry{
+				{Time: day.Add(10 * time.Hour), Value: 90},
+				{Time: day.Add(8 * time.Hour), Value: 180},
+				{Time: day.Add(9 * time.Hour), Value: 126},
+			},
+		},
+	}
+	readingsRepo.On("FetchReadings", mock.Anything, userID, day.AddDate(0, 0, -1), day.AddDate(0, 0, 2).Add(-time.Nanosecond)).Return(readings, nil)
+
+	t.Run("First Page", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/fhir/Observation?patient=Patient/%s&date=2024-04-06&_count=2", userID), nil)
+		assert.NoError(t, err)
+
+		w := serve(apiInstance, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var bundle fhirObservationBundle
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&bundle))
+		assert.Equal(t, "Bundle", bundle.ResourceType)
+		assert.Equal(t, "searchset", bundle.Type)
+		assert.Equal(t, 3, bundle.Total)
+		assert.Len(t, bundle.Entry, 2)
+
+		observation := bundle.Entry[0].Resource
+		assert.Equal(t, "Observation", observation.ResourceType)
+		fullURL, err := url.Parse(bundle.Entry[0].FullURL)
+		assert.NoError(t, err)
+		assert.Equal(t, "/fhir/Observation/"+observation.ID, fullURL.Path)
+		assert.Equal(t, loincGlucoseMass, observation.Code.Coding[0].Code)
+		assert.Equal(t, "Patient/"+userID, observation.Subject.Reference)
+		assert.Equal(t, "2024-04-06T08:00:00Z", observation.EffectiveDateTime)
+		assert.Equal(t, FHIRQuantity{Value: 180, Unit: "mg/dL", System: ucumSystem, Code: "mg/dL"}, observation.ValueQuantity)
+		assert.Equal(t, "SN-1", observation.Device.Identifier.Value)
+
+		links := map[string]string{}
+		for _, link := range bundle.Link {
+			links[link.Relation] = link.URL
+		}
+		assert.NotContains(t, links, "previous")
+		next, err := url.Parse(links["next"])
+		assert.NoError(t, err)
+		assert.Equal(t, "/fhir/Observation", next.Path)
+		assert.Equal(t, "2", next.Query().Get("_offset"))
+		assert.Equal(t, "2024-04-06", next.Query().Get("date"))
+	})
+
+	t.Run("Last Page In mmol/L", func(t *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/fhir/Observation?patient=%s&date=ge2024-04-06&date=lt2024-04-07&_count=2&_offset=2&units=mmol/L", userID), nil)
+		assert.NoError(t, err)
+
+		w := serve(apiInstance, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var bundle fhirObservationBundle
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&bundle))
+		assert.Len(t, bundle.Entry, 1)
+
+		observation := bundle.Entry[0].Resource
+		assert.Equal(t, loincGlucoseMoles, observation.Code.Coding[0].Code)
+		assert.Equal(t, FHIRQuantity{Value: 5, Unit: "mmol/L", System: ucumSystem, Code: "mmol/L"}, observation.ValueQuantity)
+
+		relations := []string{}
+		for _, link := range bundle.Link {
+			relations = append(relations, link.Relation)
+		}
+		assert.Equal(t, []string{"self", "first", "previous"}, relations)
+	})
+
+	t.Run("Missing Patient", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/fhir/Observation", nil)
+		assert.NoError(t, err)
+
+		w := serve(apiInstance, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestGetFHIRObservation(t *testing.T) {
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	otherPatient := "abcdef1234567890abcdef12"
+	device := domain.Device{ID: primitive.NewObjectID(), UserID: userObjectID, Manufacturer: "Dexcom", Model: "G7", SerialNumber: "SN-1"}
+	missingDevice := primitive.NewObjectID().Hex()
+
+	// Stored with the previous day by a patient then living further east
+	timestamp := time.Date(2024, 4, 6, 8, 0, 0, 0, time.UTC)
+	readings := []domain.Reading{
+		{
+			UserID:   userObjectID,
+			DeviceID: device.ID,
+			Day:      time.Date(2024, 4, 5, 0, 0, 0, 0, time.UTC),
+			Readings: []domain.ReadingEntry{{Time: timestamp, Value: 126}},
+		},
+	}
+
+	testCases := []struct {
+		name       string
+		id         string
+		token      string
+		expectCode int
+	}{
+		{name: "Found", id: fmt.Sprintf("%s-%d", device.ID.Hex(), timestamp.Unix()), expectCode: http.StatusOK},
+		{name: "Patient Reading Own", id: fmt.Sprintf("%s-%d", device.ID.Hex(), timestamp.Unix()), token: testToken(userID, auth.RolePatient), expectCode: http.StatusOK},
+		{name: "Other Patient", id: fmt.Sprintf("%s-%d", device.ID.Hex(), timestamp.Unix()), token: testToken(otherPatient, auth.RolePatient), expectCode: http.StatusForbidden},
+		{name: "No Reading At Time", id: fmt.Sprintf("%s-%d", device.ID.Hex(), timestamp.Unix()+60), expectCode: http.StatusNotFound},
+		{name: "Unknown Device", id: fmt.Sprintf("%s-%d", missingDevice, timestamp.Unix()), expectCode: http.StatusNotFound},
+		{name: "Malformed ID", id: device.ID.Hex(), expectCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			apiInstance.userRepo.(*mocks.UserRepository).On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID}, nil).Maybe()
+			deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+			deviceRepo.On("FindByID", mock.Anything, device.ID.Hex()).Return(device, nil).Maybe()
+			deviceRepo.On("FindByID", mock.Anything, missingDevice).Return(domain.Device{}, domain.ErrNotFound).Maybe()
+			apiInstance.readingsRepo.(*mocks.ReadingRepository).On("FetchReadings", mock.Anything, userID, time.Date(2024, 4, 5, 0, 0, 0, 0, time.UTC), time.Date(2024, 4, 8, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond)).Return(readings, nil).Maybe()
+
+			// The access is recorded against the patient the observation belongs to
+			auditRepo := new(mocks.AuditRepository)
+			auditRepo.On("Record", mock.Anything, mock.MatchedBy(func(entry domain.AuditEntry) bool {
+				return entry.Subject == userID && entry.Endpoint == "/fhir/Observation/{observationId}"
+			})).Return(nil).Maybe()
+			auditRepo.On("Record", mock.Anything, mock.Anything).Return(nil).Maybe()
+			apiInstance.auditRepo = auditRepo
+
+			req, err := http.NewRequest("GET", "/fhir/Observation/"+tc.id, nil)
+			assert.NoError(t, err)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, tc.expectCode, w.Code)
+			assert.Equal(t, fhirContentType, w.Header().Get("Content-Type"))
+			if tc.expectCode != http.StatusOK {
+				return
+			}
+
+			auditRepo.AssertCalled(t, "Record", mock.Anything, mock.MatchedBy(func(entry domain.AuditEntry) bool {
+				return entry.Subject == userID
+			}))
+
+			var observation FHIRObservation
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&observation))
+			assert.Equal(t, tc.id, observation.ID)
+			assert.Equal(t, "Patient/"+userID, observation.Subject.Reference)
+			assert.Equal(t, "2024-04-06T08:00:00Z", observation.EffectiveDateTime)
+			assert.Equal(t, FHIRQuantity{Value: 126, Unit: "mg/dL", System: ucumSystem, Code: "mg/dL"}, observation.ValueQuantity)
+			assert.Equal(t, "SN-1", observation.Device.Identifier.Value)
+		})
+	}
+}
+
+func TestParseFHIRDates(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	now := time.Date(2024, 4, 20, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name        string
+		values      []string
+		expectFrom  time.Time
+		expectTo    time.Time
+		expectError bool
+	}{
+		{
+			name:       "Default Window",
+			expectFrom: now.AddDate(0, 0, -14),
+			expectTo:   now,
+		},
+		{
+			name:       "Local Day",
+			values:     []string{"2024-04-06"},
+			expectFrom: time.Date(2024, 4, 6, 4, 0, 0, 0, time.UTC),
+			expectTo:   time.Date(2024, 4, 7, 4, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Instant Bounds",
+			values:     []string{"gt2024-04-06T10:00:00Z", "le2024-04-06T12:00:00Z"},
+			expectFrom: time.Date(2024, 4, 6, 10, 0, 0, 1, time.UTC),
+			expectTo:   time.Date(2024, 4, 6, 12, 0, 0, 1, time.UTC),
+		},
+		{
+			name:        "Unsupported Prefix",
+			values:      []string{"sa2024-04-06"},
+			expectError: true,
+		},
+		{
+			name:        "Range Too Long",
+			values:      []string{"ge2023-01-01"},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			from, to, err := parseFHIRDates(tc.values, loc, now)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, tc.expectFrom.Equal(from), "from %s", from)
+			assert.True(t, tc.expectTo.Equal(to), "to %s", to)
+		})
+	}
+}
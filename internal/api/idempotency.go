@@ -0,0 +1,217 @@
+package api
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"glooko/internal/auth"
+	"glooko/internal/domain"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+
+	// idempotencyTTL is how long a response is replayed for retries of its request.
+	idempotencyTTL = 24 * time.Hour
+
+	// maxIdempotencyKeys caps the remembered responses, the oldest completed are forgotten first.
+	maxIdempotencyKeys = 10000
+
+	// idempotencyRetryAfter is the Retry-After, in seconds, sent while the cache is full.
+	idempotencyRetryAfter = "5"
+
+	// maxIdempotencyKeyLength caps the length of a client's key.
+	maxIdempotencyKeyLength = 255
+)
+
+// errIdempotencyKeysPending is returned when every remembered key belongs to a running request.
+var errIdempotencyKeysPending = errors.New("too many requests with an idempotency key in progress")
+
+// idempotentResponse is a response remembered for an idempotency key. done is closed once the
+// first request with the key completed, the other fields are set by then.
+type idempotentResponse struct {
+	key         string
+	fingerprint [sha256.Size]byte
+	created     time.Time
+	done        chan struct{}
+
+	status      int
+	contentType string
+	body        []byte
+}
+
+// idempotencyCache remembers the responses of requests sent with an idempotency key. It lives in
+// the process, retries reaching another instance are still safe because ingestion itself is
+// idempotent on device and time, they only run the request again.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Keys oldest first
+}
+
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// begin returns the response remembered for key, or registers a new pending one when the key is
+// unknown or expired, reporting whether it did. Pending responses are never forgotten to make
+// room, when every remembered key is pending begin fails with errIdempotencyKeysPending.
+func (c *idempotencyCache) begin(key string, fingerprint [sha256.Size]byte, now time.Time) (*idempotentResponse, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for front := c.order.Front(); front != nil; front = c.order.Front() {
+		if now.Sub(front.Value.(*idempotentResponse).created) < idempotencyTTL {
+			break
+		}
+		c.remove(front)
+	}
+
+	if element, ok := c.entries[key]; ok {
+		return element.Value.(*idempotentResponse), false, nil
+	}
+
+	if c.order.Len() >= maxIdempotencyKeys && !c.removeOldestDone() {
+		return nil, false, errIdempotencyKeysPending
+	}
+
+	response := &idempotentResponse{key: key, fingerprint: fingerprint, created: now, done: make(chan struct{})}
+	c.entries[key] = c.order.PushBack(response)
+	return response, true, nil
+}
+
+// removeOldestDone forgets the oldest completed response, reporting whether there was one.
+func (c *idempotencyCache) removeOldestDone() bool {
+	for element := c.order.Front(); element != nil; element = element.Next() {
+		select {
+		case <-element.Value.(*idempotentResponse).done:
+			c.remove(element)
+			return true
+		default:
+		}
+	}
+	return false
+}
+
+// forget drops the response remembered for key so the request can be retried.
+func (c *idempotencyCache) forget(key string, response *idempotentResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok && element.Value == response {
+		c.remove(element)
+	}
+}
+
+func (c *idempotencyCache) remove(element *list.Element) {
+	delete(c.entries, element.Value.(*idempotentResponse).key)
+	c.order.Remove(element)
+}
+
+// IdempotencyMiddleware makes batch uploads safe to retry. The response to a request carrying an
+// Idempotency-Key header is remembered for a day and replayed, flagged by an Idempotent-Replayed
+// header, to retries with the same key and body from the same caller. Reusing a key for another
+// body fails, as does a retry while the first request is still running. Server errors are not
+// remembered so the request can be retried. While every remembered key is still running new keys
+// are turned away with a Retry-After header.
+func (api *API) IdempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		log := api.log.With("method", "IdempotencyMiddleware")
+
+		if len(key) > maxIdempotencyKeyLength {
+			err := errors.Wrapf(domain.ErrInvalidInput, "%s exceeds %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength)
+			log.Errorf("invalid idempotency key: %v", err)
+			respondWithError(w, r, err)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+		if err != nil {
+			log.Errorf("failed to read request body: %v", err)
+			respondWithError(w, r, invalidInput("request body", err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Keys are scoped to the caller and the endpoint, the body must match on retries
+		principal, _ := auth.PrincipalFrom(r.Context())
+		scopedKey := principal.Subject + " " + r.Method + " " + r.URL.Path + " " + key
+		fingerprint := sha256.Sum256(body)
+
+		response, first, err := api.idempotency.begin(scopedKey, fingerprint, time.Now())
+		if err != nil {
+			log.Errorf("failed to register idempotency key: %v", err)
+			w.Header().Set("Retry-After", idempotencyRetryAfter)
+			respondWithError(w, r, err)
+			return
+		}
+		if !first {
+			if response.fingerprint != fingerprint {
+				err := errors.Wrapf(domain.ErrInvalidInput, "%s %q was used for a different request", idempotencyKeyHeader, key)
+				log.Errorf("idempotency key reused: %v", err)
+				respondWithError(w, r, err)
+				return
+			}
+
+			select {
+			case <-response.done:
+			default:
+				err := errors.Wrapf(domain.ErrConflict, "a request with %s %q is still in progress", idempotencyKeyHeader, key)
+				log.Errorf("idempotency key in use: %v", err)
+				respondWithError(w, r, err)
+				return
+			}
+
+			if response.contentType != "" {
+				w.Header().Set("Content-Type", response.contentType)
+			}
+			w.Header().Set(idempotencyReplayedHeader, "true")
+			w.WriteHeader(response.status)
+			w.Write(response.body)
+			return
+		}
+
+		recorder := &responseRecorder{wrapResponseWriter: NewWrapResponseWriter(w, r.ProtoMajor)}
+		completed := false
+		defer func() {
+			// Requests that failed on the server side or panicked may be retried
+			if !completed || recorder.Status() >= http.StatusInternalServerError {
+				api.idempotency.forget(scopedKey, response)
+			}
+			response.status = recorder.Status()
+			response.contentType = recorder.Header().Get("Content-Type")
+			response.body = recorder.body.Bytes()
+			close(response.done)
+		}()
+
+		next.ServeHTTP(recorder, r)
+		completed = true
+	})
+}
+
+// responseRecorder keeps a copy of the response body it writes.
+type responseRecorder struct {
+	*wrapResponseWriter
+	body bytes.Buffer
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.body.Write(b)
+	return rr.wrapResponseWriter.Write(b)
+}
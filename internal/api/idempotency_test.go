@@ -0,0 +1,240 @@
+package api
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+	"glooko/internal/mocks"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	userID := "1234567890abcdef12345678"
+	deviceID := "abcdef1234567890abcdef12"
+	timestamp := time.Date(2024, 4, 6, 8, 0, 0, 0, time.UTC)
+	body := `{"time":"2024-04-06T08:00:00Z","value":120}`
+
+	type request struct {
+		key          string
+		body         string
+		expectCode   int
+		expectReplay bool
+	}
+
+	testCases := []struct {
+		name        string
+		setupMock   func(readingsRepo *mocks.ReadingRepository)
+		setupCache  func(cache *idempotencyCache)
+		requests    []request
+		expectAdded int
+	}{
+		{
+			name: "Retry Is Replayed",
+			requests: []request{
+				{key: "upload-1", body: body, expectCode: http.StatusCreated},
+				{key: "upload-1", body: body, expectCode: http.StatusCreated, expectReplay: true},
+			},
+			expectAdded: 1,
+		},
+		{
+			name: "Without Key",
+			requests: []request{
+				{body: body, expectCode: http.StatusCreated},
+				{body: body, expectCode: http.StatusCreated},
+			},
+			expectAdded: 2,
+		},
+		{
+			name: "Different Keys",
+			requests: []request{
+				{key: "upload-1", body: body, expectCode: http.StatusCreated},
+				{key: "upload-2", body: body, expectCode: http.StatusCreated},
+			},
+			expectAdded: 2,
+		},
+		{
+			name: "Key Reused For Another Body",
+			requests: []request{
+				{key: "upload-1", body: body, expectCode: http.StatusCreated},
+				{key: "upload-1", body: `{"time":"2024-04-06T08:05:00Z","value":125}`, expectCode: http.StatusBadRequest},
+			},
+			expectAdded: 1,
+		},
+		{
+			name: "Client Error Is Replayed",
+			requests: []request{
+				{key: "upload-1", body: `[]`, expectCode: http.StatusBadRequest},
+				{key: "upload-1", body: `[]`, expectCode: http.StatusBadRequest, expectReplay: true},
+			},
+		},
+		{
+			name: "Server Error Is Retried",
+			setupMock: func(readingsRepo *mocks.ReadingRepository) {
+				readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, []domain.DeviceReading{
+					{DeviceID: deviceID, Time: timestamp, Value: 120},
+				}).Return(nil, errors.New("boom")).Once()
+			},
+			requests: []request{
+				{key: "upload-1", body: body, expectCode: http.StatusInternalServerError},
+				{key: "upload-1", body: body, expectCode: http.StatusCreated},
+			},
+			expectAdded: 2,
+		},
+		{
+			name: "Key Too Long",
+			requests: []request{
+				{key: strings.Repeat("k", maxIdempotencyKeyLength+1), body: body, expectCode: http.StatusBadRequest},
+			},
+		},
+		{
+			name: "Cache Full Of Pending Requests",
+			setupCache: func(cache *idempotencyCache) {
+				fingerprint := sha256.Sum256([]byte(body))
+				for i := 0; i < maxIdempotencyKeys; i++ {
+					cache.begin(fmt.Sprintf("pending-%d", i), fingerprint, time.Now())
+				}
+			},
+			requests: []request{
+				{key: "upload-1", body: body, expectCode: http.StatusServiceUnavailable},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+			if tc.setupMock != nil {
+				tc.setupMock(readingsRepo)
+			}
+			if tc.setupCache != nil {
+				tc.setupCache(apiInstance.idempotency)
+			}
+			readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, mock.Anything).Return([]error{nil}, nil)
+			readingsRepo.On("FetchReadings", mock.Anything, userID, mock.Anything, mock.Anything).Return([]domain.Reading{}, nil).Maybe()
+
+			userObjectID, _ := primitive.ObjectIDFromHex(userID)
+			deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+			deviceRepo.On("FindByID", mock.Anything, deviceID).Return(domain.Device{UserID: userObjectID}, nil).Maybe()
+			userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+			userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID}, nil).Maybe()
+			eventRepo := apiInstance.eventRepo.(*mocks.EventRepository)
+			eventRepo.On("ReplaceEvents", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+			var firstBody string
+			for i, step := range tc.requests {
+				url := fmt.Sprintf("/users/%s/devices/%s/readings", userID, deviceID)
+				req, err := http.NewRequest("POST", url, strings.NewReader(step.body))
+				assert.NoError(t, err)
+				if step.key != "" {
+					req.Header.Set(idempotencyKeyHeader, step.key)
+				}
+
+				w := serve(apiInstance, req)
+
+				assert.Equal(t, step.expectCode, w.Code, "request %d", i)
+				if step.expectCode == http.StatusServiceUnavailable {
+					assert.Equal(t, idempotencyRetryAfter, w.Header().Get("Retry-After"))
+				}
+				if step.expectReplay {
+					assert.Equal(t, "true", w.Header().Get(idempotencyReplayedHeader))
+					assert.Equal(t, firstBody, w.Body.String())
+				} else {
+					assert.Empty(t, w.Header().Get(idempotencyReplayedHeader))
+				}
+				if i == 0 {
+					firstBody = w.Body.String()
+				}
+			}
+
+			readingsRepo.AssertNumberOfCalls(t, "AddReadingsAndUpdateStats", tc.expectAdded)
+		})
+	}
+}
+
+func TestIdempotencyCache(t *testing.T) {
+	now := time.Date(2024, 4, 6, 8, 0, 0, 0, time.UTC)
+	fingerprint := sha256.Sum256([]byte("body"))
+
+	t.Run("Pending Until Done", func(t *testing.T) {
+		cache := newIdempotencyCache()
+		first, isNew, err := cache.begin("key", fingerprint, now)
+		assert.NoError(t, err)
+		assert.True(t, isNew)
+
+		second, isNew, err := cache.begin("key", fingerprint, now)
+		assert.NoError(t, err)
+		assert.False(t, isNew)
+		assert.Same(t, first, second)
+	})
+
+	t.Run("Expires", func(t *testing.T) {
+		cache := newIdempotencyCache()
+		first, _, _ := cache.begin("key", fingerprint, now)
+
+		second, isNew, err := cache.begin("key", fingerprint, now.Add(idempotencyTTL))
+		assert.NoError(t, err)
+		assert.True(t, isNew)
+		assert.NotSame(t, first, second)
+	})
+
+	t.Run("Forgets Oldest Done Beyond Capacity", func(t *testing.T) {
+		cache := newIdempotencyCache()
+		for i := 0; i < maxIdempotencyKeys; i++ {
+			response, _, _ := cache.begin(fmt.Sprintf("key-%d", i), fingerprint, now)
+			if i > 0 && i%2 == 0 {
+				close(response.done)
+			}
+		}
+
+		_, isNew, err := cache.begin("one-more", fingerprint, now)
+		assert.NoError(t, err)
+		assert.True(t, isNew)
+		assert.Equal(t, maxIdempotencyKeys, cache.order.Len())
+
+		// key-0 and key-1 are still pending, key-2 was the oldest done
+		_, isNew, _ = cache.begin("key-0", fingerprint, now)
+		assert.False(t, isNew)
+		_, isNew, _ = cache.begin("key-1", fingerprint, now)
+		assert.False(t, isNew)
+		_, isNew, err = cache.begin("key-2", fingerprint, now)
+		assert.NoError(t, err)
+		assert.True(t, isNew)
+	})
+
+	t.Run("Full Of Pending", func(t *testing.T) {
+		cache := newIdempotencyCache()
+		for i := 0; i < maxIdempotencyKeys; i++ {
+			cache.begin(fmt.Sprintf("key-%d", i), fingerprint, now)
+		}
+
+		response, isNew, err := cache.begin("one-more", fingerprint, now)
+		assert.ErrorIs(t, err, errIdempotencyKeysPending)
+		assert.Nil(t, response)
+		assert.False(t, isNew)
+		assert.Equal(t, maxIdempotencyKeys, cache.order.Len())
+
+		// A retry of a pending request still finds it
+		_, isNew, err = cache.begin("key-0", fingerprint, now)
+		assert.NoError(t, err)
+		assert.False(t, isNew)
+	})
+
+	t.Run("Forget", func(t *testing.T) {
+		cache := newIdempotencyCache()
+		first, _, _ := cache.begin("key", fingerprint, now)
+		cache.forget("key", first)
+
+		_, isNew, _ := cache.begin("key", fingerprint, now)
+		assert.True(t, isNew)
+	})
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"glooko/internal/importer"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+)
+
+// maxImportSize caps uploaded exports, a 90 day CGM export is a few megabytes.
+const maxImportSize = 32 << 20
+
+// ImportParams identifies the user an export is imported for.
+type ImportParams struct {
+	ID string `validate:"required,mongodb"`
+}
+
+// ImportReadings stores a Dexcom Clarity or LibreView CSV export for the user. The export is sent
+// either as the raw request body or as the "file" field of a multipart form.
+func (api *API) ImportReadings(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "ImportReadings")
+
+	params := ImportParams{
+		ID: chi.URLParam(r, "id"),
+	}
+
+	err := api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, _, err := api.findUserWithLocation(ctx, params.ID)
+	if err != nil {
+		log.Errorf("failed to fetch user: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	body, err := importBody(w, r)
+	if err != nil {
+		log.Errorf("invalid request body: %v", err)
+		respondWithError(w, r, invalidInput("request body", err))
+		return
+	}
+	defer body.Close()
+
+	summary, err := importer.NewImporter(api.deviceRepo, api.readingsRepo, api.detector).Import(ctx, user, body)
+	if errors.Is(err, importer.ErrEventDetection) {
+		log.Errorf("%v", err)
+	} else if err != nil {
+		log.Errorf("failed to import readings: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if summary.Failed > 0 {
+		log.Errorf("failed to store %d readings", summary.Failed)
+		status = http.StatusMultiStatus
+	}
+	respondWithStatus(w, status, summary)
+}
+
+// importBody returns the uploaded export, read from the "file" form field for multipart requests.
+func importBody(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return r.Body, nil
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
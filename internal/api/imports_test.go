@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+	"glooko/internal/importer"
+	"glooko/internal/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const clarityExport = `Index,Timestamp (YYYY-MM-DDThh:mm:ss),Event Type,Event Subtype,Patient Info,Device Info,Source Device ID,Glucose Value (mg/dL),Transmitter ID
+1,2024-04-06T08:00:00,EGV,,,,Receiver,110,8ABCDE
+2,2024-04-06T08:05:00,EGV,,,,Receiver,bad,8ABCDE
+`
+
+func TestImportReadings(t *testing.T) {
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	device := domain.Device{ID: primitive.NewObjectID(), UserID: userObjectID, Manufacturer: "Dexcom", SerialNumber: "8ABCDE"}
+
+	multipartBody := func() (*bytes.Buffer, string) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", "clarity.csv")
+		part.Write([]byte(clarityExport))
+		writer.Close()
+		return body, writer.FormDataContentType()
+	}
+
+	testCases := []struct {
+		name        string
+		body        func() (*bytes.Buffer, string)
+		expectCode  int
+		expectStore bool
+	}{
+		{
+			name: "Raw Body",
+			body: func() (*bytes.Buffer, string) {
+				return bytes.NewBufferString(clarityExport), "text/csv"
+			},
+			expectCode:  http.StatusCreated,
+			expectStore: true,
+		},
+		{
+			name:        "Multipart Upload",
+			body:        multipartBody,
+			expectCode:  http.StatusCreated,
+			expectStore: true,
+		},
+		{
+			name: "Unknown Format",
+			body: func() (*bytes.Buffer, string) {
+				return bytes.NewBufferString("time,value\n"), "text/csv"
+			},
+			expectCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+			deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+			readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+
+			userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID}, nil)
+			deviceRepo.On("FindByUser", mock.Anything, userID).Return([]domain.Device{device}, nil).Maybe()
+			readingsRepo.On("FetchReadings", mock.Anything, userID, mock.Anything, mock.Anything).Return([]domain.Reading{}, nil).Maybe()
+			readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, []domain.DeviceReading{
+				{DeviceID: device.ID.Hex(), Time: time.Date(2024, 4, 6, 8, 0, 0, 0, time.UTC), Value: 110},
+			}).Return([]error{nil}, nil).Maybe()
+			apiInstance.eventRepo.(*mocks.EventRepository).On("ReplaceEvents", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+			body, contentType := tc.body()
+			req, err := http.NewRequest("POST", fmt.Sprintf("/users/%s/imports", userID), body)
+			assert.NoError(t, err)
+			req.Header.Set("Content-Type", contentType)
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, tc.expectCode, w.Code)
+
+			if tc.expectStore {
+				var summary importer.Summary
+				err = json.NewDecoder(w.Body).Decode(&summary)
+				assert.NoError(t, err)
+				assert.Equal(t, importer.FormatDexcomClarity, summary.Format)
+				assert.Equal(t, 1, summary.Accepted)
+				assert.Equal(t, 1, summary.Rejected)
+				readingsRepo.AssertNumberOfCalls(t, "AddReadingsAndUpdateStats", 1)
+			} else {
+				var problem Problem
+				err = json.NewDecoder(w.Body).Decode(&problem)
+				assert.NoError(t, err)
+				assert.Equal(t, "invalid_file", problem.Code)
+			}
+		})
+	}
+}
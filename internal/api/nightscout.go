@@ -0,0 +1,504 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"glooko/internal/auth"
+	"glooko/internal/domain"
+	"glooko/internal/importer"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	// nightscoutManufacturer marks devices created for uploads arriving through the Nightscout facade
+	nightscoutManufacturer = "Nightscout"
+
+	defaultNightscoutCount = 10
+	maxNightscoutDays      = 90
+
+	// nightscoutWindow is searched for the latest entries when no date filter is given
+	nightscoutWindow = 7 * 24 * time.Hour
+
+	// nightscoutDirectionGap is the longest gap between readings a trend direction is computed over
+	nightscoutDirectionGap = 15 * time.Minute
+
+	// nightscoutSecretBytes is the entropy of a generated API_SECRET
+	nightscoutSecretBytes = 24
+)
+
+// NightscoutEntry is a glucose entry in the Nightscout v1 format. Values are always mg/dL.
+type NightscoutEntry struct {
+	ID         string `json:"_id,omitempty"`
+	Type       string `json:"type"`
+	SGV        int    `json:"sgv,omitempty"`
+	Date       int64  `json:"date"` // Milliseconds since the epoch
+	DateString string `json:"dateString,omitempty"`
+	UTCOffset  int    `json:"utcOffset"` // Minutes
+	Direction  string `json:"direction,omitempty"`
+	Device     string `json:"device,omitempty"`
+}
+
+// NightscoutParams identifies the user a Nightscout site is served for.
+type NightscoutParams struct {
+	ID    string `validate:"required,mongodb"`
+	Count int    `validate:"min=1,max=10000"`
+}
+
+// NightscoutSecretResponse carries a newly issued API_SECRET, it cannot be retrieved again.
+type NightscoutSecretResponse struct {
+	APISecret string `json:"apiSecret"`
+	URL       string `json:"url"` // Path of the user's Nightscout site
+}
+
+func (api *API) nightscoutRoutes(r chi.Router) {
+	r.Use(api.AuditMiddleware)
+	r.Use(api.NightscoutAuthMiddleware)
+	r.Get("/entries", api.GetNightscoutEntries)
+	r.Get("/entries.json", api.GetNightscoutEntries)
+	r.Post("/entries", api.AddNightscoutEntries)
+	r.Post("/entries.json", api.AddNightscoutEntries)
+}
+
+// NightscoutAuthMiddleware checks the api-secret header, which Nightscout clients set to the SHA1
+// hex digest of the site's API secret, against the secret issued to the user of the site. The
+// secret query parameter is accepted for followers that cannot set headers. Sites of unknown users
+// and of users without a secret are refused like a wrong secret.
+func (api *API) NightscoutAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := api.log.With("method", "NightscoutAuthMiddleware")
+		userID := chi.URLParam(r, "id")
+
+		provided := r.Header.Get("api-secret")
+		if provided == "" {
+			provided = r.URL.Query().Get("secret")
+		}
+
+		user, err := api.userRepo.FindByID(r.Context(), userID)
+		if err != nil && !errors.Is(err, domain.ErrNotFound) && !errors.Is(err, domain.ErrInvalidID) {
+			log.Errorf("failed to find user: %v", err)
+			respondWithError(w, r, err)
+			return
+		}
+
+		hash := []byte(nightscoutSecretHash(provided))
+		if user.NightscoutSecretHash == "" || subtle.ConstantTimeCompare(hash, []byte(user.NightscoutSecretHash)) != 1 {
+			log.Errorf("invalid api-secret for %s", r.URL.Path)
+			respondWithError(w, r, auth.ErrUnauthenticated)
+			return
+		}
+
+		setAuditActor(r, nightscoutActor+":"+userID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RotateNightscoutSecret issues a new API_SECRET for the user's Nightscout site, replacing the one
+// issued before. Only its hash is stored, so the secret is returned this once.
+func (api *API) RotateNightscoutSecret(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "RotateNightscoutSecret")
+	userID := chi.URLParam(r, "id")
+
+	err := api.validate.Var(userID, "required,mongodb")
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	secret, err := newNightscoutSecret()
+	if err != nil {
+		log.Errorf("failed to generate secret: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	digest := sha1.Sum([]byte(secret))
+	hash := nightscoutSecretHash(hex.EncodeToString(digest[:]))
+	_, err = api.userRepo.Update(r.Context(), userID, domain.UserUpdate{NightscoutSecretHash: &hash})
+	if err != nil {
+		log.Errorf("failed to store secret: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithStatus(w, http.StatusCreated, NightscoutSecretResponse{
+		APISecret: secret,
+		URL:       "/nightscout/" + userID,
+	})
+}
+
+// DeleteNightscoutSecret revokes the user's API_SECRET, disabling their Nightscout site.
+func (api *API) DeleteNightscoutSecret(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "DeleteNightscoutSecret")
+	userID := chi.URLParam(r, "id")
+
+	err := api.validate.Var(userID, "required,mongodb")
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	hash := ""
+	_, err = api.userRepo.Update(r.Context(), userID, domain.UserUpdate{NightscoutSecretHash: &hash})
+	if err != nil {
+		log.Errorf("failed to revoke secret: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newNightscoutSecret generates a random API_SECRET, hex encoded so uploaders accept it.
+func newNightscoutSecret() (string, error) {
+	secret := make([]byte, nightscoutSecretBytes)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read random bytes")
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// nightscoutSecretHash hashes the SHA1 hex digest uploaders present for an API_SECRET, the digest
+// authenticates on its own so it is not stored as is.
+func nightscoutSecretHash(digest string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(digest)))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetNightscoutEntries returns the latest sgv entries, newest first. The count parameter limits the
+// number of entries and find[date][$gte], $gt, $lte and $lt filter on the date in milliseconds.
+// Without a filter the last 7 days are searched.
+func (api *API) GetNightscoutEntries(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "GetNightscoutEntries")
+
+	count, err := queryInt(r, "count", defaultNightscoutCount)
+	if err != nil {
+		log.Errorf("invalid count: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	params := NightscoutParams{
+		ID:    chi.URLParam(r, "id"),
+		Count: count,
+	}
+
+	err = api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	from, to, err := parseNightscoutFind(r, time.Now())
+	if err != nil {
+		log.Errorf("invalid find: %v", err)
+		respondWithError(w, r, invalidRange("find", err))
+		return
+	}
+
+	ctx := r.Context()
+	_, loc, err := api.findUserWithLocation(ctx, params.ID)
+	if err != nil {
+		log.Errorf("failed to fetch user: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	// A reading a few minutes before from is fetched too so the first entry has a direction
+	startDay, endDay := bucketRange(domain.DayOf(from.Add(-nightscoutDirectionGap).In(loc)), domain.DayOf(to.In(loc)))
+	readings, err := api.readingsRepo.FetchReadings(ctx, params.ID, startDay, endDay.AddDate(0, 0, 1).Add(-time.Nanosecond))
+	if err != nil {
+		log.Errorf("failed to fetch readings: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	devices, err := api.deviceRepo.FindByUser(ctx, params.ID)
+	if err != nil {
+		log.Errorf("failed to fetch devices: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	deviceNames := make(map[string]string, len(devices))
+	for _, device := range devices {
+		deviceNames[device.ID.Hex()] = device.SerialNumber
+	}
+
+	entries := toNightscoutEntries(readings, deviceNames, loc, from, to)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date > entries[j].Date
+	})
+	if len(entries) > params.Count {
+		entries = entries[:params.Count]
+	}
+
+	respondWithJSON(w, entries)
+}
+
+// AddNightscoutEntries stores sgv entries pushed by uploaders. Other entry types, such as meter
+// readings and calibrations, are ignored. Entries are attached to a device named after the
+// uploader's device field, entries already stored are skipped so uploaders can safely retry.
+func (api *API) AddNightscoutEntries(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "AddNightscoutEntries")
+
+	params := NightscoutParams{
+		ID:    chi.URLParam(r, "id"),
+		Count: defaultNightscoutCount,
+	}
+
+	err := api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	entries, err := decodeNightscoutEntries(w, r)
+	if err != nil {
+		log.Errorf("invalid request body: %v", err)
+		respondWithError(w, r, invalidInput("request body", err))
+		return
+	}
+
+	ctx := r.Context()
+	user, _, err := api.findUserWithLocation(ctx, params.ID)
+	if err != nil {
+		log.Errorf("failed to fetch user: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	devices, accepted, err := groupNightscoutEntries(entries)
+	if err != nil {
+		log.Errorf("invalid entry: %v", err)
+		respondWithError(w, r, invalidInput("entry", err))
+		return
+	}
+
+	summary, err := importer.NewImporter(api.deviceRepo, api.readingsRepo, api.detector).Store(ctx, user, devices)
+	if errors.Is(err, importer.ErrEventDetection) {
+		log.Errorf("%v", err)
+	} else if err != nil {
+		log.Errorf("failed to store entries: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	// Uploaders only retry failed requests, the entries stored already are skipped on the retry
+	if summary.Failed > 0 {
+		err = fmt.Errorf("failed to store %d of %d entries", summary.Failed, len(accepted))
+		log.Errorf("%v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, accepted)
+}
+
+// decodeNightscoutEntries accepts either a single entry or an array of entries.
+func decodeNightscoutEntries(w http.ResponseWriter, r *http.Request) ([]NightscoutEntry, error) {
+	var raw json.RawMessage
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&raw)
+	if err != nil {
+		return nil, err
+	}
+
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '[' {
+		var entries []NightscoutEntry
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return nil, err
+		}
+		return entries, nil
+	}
+
+	var entry NightscoutEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, err
+	}
+	return []NightscoutEntry{entry}, nil
+}
+
+// groupNightscoutEntries maps sgv entries onto readings per uploader device and returns the entries
+// that were kept. Entries without a date fall back to their dateString.
+func groupNightscoutEntries(entries []NightscoutEntry) ([]importer.DeviceReadings, []NightscoutEntry, error) {
+	var devices []importer.DeviceReadings
+	byName := map[string]int{}
+	accepted := []NightscoutEntry{}
+
+	for _, entry := range entries {
+		if entry.Type != "sgv" {
+			continue
+		}
+		if entry.SGV <= 0 {
+			return nil, nil, fmt.Errorf("sgv must be positive, got %d", entry.SGV)
+		}
+
+		timestamp := time.UnixMilli(entry.Date).UTC()
+		if entry.Date <= 0 {
+			parsed, err := time.Parse(time.RFC3339, entry.DateString)
+			if err != nil {
+				return nil, nil, fmt.Errorf("entry has neither a date nor a valid dateString")
+			}
+			timestamp = parsed.UTC()
+			entry.Date = timestamp.UnixMilli()
+		}
+
+		name := entry.Device
+		if name == "" {
+			name = "nightscout"
+		}
+
+		i, ok := byName[name]
+		if !ok {
+			i = len(devices)
+			byName[name] = i
+			devices = append(devices, importer.DeviceReadings{
+				Device: domain.Device{Manufacturer: nightscoutManufacturer, Model: name, SerialNumber: name},
+			})
+		}
+		devices[i].Entries = append(devices[i].Entries, domain.ReadingEntry{Time: timestamp, Value: entry.SGV})
+		accepted = append(accepted, entry)
+	}
+
+	for _, device := range devices {
+		sort.SliceStable(device.Entries, func(i, j int) bool {
+			return device.Entries[i].Time.Before(device.Entries[j].Time)
+		})
+	}
+
+	return devices, accepted, nil
+}
+
+// toNightscoutEntries maps the readings taken in [from, to] onto sgv entries. The trend direction is
+// derived from the previous reading of the same device.
+func toNightscoutEntries(readings []domain.Reading, deviceNames map[string]string, loc *time.Location, from, to time.Time) []NightscoutEntry {
+	byDevice := map[string][]domain.ReadingEntry{}
+	for _, reading := range readings {
+		deviceID := reading.DeviceID.Hex()
+		byDevice[deviceID] = append(byDevice[deviceID], reading.Readings...)
+	}
+
+	entries := []NightscoutEntry{}
+	for deviceID, readingEntries := range byDevice {
+		sort.SliceStable(readingEntries, func(i, j int) bool {
+			return readingEntries[i].Time.Before(readingEntries[j].Time)
+		})
+
+		for i, entry := range readingEntries {
+			if entry.Time.Before(from) || entry.Time.After(to) {
+				continue
+			}
+
+			direction := "NONE"
+			if i > 0 {
+				direction = nightscoutDirection(readingEntries[i-1], entry)
+			}
+
+			local := entry.Time.In(loc)
+			_, offset := local.Zone()
+			entries = append(entries, NightscoutEntry{
+				ID:         deviceID + "-" + strconv.FormatInt(entry.Time.UnixMilli(), 10),
+				Type:       "sgv",
+				SGV:        entry.Value,
+				Date:       entry.Time.UnixMilli(),
+				DateString: local.Format("2006-01-02T15:04:05.000Z07:00"),
+				UTCOffset:  offset / 60,
+				Direction:  direction,
+				Device:     deviceNames[deviceID],
+			})
+		}
+	}
+
+	return entries
+}
+
+// nightscoutDirection classifies the rate of change between two readings into a Nightscout trend arrow.
+func nightscoutDirection(previous, current domain.ReadingEntry) string {
+	elapsed := current.Time.Sub(previous.Time)
+	if elapsed <= 0 || elapsed > nightscoutDirectionGap {
+		return "NONE"
+	}
+
+	rate := float64(current.Value-previous.Value) / elapsed.Minutes() // mg/dL per minute
+	switch {
+	case rate > 3:
+		return "DoubleUp"
+	case rate > 2:
+		return "SingleUp"
+	case rate > 1:
+		return "FortyFiveUp"
+	case rate >= -1:
+		return "Flat"
+	case rate >= -2:
+		return "FortyFiveDown"
+	case rate >= -3:
+		return "SingleDown"
+	}
+	return "DoubleDown"
+}
+
+// parseNightscoutFind reads the find[date] filter. Missing bounds default to now and a week before
+// the upper bound, ranges longer than 90 days are rejected.
+func parseNightscoutFind(r *http.Request, now time.Time) (from, to time.Time, err error) {
+	query := r.URL.Query()
+
+	bounds := []struct {
+		key    string
+		offset time.Duration
+		lower  bool
+	}{
+		{key: "find[date][$gte]", lower: true},
+		{key: "find[date][$gt]", offset: time.Millisecond, lower: true},
+		{key: "find[date][$lte]"},
+		{key: "find[date][$lt]", offset: -time.Millisecond},
+	}
+
+	for _, bound := range bounds {
+		value := query.Get(bound.key)
+		if value == "" {
+			continue
+		}
+
+		millis, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%s must be milliseconds since the epoch", bound.key)
+		}
+
+		instant := time.UnixMilli(millis).Add(bound.offset)
+		if bound.lower {
+			from = instant
+		} else {
+			to = instant
+		}
+	}
+
+	if to.IsZero() {
+		to = now
+	}
+	if from.IsZero() {
+		from = to.Add(-nightscoutWindow)
+	}
+	if to.Sub(from) > maxNightscoutDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("range exceeds %d days", maxNightscoutDays)
+	}
+
+	return from, to, nil
+}
@@ -0,0 +1,323 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"glooko/internal/auth"
+	"glooko/internal/domain"
+	"glooko/internal/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const nightscoutTestSecret = "test-api-secret"
+
+// nightscoutTestHash is the stored hash of nightscoutTestSecret.
+var nightscoutTestHash = nightscoutSecretHash(nightscoutSecretHeader(nightscoutTestSecret))
+
+func nightscoutSecretHeader(secret string) string {
+	digest := sha1.Sum([]byte(secret))
+	return hex.EncodeToString(digest[:])
+}
+
+func TestNightscoutAuth(t *testing.T) {
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	otherUserID := "abcdef1234567890abcdef12"
+	otherUserObjectID, _ := primitive.ObjectIDFromHex(otherUserID)
+	otherSecretHash := nightscoutSecretHash(nightscoutSecretHeader("another-secret"))
+
+	testCases := []struct {
+		name       string
+		userID     string
+		header     string
+		query      string
+		expectCode int
+	}{
+		{name: "Missing Secret", userID: userID, expectCode: http.StatusUnauthorized},
+		{name: "Wrong Secret", userID: userID, header: nightscoutSecretHeader("another-secret"), expectCode: http.StatusUnauthorized},
+		{name: "Plain Secret", userID: userID, header: nightscoutTestSecret, expectCode: http.StatusUnauthorized},
+		{name: "Stored Hash", userID: userID, header: nightscoutTestHash, expectCode: http.StatusUnauthorized},
+		{name: "Other User's Site", userID: otherUserID, header: nightscoutSecretHeader(nightscoutTestSecret), expectCode: http.StatusUnauthorized},
+		{name: "No Secret Issued", userID: "aaaaaaaaaaaaaaaaaaaaaaaa", header: nightscoutSecretHeader(""), expectCode: http.StatusUnauthorized},
+		{name: "Unknown User", userID: "bbbbbbbbbbbbbbbbbbbbbbbb", header: nightscoutSecretHeader(nightscoutTestSecret), expectCode: http.StatusUnauthorized},
+		{name: "Invalid User ID", userID: "invalid", header: nightscoutSecretHeader(nightscoutTestSecret), expectCode: http.StatusUnauthorized},
+		{name: "Query Secret", userID: userID, query: "?secret=" + nightscoutSecretHeader(nightscoutTestSecret), expectCode: http.StatusBadRequest},
+		{name: "Header Secret", userID: userID, header: nightscoutSecretHeader(nightscoutTestSecret), expectCode: http.StatusBadRequest},
+		{name: "Uppercase Header Secret", userID: userID, header: strings.ToUpper(nightscoutSecretHeader(nightscoutTestSecret)), expectCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+			userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID, NightscoutSecretHash: nightscoutTestHash}, nil).Maybe()
+			userRepo.On("FindByID", mock.Anything, otherUserID).Return(domain.User{ID: otherUserObjectID, NightscoutSecretHash: otherSecretHash}, nil).Maybe()
+			userRepo.On("FindByID", mock.Anything, "aaaaaaaaaaaaaaaaaaaaaaaa").Return(domain.User{ID: primitive.NewObjectID()}, nil).Maybe()
+			userRepo.On("FindByID", mock.Anything, "bbbbbbbbbbbbbbbbbbbbbbbb").Return(domain.User{}, domain.ErrNotFound).Maybe()
+			userRepo.On("FindByID", mock.Anything, "invalid").Return(domain.User{}, domain.ErrInvalidID).Maybe()
+
+			// An authenticated request gets as far as validating the body
+			req, err := http.NewRequest("POST", fmt.Sprintf("/nightscout/%s/api/v1/entries%s", tc.userID, tc.query), bytes.NewBufferString("{"))
+			assert.NoError(t, err)
+			if tc.header != "" {
+				req.Header.Set("api-secret", tc.header)
+			}
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, tc.expectCode, w.Code)
+		})
+	}
+}
+
+func TestNightscoutAuth_StoreFailure(t *testing.T) {
+	apiInstance := setupAPI()
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+
+	userID := "1234567890abcdef12345678"
+	userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{}, errors.New("connection refused"))
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("/nightscout/%s/api/v1/entries", userID), nil)
+	assert.NoError(t, err)
+	req.Header.Set("api-secret", nightscoutSecretHeader(nightscoutTestSecret))
+
+	w := serve(apiInstance, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestRotateNightscoutSecret(t *testing.T) {
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+
+	testCases := []struct {
+		name       string
+		userID     string
+		token      string
+		updateErr  error
+		expectCode int
+	}{
+		{name: "Admin", userID: userID, token: testToken("admin-1", auth.RoleAdmin), expectCode: http.StatusCreated},
+		{name: "Own Site", userID: userID, token: testToken(userID, auth.RolePatient), expectCode: http.StatusCreated},
+		{name: "Other Patient", userID: userID, token: testToken("abcdef1234567890abcdef12", auth.RolePatient), expectCode: http.StatusForbidden},
+		{name: "Invalid ID", userID: "invalid", token: testToken("admin-1", auth.RoleAdmin), expectCode: http.StatusBadRequest},
+		{name: "User Not Found", userID: userID, token: testToken("admin-1", auth.RoleAdmin), updateErr: domain.ErrNotFound, expectCode: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+			userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID}, nil).Maybe()
+
+			var storedHash string
+			userRepo.On("Update", mock.Anything, userID, mock.Anything).Run(func(args mock.Arguments) {
+				storedHash = *args.Get(2).(domain.UserUpdate).NightscoutSecretHash
+			}).Return(domain.User{ID: userObjectID}, tc.updateErr).Maybe()
+
+			req, err := http.NewRequest("POST", fmt.Sprintf("/users/%s/nightscout-secret", tc.userID), nil)
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, tc.expectCode, w.Code)
+			if tc.expectCode != http.StatusCreated {
+				return
+			}
+
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+			var response NightscoutSecretResponse
+			err = json.NewDecoder(w.Body).Decode(&response)
+			assert.NoError(t, err)
+			assert.Len(t, response.APISecret, 2*nightscoutSecretBytes)
+			assert.Equal(t, "/nightscout/"+userID, response.URL)
+
+			// Only the hash of the digest uploaders present is stored
+			assert.Equal(t, nightscoutSecretHash(nightscoutSecretHeader(response.APISecret)), storedHash)
+			assert.NotContains(t, storedHash, response.APISecret)
+		})
+	}
+}
+
+func TestDeleteNightscoutSecret(t *testing.T) {
+	apiInstance := setupAPI()
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	revoked := ""
+	userRepo.On("Update", mock.Anything, userID, domain.UserUpdate{NightscoutSecretHash: &revoked}).Return(domain.User{ID: userObjectID}, nil).Once()
+
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("/users/%s/nightscout-secret", userID), nil)
+	assert.NoError(t, err)
+
+	w := serve(apiInstance, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	userRepo.AssertExpectations(t)
+}
+
+func TestGetNightscoutEntries(t *testing.T) {
+	apiInstance := setupAPI()
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+	deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+	readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	deviceID := primitive.NewObjectID()
+	userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID, NightscoutSecretHash: nightscoutTestHash}, nil)
+	deviceRepo.On("FindByUser", mock.Anything, userID).Return([]domain.Device{{ID: deviceID, SerialNumber: "xDrip-DexcomG6"}}, nil)
+
+	day := time.Date(2024, 4, 6, 0, 0, 0, 0, time.UTC)
+	readings := []domain.Reading{
+		{
+			UserID:   userObjectID,
+			DeviceID: deviceID,
+			Day:      day,
+			Readings: []domain.ReadingEntry{
+				{Time: day.Add(8 * time.Hour), Value: 100},
+				{Time: day.Add(8*time.Hour + 5*time.Minute), Value: 102},
+				{Time: day.Add(8*time.Hour + 10*time.Minute), Value: 114},
+			},
+		},
+	}
+	readingsRepo.On("FetchReadings", mock.Anything, userID, day.AddDate(0, 0, -1), day.AddDate(0, 0, 2).Add(-time.Nanosecond)).Return(readings, nil)
+
+	from := day.Add(8 * time.Hour).UnixMilli()
+	to := day.Add(9 * time.Hour).UnixMilli()
+	url := fmt.Sprintf("/nightscout/%s/api/v1/entries.json?count=2&find[date][$gt]=%d&find[date][$lte]=%d", userID, from, to)
+	req, err := http.NewRequest("GET", url, nil)
+	assert.NoError(t, err)
+	req.Header.Set("api-secret", nightscoutSecretHeader(nightscoutTestSecret))
+
+	w := serve(apiInstance, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var entries []NightscoutEntry
+	err = json.NewDecoder(w.Body).Decode(&entries)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []NightscoutEntry{
+		{
+			ID:         fmt.Sprintf("%s-%d", deviceID.Hex(), day.Add(8*time.Hour+10*time.Minute).UnixMilli()),
+			Type:       "sgv",
+			SGV:        114,
+			Date:       day.Add(8*time.Hour + 10*time.Minute).UnixMilli(),
+			DateString: "2024-04-06T08:10:00.000Z",
+			Direction:  "SingleUp",
+			Device:     "xDrip-DexcomG6",
+		},
+		{
+			ID:         fmt.Sprintf("%s-%d", deviceID.Hex(), day.Add(8*time.Hour+5*time.Minute).UnixMilli()),
+			Type:       "sgv",
+			SGV:        102,
+			Date:       day.Add(8*time.Hour + 5*time.Minute).UnixMilli(),
+			DateString: "2024-04-06T08:05:00.000Z",
+			Direction:  "Flat",
+			Device:     "xDrip-DexcomG6",
+		},
+	}, entries)
+}
+
+func TestAddNightscoutEntries(t *testing.T) {
+	apiInstance := setupAPI()
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+	deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+	readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+	eventRepo := apiInstance.eventRepo.(*mocks.EventRepository)
+
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	device := domain.Device{ID: primitive.NewObjectID(), UserID: userObjectID, Manufacturer: nightscoutManufacturer, SerialNumber: "xDrip-DexcomG6"}
+	userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID, NightscoutSecretHash: nightscoutTestHash}, nil)
+	deviceRepo.On("FindByUser", mock.Anything, userID).Return([]domain.Device{device}, nil)
+
+	// The first entry is stored already
+	first := time.Date(2024, 4, 6, 8, 0, 0, 0, time.UTC)
+	second := first.Add(5 * time.Minute)
+	readingsRepo.On("FetchReadings", mock.Anything, userID, mock.Anything, mock.Anything).Return([]domain.Reading{}, nil)
+	readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, []domain.DeviceReading{
+		{DeviceID: device.ID.Hex(), Time: first, Value: 110},
+		{DeviceID: device.ID.Hex(), Time: second, Value: 115},
+	}).Return([]error{domain.ErrDuplicate, nil}, nil).Once()
+	eventRepo.On("ReplaceEvents", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	body := fmt.Sprintf(`[
+		{"type": "sgv", "sgv": 110, "date": %d, "device": "xDrip-DexcomG6", "direction": "Flat"},
+		{"type": "sgv", "sgv": 115, "dateString": "2024-04-06T08:05:00Z", "device": "xDrip-DexcomG6"},
+		{"type": "mbg", "mbg": 112, "date": %d, "device": "xDrip-DexcomG6"}
+	]`, first.UnixMilli(), second.UnixMilli())
+	req, err := http.NewRequest("POST", fmt.Sprintf("/nightscout/%s/api/v1/entries", userID), bytes.NewBufferString(body))
+	assert.NoError(t, err)
+	req.Header.Set("api-secret", nightscoutSecretHeader(nightscoutTestSecret))
+
+	w := serve(apiInstance, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var entries []NightscoutEntry
+	err = json.NewDecoder(w.Body).Decode(&entries)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, second.UnixMilli(), entries[1].Date)
+
+	readingsRepo.AssertExpectations(t)
+}
+
+func TestAddNightscoutEntries_StoreFailure(t *testing.T) {
+	apiInstance := setupAPI()
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+	deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+	readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	device := domain.Device{ID: primitive.NewObjectID(), UserID: userObjectID, Manufacturer: nightscoutManufacturer, SerialNumber: "xDrip-DexcomG6"}
+	userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID, NightscoutSecretHash: nightscoutTestHash}, nil)
+	deviceRepo.On("FindByUser", mock.Anything, userID).Return([]domain.Device{device}, nil)
+	readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, mock.Anything).Return([]error{errors.New("write conflict")}, nil).Once()
+
+	body := `[{"type": "sgv", "sgv": 110, "dateString": "2024-04-06T08:00:00Z", "device": "xDrip-DexcomG6"}]`
+	req, err := http.NewRequest("POST", fmt.Sprintf("/nightscout/%s/api/v1/entries", userID), bytes.NewBufferString(body))
+	assert.NoError(t, err)
+	req.Header.Set("api-secret", nightscoutSecretHeader(nightscoutTestSecret))
+
+	// Uploaders retry the whole upload on a failed request
+	w := serve(apiInstance, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestNightscoutDirection(t *testing.T) {
+	start := time.Date(2024, 4, 6, 8, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		delta     int
+		elapsed   time.Duration
+		direction string
+	}{
+		{delta: 20, elapsed: 5 * time.Minute, direction: "DoubleUp"},
+		{delta: 12, elapsed: 5 * time.Minute, direction: "SingleUp"},
+		{delta: 7, elapsed: 5 * time.Minute, direction: "FortyFiveUp"},
+		{delta: -5, elapsed: 5 * time.Minute, direction: "Flat"},
+		{delta: -8, elapsed: 5 * time.Minute, direction: "FortyFiveDown"},
+		{delta: -12, elapsed: 5 * time.Minute, direction: "SingleDown"},
+		{delta: -20, elapsed: 5 * time.Minute, direction: "DoubleDown"},
+		{delta: 0, elapsed: 30 * time.Minute, direction: "NONE"},
+	}
+
+	for _, tc := range testCases {
+		previous := domain.ReadingEntry{Time: start, Value: 100}
+		current := domain.ReadingEntry{Time: start.Add(tc.elapsed), Value: 100 + tc.delta}
+		assert.Equal(t, tc.direction, nightscoutDirection(previous, current), "delta %d over %s", tc.delta, tc.elapsed)
+	}
+}
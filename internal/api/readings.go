@@ -0,0 +1,354 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"glooko/internal/domain"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReadingRequest represents a single glucose reading submitted by a device.
+// Unit defaults to mg/dL, readings are converted to mg/dL before they are stored.
+type ReadingRequest struct {
+	Time  time.Time `json:"time" validate:"required"`
+	Value float64   `json:"value" validate:"gt=0"`
+	Unit  string    `json:"unit" validate:"omitempty,oneof=mg/dL mmol/L"`
+}
+
+// MgDL returns the reading value in whole mg/dL.
+func (rr ReadingRequest) MgDL() int {
+	unit := domain.MgDL
+	if rr.Unit != "" {
+		unit = domain.GlucoseUnit(rr.Unit)
+	}
+	return domain.Glucose{Value: rr.Value, Unit: unit}.MgDL()
+}
+
+// AddReadingsRequest holds a batch of readings submitted in a single request.
+// A batch is capped at 1000 readings.
+type AddReadingsRequest struct {
+	Readings []ReadingRequest `validate:"required,min=1,max=1000,dive"`
+}
+
+const (
+	readingAccepted = "accepted"
+	readingRejected = "rejected"
+)
+
+// ReadingResult is the outcome of the reading at Index of an upload, Error explains why a rejected
+// reading was not stored.
+type ReadingResult struct {
+	Index  int      `json:"index"`
+	Status string   `json:"status"`
+	Error  *Problem `json:"error,omitempty"`
+}
+
+// AddReadingsResponse reports the outcome of every reading of an upload, in the order of the
+// request.
+type AddReadingsResponse struct {
+	Accepted int             `json:"accepted"`
+	Rejected int             `json:"rejected"`
+	Results  []ReadingResult `json:"results"`
+}
+
+// AddReadings stores a reading or an array of readings of a device in a single batch. A reading
+// failing to be stored doesn't fail the others, the response is 207 Multi-Status when any reading
+// was rejected.
+func (api *API) AddReadings(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "AddReadings")
+
+	params := DeviceParams{
+		ID:       chi.URLParam(r, "id"),
+		DeviceID: chi.URLParam(r, "deviceId"),
+	}
+
+	err := api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	readings, err := decodeReadings(w, r)
+	if err != nil {
+		log.Errorf("invalid request body: %v", err)
+		respondWithError(w, r, invalidInput("request body", err))
+		return
+	}
+
+	err = api.validate.Struct(AddReadingsRequest{Readings: readings})
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	_, err = api.findUserDevice(r, params)
+	if err != nil {
+		log.Errorf("failed to fetch device: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, loc, err := api.findUserWithLocation(ctx, params.ID)
+	if err != nil {
+		log.Errorf("failed to fetch user: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	upload := newReadingsUpload(len(readings))
+	for i, reading := range readings {
+		upload.add(i, domain.DeviceReading{
+			DeviceID: params.DeviceID,
+			Time:     reading.Time.In(loc),
+			Value:    reading.MgDL(),
+		})
+	}
+
+	err = api.storeReadings(ctx, user, loc, upload)
+	if err != nil {
+		log.Errorf("failed to add readings: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithStatus(w, upload.status(), upload.response)
+}
+
+// ReadingsBatchParams identifies the user a batch of readings is uploaded for.
+type ReadingsBatchParams struct {
+	ID string `validate:"required,mongodb"`
+}
+
+// BatchReadingRequest is a reading of one of the user's devices in a batch upload.
+type BatchReadingRequest struct {
+	DeviceID string `json:"deviceId" validate:"required,mongodb"`
+	ReadingRequest
+}
+
+// AddReadingsBatchRequest holds the readings of a batch upload, they are validated one by one.
+// A batch is capped at 20000 readings, two weeks of 5 minute CGM readings of a few devices.
+type AddReadingsBatchRequest struct {
+	Readings []BatchReadingRequest `validate:"required,min=1,max=20000"`
+}
+
+// AddReadingsBatch stores readings of any of the user's devices in a single batch. Readings that
+// are invalid, belong to another device or fail to be stored are rejected on their own, the
+// response is 207 Multi-Status when any reading was rejected.
+func (api *API) AddReadingsBatch(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "AddReadingsBatch")
+
+	params := ReadingsBatchParams{
+		ID: chi.URLParam(r, "id"),
+	}
+
+	err := api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	var readings []BatchReadingRequest
+	err = json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportSize)).Decode(&readings)
+	if err != nil {
+		log.Errorf("invalid request body: %v", err)
+		respondWithError(w, r, invalidInput("request body", err))
+		return
+	}
+
+	err = api.validate.Struct(AddReadingsBatchRequest{Readings: readings})
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, loc, err := api.findUserWithLocation(ctx, params.ID)
+	if err != nil {
+		log.Errorf("failed to fetch user: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	devices, err := api.deviceRepo.FindByUser(ctx, params.ID)
+	if err != nil {
+		log.Errorf("failed to fetch devices: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+	owned := map[string]domain.Device{}
+	for _, device := range devices {
+		owned[device.ID.Hex()] = device
+	}
+
+	upload := newReadingsUpload(len(readings))
+	for i, reading := range readings {
+		err := api.validate.Struct(reading)
+		if err == nil {
+			if _, ok := owned[reading.DeviceID]; !ok {
+				err = errDeviceNotOwned
+			}
+		}
+		if err != nil {
+			upload.reject(i, err)
+			continue
+		}
+
+		upload.add(i, domain.DeviceReading{
+			DeviceID: reading.DeviceID,
+			Time:     reading.Time.In(loc),
+			Value:    reading.MgDL(),
+		})
+	}
+
+	err = api.storeReadings(ctx, user, loc, upload)
+	if err != nil {
+		log.Errorf("failed to add readings: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithStatus(w, upload.status(), upload.response)
+}
+
+// readingsUpload collects the readings of an upload to store together and the outcome of every
+// reading of the request.
+type readingsUpload struct {
+	response AddReadingsResponse
+	batch    []domain.DeviceReading
+	indexes  []int // Positions of the batch readings in the request
+}
+
+func newReadingsUpload(count int) *readingsUpload {
+	return &readingsUpload{
+		response: AddReadingsResponse{Results: make([]ReadingResult, count)},
+	}
+}
+
+// add queues the reading at index i of the request for storage.
+func (u *readingsUpload) add(i int, reading domain.DeviceReading) {
+	u.batch = append(u.batch, reading)
+	u.indexes = append(u.indexes, i)
+}
+
+func (u *readingsUpload) accept(i int) {
+	u.response.Results[i] = ReadingResult{Index: i, Status: readingAccepted}
+	u.response.Accepted++
+}
+
+// reject records err as the reason the reading at index i of the request was not stored.
+func (u *readingsUpload) reject(i int, err error) {
+	problem := problemFor(err)
+	u.response.Results[i] = ReadingResult{Index: i, Status: readingRejected, Error: &problem}
+	u.response.Rejected++
+}
+
+// status is 201 when every reading was accepted and 207 Multi-Status otherwise.
+func (u *readingsUpload) status() int {
+	if u.response.Rejected > 0 {
+		return http.StatusMultiStatus
+	}
+	return http.StatusCreated
+}
+
+// storeReadings stores the queued readings of upload in a single batch, records the outcome of
+// each and detects events over the stored readings of every device. The error is set when the
+// batch failed as a whole.
+func (api *API) storeReadings(ctx context.Context, user domain.User, loc *time.Location, upload *readingsUpload) error {
+	log := api.log.With("method", "storeReadings")
+
+	if len(upload.batch) == 0 {
+		return nil
+	}
+
+	results, err := api.readingsRepo.AddReadingsAndUpdateStats(ctx, user.ID.Hex(), upload.batch)
+	if err != nil {
+		return err
+	}
+
+	spans := map[string]*timeSpan{}
+	for j, err := range results {
+		i := upload.indexes[j]
+		if errors.Is(err, domain.ErrDuplicate) {
+			// Already stored, accepted again so retried uploads report the same
+			upload.accept(i)
+			continue
+		}
+		if err != nil {
+			log.Errorf("failed to add reading %d: %v", i, err)
+			upload.reject(i, err)
+			continue
+		}
+		upload.accept(i)
+
+		reading := upload.batch[j]
+		span, ok := spans[reading.DeviceID]
+		if !ok {
+			spans[reading.DeviceID] = &timeSpan{from: reading.Time, to: reading.Time}
+			continue
+		}
+		span.extend(reading.Time)
+	}
+
+	for deviceID, span := range spans {
+		deviceObjID, err := primitive.ObjectIDFromHex(deviceID)
+		if err != nil {
+			return err
+		}
+
+		err = api.detector.Detect(ctx, user, loc, deviceObjID, span.from, span.to)
+		if err != nil {
+			log.Errorf("failed to detect events: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// timeSpan is the earliest and latest of a set of timestamps.
+type timeSpan struct {
+	from, to time.Time
+}
+
+func (s *timeSpan) extend(t time.Time) {
+	if t.Before(s.from) {
+		s.from = t
+	}
+	if t.After(s.to) {
+		s.to = t
+	}
+}
+
+// decodeReadings accepts either a single reading object or an array of readings.
+func decodeReadings(w http.ResponseWriter, r *http.Request) ([]ReadingRequest, error) {
+	var raw json.RawMessage
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&raw)
+	if err != nil {
+		return nil, err
+	}
+
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '[' {
+		var readings []ReadingRequest
+		if err := json.Unmarshal(raw, &readings); err != nil {
+			return nil, err
+		}
+		return readings, nil
+	}
+
+	var reading ReadingRequest
+	if err := json.Unmarshal(raw, &reading); err != nil {
+		return nil, err
+	}
+	return []ReadingRequest{reading}, nil
+}
@@ -0,0 +1,413 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+	"glooko/internal/mocks"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAddReadings(t *testing.T) {
+	userID := "1234567890abcdef12345678"
+	deviceID := "abcdef1234567890abcdef12"
+	timestamp := time.Date(2024, 4, 6, 8, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name           string
+		body           string
+		deviceOwner    string
+		setupMock      func(readingsRepo *mocks.ReadingRepository)
+		expectCode     int
+		expectAccepted int
+		expectRejected int
+	}{
+		{
+			name: "Single Reading",
+			body: `{"time":"2024-04-06T08:00:00Z","value":120}`,
+			setupMock: func(readingsRepo *mocks.ReadingRepository) {
+				readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, []domain.DeviceReading{
+					{DeviceID: deviceID, Time: timestamp, Value: 120},
+				}).Return([]error{nil}, nil).Once()
+			},
+			expectCode:     http.StatusCreated,
+			expectAccepted: 1,
+		},
+		{
+			name: "Batch Of Readings",
+			body: `[{"time":"2024-04-06T08:00:00Z","value":120},{"time":"2024-04-06T08:05:00Z","value":125}]`,
+			setupMock: func(readingsRepo *mocks.ReadingRepository) {
+				readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, []domain.DeviceReading{
+					{DeviceID: deviceID, Time: timestamp, Value: 120},
+					{DeviceID: deviceID, Time: timestamp.Add(5 * time.Minute), Value: 125},
+				}).Return([]error{nil, nil}, nil).Once()
+			},
+			expectCode:     http.StatusCreated,
+			expectAccepted: 2,
+		},
+		{
+			name: "Reading In mmol/L",
+			body: `{"time":"2024-04-06T08:00:00Z","value":6.7,"unit":"mmol/L"}`,
+			setupMock: func(readingsRepo *mocks.ReadingRepository) {
+				readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, []domain.DeviceReading{
+					{DeviceID: deviceID, Time: timestamp, Value: 121},
+				}).Return([]error{nil}, nil).Once()
+			},
+			expectCode:     http.StatusCreated,
+			expectAccepted: 1,
+		},
+		{
+			name:       "Unknown Unit",
+			body:       `{"time":"2024-04-06T08:00:00Z","value":6.7,"unit":"g/L"}`,
+			setupMock:  func(readingsRepo *mocks.ReadingRepository) {},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Malformed Body",
+			body:       `{"time":`,
+			setupMock:  func(readingsRepo *mocks.ReadingRepository) {},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Missing Value",
+			body:       `{"time":"2024-04-06T08:00:00Z"}`,
+			setupMock:  func(readingsRepo *mocks.ReadingRepository) {},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Empty Batch",
+			body:       `[]`,
+			setupMock:  func(readingsRepo *mocks.ReadingRepository) {},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:        "Device Of Another User",
+			body:        `{"time":"2024-04-06T08:00:00Z","value":120}`,
+			deviceOwner: "aaaaaaaaaaaaaaaaaaaaaaaa",
+			setupMock:   func(readingsRepo *mocks.ReadingRepository) {},
+			expectCode:  http.StatusNotFound,
+		},
+		{
+			name: "Reading Failing To Store",
+			body: `[{"time":"2024-04-06T08:00:00Z","value":120},{"time":"2024-04-06T08:05:00Z","value":125}]`,
+			setupMock: func(readingsRepo *mocks.ReadingRepository) {
+				readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, mock.Anything).Return([]error{errors.New("boom"), nil}, nil).Once()
+			},
+			expectCode:     http.StatusMultiStatus,
+			expectAccepted: 1,
+			expectRejected: 1,
+		},
+		{
+			name: "Reading Already Stored",
+			body: `[{"time":"2024-04-06T08:00:00Z","value":120},{"time":"2024-04-06T08:05:00Z","value":125}]`,
+			setupMock: func(readingsRepo *mocks.ReadingRepository) {
+				readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, mock.Anything).Return([]error{domain.ErrDuplicate, nil}, nil).Once()
+			},
+			expectCode:     http.StatusCreated,
+			expectAccepted: 2,
+		},
+		{
+			name: "Repository Failure",
+			body: `{"time":"2024-04-06T08:00:00Z","value":120}`,
+			setupMock: func(readingsRepo *mocks.ReadingRepository) {
+				readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, mock.Anything).Return(nil, errors.New("boom")).Once()
+			},
+			expectCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+			deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+			tc.setupMock(readingsRepo)
+
+			owner := userID
+			if tc.deviceOwner != "" {
+				owner = tc.deviceOwner
+			}
+			ownerObjectID, _ := primitive.ObjectIDFromHex(owner)
+			deviceRepo.On("FindByID", mock.Anything, deviceID).Return(domain.Device{UserID: ownerObjectID}, nil).Maybe()
+
+			userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+			userObjectID, _ := primitive.ObjectIDFromHex(userID)
+			userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID}, nil).Maybe()
+
+			eventRepo := apiInstance.eventRepo.(*mocks.EventRepository)
+			readingsRepo.On("FetchReadings", mock.Anything, userID, mock.Anything, mock.Anything).Return([]domain.Reading{}, nil).Maybe()
+			eventRepo.On("ReplaceEvents", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, []domain.GlucoseEvent{}).Return(nil).Maybe()
+
+			url := fmt.Sprintf("/users/%s/devices/%s/readings", userID, deviceID)
+			req, err := http.NewRequest("POST", url, strings.NewReader(tc.body))
+			assert.NoError(t, err)
+
+			w := serve(apiInstance, req)
+
+			assert.Equal(t, tc.expectCode, w.Code)
+			readingsRepo.AssertExpectations(t)
+
+			if tc.expectCode == http.StatusCreated || tc.expectCode == http.StatusMultiStatus {
+				var response AddReadingsResponse
+				err = json.NewDecoder(w.Body).Decode(&response)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectAccepted, response.Accepted)
+				assert.Equal(t, tc.expectRejected, response.Rejected)
+				assert.Len(t, response.Results, tc.expectAccepted+tc.expectRejected)
+			}
+		})
+	}
+}
+
+func TestAddReadings_Timezone(t *testing.T) {
+	apiInstance := setupAPI()
+	readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+	deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+
+	userID := "1234567890abcdef12345678"
+	deviceID := "abcdef1234567890abcdef12"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+
+	deviceRepo.On("FindByID", mock.Anything, deviceID).Return(domain.Device{UserID: userObjectID}, nil)
+	userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID, Timezone: "America/Los_Angeles"}, nil)
+
+	eventRepo := apiInstance.eventRepo.(*mocks.EventRepository)
+	readingsRepo.On("FetchReadings", mock.Anything, userID, mock.Anything, mock.Anything).Return([]domain.Reading{}, nil)
+	eventRepo.On("ReplaceEvents", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, []domain.GlucoseEvent{}).Return(nil)
+
+	// 05:00 UTC is still the previous evening in Los Angeles
+	readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, mock.MatchedBy(func(readings []domain.DeviceReading) bool {
+		ts := readings[0].Time
+		return ts.Location().String() == "America/Los_Angeles" && domain.DayOf(ts).Equal(time.Date(2024, 4, 5, 0, 0, 0, 0, time.UTC))
+	})).Return([]error{nil}, nil).Once()
+
+	url := fmt.Sprintf("/users/%s/devices/%s/readings", userID, deviceID)
+	req, err := http.NewRequest("POST", url, strings.NewReader(`{"time":"2024-04-06T05:00:00Z","value":120}`))
+	assert.NoError(t, err)
+
+	w := serve(apiInstance, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	readingsRepo.AssertExpectations(t)
+}
+
+func TestAddReadings_DetectsEvents(t *testing.T) {
+	apiInstance := setupAPI()
+	readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+	deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+	eventRepo := apiInstance.eventRepo.(*mocks.EventRepository)
+
+	userID := "1234567890abcdef12345678"
+	deviceID := "abcdef1234567890abcdef12"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	deviceObjectID, _ := primitive.ObjectIDFromHex(deviceID)
+
+	deviceRepo.On("FindByID", mock.Anything, deviceID).Return(domain.Device{ID: deviceObjectID, UserID: userObjectID}, nil)
+	userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID}, nil)
+	readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, mock.Anything).Return([]error{nil, nil}, nil)
+
+	day := time.Date(2024, 4, 6, 0, 0, 0, 0, time.UTC)
+	start := day.Add(8 * time.Hour)
+	stored := []domain.Reading{
+		{
+			UserID:   userObjectID,
+			DeviceID: deviceObjectID,
+			Day:      day,
+			Readings: []domain.ReadingEntry{
+				{Time: start, Value: 60},
+				{Time: start.Add(5 * time.Minute), Value: 60},
+				{Time: start.Add(10 * time.Minute), Value: 60},
+				{Time: start.Add(15 * time.Minute), Value: 60},
+			},
+		},
+		{
+			UserID:   userObjectID,
+			DeviceID: primitive.NewObjectID(), // Another device, ignored
+			Day:      day,
+			Readings: []domain.ReadingEntry{{Time: start, Value: 300}},
+		},
+		{
+			UserID:   userObjectID,
+			DeviceID: deviceObjectID,
+			Day:      day.AddDate(0, 0, -2), // Analysed, but starts before the re-detected window
+			Readings: []domain.ReadingEntry{
+				{Time: start.AddDate(0, 0, -2), Value: 300},
+				{Time: start.AddDate(0, 0, -2).Add(15 * time.Minute), Value: 300},
+			},
+		},
+	}
+	readingsRepo.On("FetchReadings", mock.Anything, userID, day.AddDate(0, 0, -3), day.AddDate(0, 0, 4).Add(-time.Nanosecond)).Return(stored, nil)
+
+	expected := []domain.GlucoseEvent{
+		{
+			UserID:   userObjectID,
+			DeviceID: deviceObjectID,
+			Type:     domain.EventHypoglycemia,
+			Level:    1,
+			Start:    start,
+			End:      start.Add(15 * time.Minute),
+			Extreme:  60,
+		},
+	}
+	eventRepo.On("ReplaceEvents", mock.Anything, userID, deviceID, day.AddDate(0, 0, -1), day.AddDate(0, 0, 2).Add(-time.Nanosecond), expected).Return(nil).Once()
+
+	url := fmt.Sprintf("/users/%s/devices/%s/readings", userID, deviceID)
+	body := `[{"time":"2024-04-06T08:00:00Z","value":60},{"time":"2024-04-06T08:15:00Z","value":60}]`
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	assert.NoError(t, err)
+
+	w := serve(apiInstance, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	eventRepo.AssertExpectations(t)
+}
+
+func TestAddReadingsBatch(t *testing.T) {
+	userID := "1234567890abcdef12345678"
+	deviceID := "abcdef1234567890abcdef12"
+	otherDeviceID := "abcdef1234567890abcdef34"
+	timestamp := time.Date(2024, 4, 6, 8, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name           string
+		body           string
+		setupMock      func(readingsRepo *mocks.ReadingRepository)
+		expectCode     int
+		expectStatuses []string
+		expectCodes    []string
+	}{
+		{
+			name: "Readings Of Several Devices",
+			body: `[{"deviceId":"abcdef1234567890abcdef12","time":"2024-04-06T08:00:00Z","value":120},
+				{"deviceId":"abcdef1234567890abcdef34","time":"2024-04-06T08:00:00Z","value":6.7,"unit":"mmol/L"}]`,
+			setupMock: func(readingsRepo *mocks.ReadingRepository) {
+				readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, []domain.DeviceReading{
+					{DeviceID: deviceID, Time: timestamp, Value: 120},
+					{DeviceID: otherDeviceID, Time: timestamp, Value: 121},
+				}).Return([]error{nil, nil}, nil).Once()
+			},
+			expectCode:     http.StatusCreated,
+			expectStatuses: []string{"accepted", "accepted"},
+			expectCodes:    []string{"", ""},
+		},
+		{
+			name: "Invalid Readings Rejected",
+			body: `[{"deviceId":"abcdef1234567890abcdef12","time":"2024-04-06T08:00:00Z","value":0},
+				{"deviceId":"aaaaaaaaaaaaaaaaaaaaaaaa","time":"2024-04-06T08:00:00Z","value":120},
+				{"deviceId":"abcdef1234567890abcdef12","time":"2024-04-06T08:05:00Z","value":125}]`,
+			setupMock: func(readingsRepo *mocks.ReadingRepository) {
+				readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, []domain.DeviceReading{
+					{DeviceID: deviceID, Time: timestamp.Add(5 * time.Minute), Value: 125},
+				}).Return([]error{nil}, nil).Once()
+			},
+			expectCode:     http.StatusMultiStatus,
+			expectStatuses: []string{"rejected", "rejected", "accepted"},
+			expectCodes:    []string{"validation_failed", "not_found", ""},
+		},
+		{
+			name: "Reading Failing To Store",
+			body: `[{"deviceId":"abcdef1234567890abcdef12","time":"2024-04-06T08:00:00Z","value":120},
+				{"deviceId":"abcdef1234567890abcdef34","time":"2024-04-06T08:00:00Z","value":130}]`,
+			setupMock: func(readingsRepo *mocks.ReadingRepository) {
+				readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, mock.Anything).
+					Return([]error{nil, errors.New("boom")}, nil).Once()
+			},
+			expectCode:     http.StatusMultiStatus,
+			expectStatuses: []string{"accepted", "rejected"},
+			expectCodes:    []string{"", "internal_error"},
+		},
+		{
+			name:           "No Valid Reading",
+			body:           `[{"deviceId":"invalid","time":"2024-04-06T08:00:00Z","value":120}]`,
+			setupMock:      func(readingsRepo *mocks.ReadingRepository) {},
+			expectCode:     http.StatusMultiStatus,
+			expectStatuses: []string{"rejected"},
+			expectCodes:    []string{"validation_failed"},
+		},
+		{
+			name:       "Malformed Body",
+			body:       `[{"deviceId":`,
+			setupMock:  func(readingsRepo *mocks.ReadingRepository) {},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Empty Batch",
+			body:       `[]`,
+			setupMock:  func(readingsRepo *mocks.ReadingRepository) {},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name: "Repository Failure",
+			body: `[{"deviceId":"abcdef1234567890abcdef12","time":"2024-04-06T08:00:00Z","value":120}]`,
+			setupMock: func(readingsRepo *mocks.ReadingRepository) {
+				readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, mock.Anything).Return(nil, errors.New("boom")).Once()
+			},
+			expectCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+			tc.setupMock(readingsRepo)
+
+			userObjectID, _ := primitive.ObjectIDFromHex(userID)
+			deviceObjectID, _ := primitive.ObjectIDFromHex(deviceID)
+			otherDeviceObjectID, _ := primitive.ObjectIDFromHex(otherDeviceID)
+			deviceRepo := apiInstance.deviceRepo.(*mocks.DeviceRepository)
+			deviceRepo.On("FindByUser", mock.Anything, userID).Return([]domain.Device{
+				{ID: deviceObjectID, UserID: userObjectID},
+				{ID: otherDeviceObjectID, UserID: userObjectID},
+			}, nil).Maybe()
+
+			userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+			userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID}, nil).Maybe()
+
+			eventRepo := apiInstance.eventRepo.(*mocks.EventRepository)
+			readingsRepo.On("FetchReadings", mock.Anything, userID, mock.Anything, mock.Anything).Return([]domain.Reading{}, nil).Maybe()
+			eventRepo.On("ReplaceEvents", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, []domain.GlucoseEvent{}).Return(nil).Maybe()
+
+			url := fmt.Sprintf("/users/%s/readings", userID)
+			req, err := http.NewRequest("POST", url, strings.NewReader(tc.body))
+			assert.NoError(t, err)
+
+			w := serve(apiInstance, req)
+
+			assert.Equal(t, tc.expectCode, w.Code)
+			readingsRepo.AssertExpectations(t)
+
+			if tc.expectStatuses != nil {
+				var response AddReadingsResponse
+				err = json.NewDecoder(w.Body).Decode(&response)
+				assert.NoError(t, err)
+				assert.Len(t, response.Results, len(tc.expectStatuses))
+
+				accepted := 0
+				for i, result := range response.Results {
+					assert.Equal(t, i, result.Index)
+					assert.Equal(t, tc.expectStatuses[i], result.Status, "reading %d", i)
+					if tc.expectCodes[i] == "" {
+						assert.Nil(t, result.Error)
+						accepted++
+						continue
+					}
+					if assert.NotNil(t, result.Error, "reading %d", i) {
+						assert.Equal(t, tc.expectCodes[i], result.Error.Code)
+					}
+				}
+				assert.Equal(t, accepted, response.Accepted)
+				assert.Equal(t, len(tc.expectStatuses)-accepted, response.Rejected)
+			}
+		})
+	}
+}
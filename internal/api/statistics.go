@@ -0,0 +1,108 @@
+package api
+
+import (
+	"glooko/internal/analytics"
+	"glooko/internal/domain"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Statistics holds glycemic variability statistics over a window of readings.
+// Mean, SD and MAGE are in the unit of the response.
+type Statistics struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	SD    float64 `json:"sd"`
+	CV    float64 `json:"cv"`   // Coefficient of variation in percent
+	GMI   float64 `json:"gmi"`  // Glucose Management Indicator (estimated A1c) in percent
+	MAGE  float64 `json:"mage"` // Mean Amplitude of Glycemic Excursions
+}
+
+// StatisticsResponse holds the statistics of a user over the requested window.
+type StatisticsResponse struct {
+	UserID     string     `json:"userId"`
+	Unit       string     `json:"unit"`
+	Start      string     `json:"start"`
+	End        string     `json:"end"`
+	Statistics Statistics `json:"statistics"`
+}
+
+func (api *API) GetStatistics(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "GetStatistics")
+
+	params := UserOverviewParams{
+		ID:    chi.URLParam(r, "id"),
+		Start: r.URL.Query().Get("start"),
+		End:   r.URL.Query().Get("end"),
+	}
+
+	err := api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, loc, err := api.findUserWithLocation(ctx, params.ID)
+	if err != nil {
+		log.Errorf("failed to fetch user: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	unit, err := resolveUnit(r, user)
+	if err != nil {
+		log.Errorf("invalid units: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	start, end, err := parseDates(params.Start, params.End, loc)
+	if err != nil {
+		log.Errorf("invalid date range: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	fetchStart, fetchEnd := bucketRange(start, end)
+	readings, err := api.readingsRepo.FetchReadings(ctx, params.ID, fetchStart, fetchEnd)
+	if err != nil {
+		log.Errorf("failed to fetch readings: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	aggregatedData := aggregateReadings(readings, loc, start, end, user.Targets())
+	respondWithJSON(w, StatisticsResponse{
+		UserID:     params.ID,
+		Unit:       string(unit),
+		Start:      start.Format("2006-01-02"),
+		End:        end.Format("2006-01-02"),
+		Statistics: toStatistics(analytics.ComputeStatistics(windowEntries(aggregatedData)), unit),
+	})
+}
+
+// windowEntries collects the measures of all aggregated days as reading entries,
+// days must still hold mg/dL values.
+func windowEntries(days []DailyReadings) []domain.ReadingEntry {
+	var entries []domain.ReadingEntry
+	for _, daily := range days {
+		for _, measure := range daily.Measure {
+			entries = append(entries, domain.ReadingEntry{Time: measure.Time, Value: int(measure.Value)})
+		}
+	}
+	return entries
+}
+
+func toStatistics(stats analytics.Statistics, unit domain.GlucoseUnit) Statistics {
+	return Statistics{
+		Count: stats.Count,
+		Mean:  unit.RoundDerived(unit.FromMgDL(stats.Mean)),
+		SD:    unit.RoundDerived(unit.FromMgDL(stats.SD)),
+		CV:    stats.CV,
+		GMI:   stats.GMI,
+		MAGE:  unit.RoundDerived(unit.FromMgDL(stats.MAGE)),
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+	"glooko/internal/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGetStatistics(t *testing.T) {
+	apiInstance := setupAPI()
+	readingsRepo := apiInstance.readingsRepo.(*mocks.ReadingRepository)
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID}, nil)
+
+	start, end, err := parseDates("2024-04-06", "2024-04-07", time.UTC)
+	assert.NoError(t, err)
+
+	readings := []domain.Reading{
+		{
+			UserID: userObjectID,
+			Day:    start,
+			Readings: []domain.ReadingEntry{
+				{Time: start.Add(8 * time.Hour), Value: 100},
+				{Time: start.Add(9 * time.Hour), Value: 200},
+				{Time: start.Add(10 * time.Hour), Value: 100},
+			},
+		},
+		{
+			UserID: userObjectID,
+			Day:    start.AddDate(0, 0, 1),
+			Readings: []domain.ReadingEntry{
+				{Time: start.Add(32 * time.Hour), Value: 200},
+				{Time: start.Add(33 * time.Hour), Value: 100},
+			},
+		},
+	}
+	readingsRepo.On("FetchReadings", mock.Anything, userID, start.AddDate(0, 0, -1), end.AddDate(0, 0, 1)).Return(readings, nil)
+
+	url := fmt.Sprintf("/users/%s/statistics?start=2024-04-06&end=2024-04-07", userID)
+	req, err := http.NewRequest("GET", url, nil)
+	assert.NoError(t, err)
+
+	w := serve(apiInstance, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response StatisticsResponse
+	err = json.NewDecoder(w.Body).Decode(&response)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-04-06", response.Start)
+	assert.Equal(t, "2024-04-07", response.End)
+	assert.Equal(t, 5, response.Statistics.Count)
+	assert.Equal(t, 140.0, response.Statistics.Mean)
+	assert.Equal(t, 54.8, response.Statistics.SD)
+	assert.Equal(t, 39.1, response.Statistics.CV)
+	assert.Equal(t, 6.7, response.Statistics.GMI)
+	assert.Equal(t, 100.0, response.Statistics.MAGE)
+}
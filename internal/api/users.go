@@ -0,0 +1,379 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"glooko/internal/auth"
+	"glooko/internal/domain"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+)
+
+// defaultUsersLimit is the page size used when the listing does not specify one.
+const defaultUsersLimit = 50
+
+// UserResponse is the API representation of a user.
+type UserResponse struct {
+	ID           string         `json:"id"`
+	FirstName    string         `json:"firstName"`
+	LastName     string         `json:"lastName"`
+	DateOfBirth  string         `json:"dateOfBirth"`
+	Email        string         `json:"email"`
+	PhoneNumber  string         `json:"phoneNumber"`
+	Timezone     string         `json:"timezone"`
+	TargetRange  TargetRangeDTO `json:"targetRange"`
+	Unit         string         `json:"unit"`
+	SupportQueue string         `json:"supportQueue,omitempty"`
+	CareTeam     []string       `json:"careTeam"`
+}
+
+// TargetRangeDTO holds the glucose thresholds (mg/dL) used for time in range.
+type TargetRangeDTO struct {
+	VeryLow  int `json:"veryLow" validate:"min=1"`
+	Low      int `json:"low" validate:"gtfield=VeryLow"`
+	High     int `json:"high" validate:"gtfield=Low"`
+	VeryHigh int `json:"veryHigh" validate:"gtfield=High"`
+}
+
+// UserListResponse holds a single page of users.
+type UserListResponse struct {
+	Users  []UserResponse `json:"users"`
+	Total  int64          `json:"total"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+}
+
+// CreateUserRequest is the payload for creating a user.
+type CreateUserRequest struct {
+	FirstName    string          `json:"firstName" validate:"required"`
+	LastName     string          `json:"lastName" validate:"required"`
+	DateOfBirth  string          `json:"dateOfBirth" validate:"required,datetime=2006-01-02"`
+	Email        string          `json:"email" validate:"required,email"`
+	PhoneNumber  string          `json:"phoneNumber" validate:"required"`
+	Timezone     string          `json:"timezone" validate:"omitempty,timezone"`
+	TargetRange  *TargetRangeDTO `json:"targetRange" validate:"omitempty"`
+	Unit         string          `json:"unit" validate:"omitempty,oneof=mg/dL mmol/L"`
+	SupportQueue string          `json:"supportQueue"`
+	CareTeam     []string        `json:"careTeam" validate:"omitempty,dive,required"`
+}
+
+// UpdateUserRequest is the payload for partially updating a user, omitted fields are left untouched.
+type UpdateUserRequest struct {
+	FirstName    *string         `json:"firstName" validate:"omitempty,min=1"`
+	LastName     *string         `json:"lastName" validate:"omitempty,min=1"`
+	DateOfBirth  *string         `json:"dateOfBirth" validate:"omitempty,datetime=2006-01-02"`
+	Email        *string         `json:"email" validate:"omitempty,email"`
+	PhoneNumber  *string         `json:"phoneNumber" validate:"omitempty,min=1"`
+	Timezone     *string         `json:"timezone" validate:"omitempty,timezone"`
+	TargetRange  *TargetRangeDTO `json:"targetRange" validate:"omitempty"`
+	Unit         *string         `json:"unit" validate:"omitempty,oneof=mg/dL mmol/L"`
+	SupportQueue *string         `json:"supportQueue"`
+	CareTeam     *[]string       `json:"careTeam" validate:"omitempty,dive,required"`
+}
+
+type ListUsersParams struct {
+	Email    string `validate:"omitempty,email"`
+	LastName string
+	Limit    int `validate:"min=1,max=200"`
+	Offset   int `validate:"min=0"`
+}
+
+func (api *API) ListUsers(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "ListUsers")
+
+	principal, _ := auth.PrincipalFrom(r.Context())
+	if !auth.CanManageUsers(principal) {
+		log.Errorf("%s %s may not list users", principal.Role, principal.Subject)
+		respondWithError(w, r, auth.ErrForbidden)
+		return
+	}
+
+	limit, err := queryInt(r, "limit", defaultUsersLimit)
+	if err != nil {
+		log.Errorf("invalid limit: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		log.Errorf("invalid offset: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	params := ListUsersParams{
+		Email:    r.URL.Query().Get("email"),
+		LastName: r.URL.Query().Get("lastName"),
+		Limit:    limit,
+		Offset:   offset,
+	}
+
+	err = api.validate.Struct(params)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	users, total, err := api.userRepo.Find(r.Context(), domain.UserFilter{
+		Email:         params.Email,
+		LastName:      params.LastName,
+		SupportQueues: auth.SupportQueues(principal),
+		Limit:         params.Limit,
+		Offset:        params.Offset,
+	})
+	if err != nil {
+		log.Errorf("failed to find users: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	response := UserListResponse{
+		Users:  make([]UserResponse, len(users)),
+		Total:  total,
+		Limit:  params.Limit,
+		Offset: params.Offset,
+	}
+	for i, user := range users {
+		response.Users[i] = toUserResponse(user)
+	}
+	respondWithJSON(w, response)
+}
+
+func (api *API) CreateUser(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "CreateUser")
+
+	principal, _ := auth.PrincipalFrom(r.Context())
+	if !auth.CanManageUsers(principal) {
+		log.Errorf("%s %s may not create users", principal.Role, principal.Subject)
+		respondWithError(w, r, auth.ErrForbidden)
+		return
+	}
+
+	var req CreateUserRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req)
+	if err != nil {
+		log.Errorf("invalid request body: %v", err)
+		respondWithError(w, r, invalidInput("request body", err))
+		return
+	}
+
+	err = api.validate.Struct(req)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	if !auth.CanAssignQueue(principal, req.SupportQueue) {
+		log.Errorf("%s %s may not assign queue %q", principal.Role, principal.Subject, req.SupportQueue)
+		respondWithError(w, r, auth.ErrForbidden)
+		return
+	}
+
+	dateOfBirth, _ := time.Parse("2006-01-02", req.DateOfBirth)
+	user, err := api.userRepo.Save(r.Context(), domain.User{
+		FirstName:    req.FirstName,
+		LastName:     req.LastName,
+		DateOfBirth:  dateOfBirth,
+		Email:        req.Email,
+		PhoneNumber:  req.PhoneNumber,
+		Timezone:     req.Timezone,
+		TargetRange:  req.TargetRange.toDomain(),
+		Unit:         domain.GlucoseUnit(req.Unit),
+		SupportQueue: req.SupportQueue,
+		CareTeam:     req.CareTeam,
+		Devices:      []domain.Device{},
+	})
+	if err != nil {
+		log.Errorf("failed to save user: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithStatus(w, http.StatusCreated, toUserResponse(user))
+}
+
+func (api *API) GetUser(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "GetUser")
+	userID := chi.URLParam(r, "id")
+
+	err := api.validate.Var(userID, "required,mongodb")
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	user, err := api.userRepo.FindByID(r.Context(), userID)
+	if err != nil {
+		log.Errorf("failed to fetch user: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, toUserResponse(user))
+}
+
+func (api *API) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "UpdateUser")
+	userID := chi.URLParam(r, "id")
+
+	err := api.validate.Var(userID, "required,mongodb")
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	var req UpdateUserRequest
+	err = json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req)
+	if err != nil {
+		log.Errorf("invalid request body: %v", err)
+		respondWithError(w, r, invalidInput("request body", err))
+		return
+	}
+
+	err = api.validate.Struct(req)
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	// Assignments decide who may access the user, so only user managers change them
+	if req.SupportQueue != nil || req.CareTeam != nil {
+		principal, _ := auth.PrincipalFrom(r.Context())
+		if !auth.CanManageUsers(principal) || (req.SupportQueue != nil && !auth.CanAssignQueue(principal, *req.SupportQueue)) {
+			log.Errorf("%s %s may not change assignments of user %s", principal.Role, principal.Subject, userID)
+			respondWithError(w, r, auth.ErrForbidden)
+			return
+		}
+	}
+
+	update := domain.UserUpdate{
+		FirstName:    req.FirstName,
+		LastName:     req.LastName,
+		Email:        req.Email,
+		PhoneNumber:  req.PhoneNumber,
+		Timezone:     req.Timezone,
+		TargetRange:  req.TargetRange.toDomain(),
+		SupportQueue: req.SupportQueue,
+		CareTeam:     req.CareTeam,
+	}
+	if req.Unit != nil {
+		unit := domain.GlucoseUnit(*req.Unit)
+		update.Unit = &unit
+	}
+	if req.DateOfBirth != nil {
+		dateOfBirth, _ := time.Parse("2006-01-02", *req.DateOfBirth)
+		update.DateOfBirth = &dateOfBirth
+	}
+
+	user, err := api.userRepo.Update(r.Context(), userID, update)
+	if err != nil {
+		log.Errorf("failed to update user: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, toUserResponse(user))
+}
+
+func (api *API) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	log := api.log.With("method", "DeleteUser")
+	userID := chi.URLParam(r, "id")
+
+	err := api.validate.Var(userID, "required,mongodb")
+	if err != nil {
+		log.Errorf("validation error: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	err = api.userRepo.Delete(r.Context(), userID)
+	if err != nil {
+		log.Errorf("failed to delete user: %v", err)
+		respondWithError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findUserWithLocation fetches a user along with the time zone their readings are bucketed in.
+func (api *API) findUserWithLocation(ctx context.Context, userID string) (domain.User, *time.Location, error) {
+	user, err := api.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return domain.User{}, nil, err
+	}
+
+	loc, err := user.Location()
+	if err != nil {
+		return domain.User{}, nil, errors.Wrapf(err, "invalid timezone %q for user", user.Timezone)
+	}
+
+	return user, loc, nil
+}
+
+func toUserResponse(user domain.User) UserResponse {
+	return UserResponse{
+		ID:           user.ID.Hex(),
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		DateOfBirth:  user.DateOfBirth.Format("2006-01-02"),
+		Email:        user.Email,
+		PhoneNumber:  user.PhoneNumber,
+		Timezone:     timezoneName(user),
+		TargetRange:  toTargetRangeDTO(user.Targets()),
+		Unit:         string(user.PreferredUnit()),
+		SupportQueue: user.SupportQueue,
+		CareTeam:     careTeam(user),
+	}
+}
+
+// toDomain converts the request thresholds, a nil range stays nil.
+func (t *TargetRangeDTO) toDomain() *domain.TargetRange {
+	if t == nil {
+		return nil
+	}
+	return &domain.TargetRange{VeryLow: t.VeryLow, Low: t.Low, High: t.High, VeryHigh: t.VeryHigh}
+}
+
+func toTargetRangeDTO(t domain.TargetRange) TargetRangeDTO {
+	return TargetRangeDTO{VeryLow: t.VeryLow, Low: t.Low, High: t.High, VeryHigh: t.VeryHigh}
+}
+
+// careTeam returns the user's care team, never nil so it is always rendered as a JSON array.
+func careTeam(user domain.User) []string {
+	if user.CareTeam == nil {
+		return []string{}
+	}
+	return user.CareTeam
+}
+
+// timezoneName returns the IANA name of the user's time zone, defaulting to UTC.
+func timezoneName(user domain.User) string {
+	if user.Timezone == "" {
+		return "UTC"
+	}
+	return user.Timezone
+}
+
+// queryInt reads an integer query parameter, falling back to def when it is absent.
+func queryInt(r *http.Request, key string, def int) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, invalidInput(key, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"glooko/internal/auth"
+	"glooko/internal/domain"
+	"glooko/internal/mocks"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// serve routes req through the API, authenticated as a test caller unless it carries its own credentials.
+func serve(apiInstance *API, req *http.Request) *httptest.ResponseRecorder {
+	if req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", "Bearer "+testToken("test-admin", auth.RoleAdmin))
+	}
+
+	w := httptest.NewRecorder()
+	r := chi.NewRouter()
+	r.Mount("/", apiInstance.Routes())
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestListUsers(t *testing.T) {
+	userObjectID, _ := primitive.ObjectIDFromHex("1234567890abcdef12345678")
+	users := []domain.User{
+		{ID: userObjectID, FirstName: "Jane", LastName: "Doe", Email: "jane@example.com"},
+	}
+
+	testCases := []struct {
+		name       string
+		query      string
+		setupMock  func(userRepo *mocks.UserRepository)
+		expectCode int
+		expectLen  int
+	}{
+		{
+			name:  "Default Pagination",
+			query: "",
+			setupMock: func(userRepo *mocks.UserRepository) {
+				userRepo.On("Find", mock.Anything, domain.UserFilter{Limit: 50}).Return(users, int64(1), nil)
+			},
+			expectCode: http.StatusOK,
+			expectLen:  1,
+		},
+		{
+			name:  "Search By Email And Last Name",
+			query: "?email=jane@example.com&lastName=Do&limit=10&offset=20",
+			setupMock: func(userRepo *mocks.UserRepository) {
+				filter := domain.UserFilter{Email: "jane@example.com", LastName: "Do", Limit: 10, Offset: 20}
+				userRepo.On("Find", mock.Anything, filter).Return([]domain.User{}, int64(1), nil)
+			},
+			expectCode: http.StatusOK,
+			expectLen:  0,
+		},
+		{
+			name:       "Limit Too Large",
+			query:      "?limit=1000",
+			setupMock:  func(userRepo *mocks.UserRepository) {},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Invalid Email",
+			query:      "?email=not-an-email",
+			setupMock:  func(userRepo *mocks.UserRepository) {},
+			expectCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+			tc.setupMock(userRepo)
+
+			req, err := http.NewRequest("GET", "/users/"+tc.query, nil)
+			assert.NoError(t, err)
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, tc.expectCode, w.Code)
+
+			if tc.expectCode == http.StatusOK {
+				var response UserListResponse
+				err = json.NewDecoder(w.Body).Decode(&response)
+				assert.NoError(t, err)
+				assert.Len(t, response.Users, tc.expectLen)
+				assert.Equal(t, int64(1), response.Total)
+			}
+		})
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	apiInstance := setupAPI()
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+
+	userObjectID := primitive.NewObjectID()
+	userRepo.On("Save", mock.Anything, mock.MatchedBy(func(u domain.User) bool {
+		return u.Email == "jane@example.com" && u.DateOfBirth.Equal(time.Date(1990, 5, 1, 0, 0, 0, 0, time.UTC))
+	})).Return(func(_ context.Context, u domain.User) domain.User {
+		u.ID = userObjectID
+		return u
+	}, nil)
+
+	body := `{"firstName":"Jane","lastName":"Doe","dateOfBirth":"1990-05-01","email":"jane@example.com","phoneNumber":"555-0100"}`
+	req, err := http.NewRequest("POST", "/users/", strings.NewReader(body))
+	assert.NoError(t, err)
+
+	w := serve(apiInstance, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var response UserResponse
+	err = json.NewDecoder(w.Body).Decode(&response)
+	assert.NoError(t, err)
+	assert.Equal(t, userObjectID.Hex(), response.ID)
+	assert.Equal(t, "1990-05-01", response.DateOfBirth)
+
+	req, err = http.NewRequest("POST", "/users/", strings.NewReader(`{"firstName":"Jane"}`))
+	assert.NoError(t, err)
+
+	w = serve(apiInstance, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	invalidRange := `{"firstName":"Jane","lastName":"Doe","dateOfBirth":"1990-05-01","email":"jane@example.com","phoneNumber":"555-0100",` +
+		`"targetRange":{"veryLow":54,"low":180,"high":70,"veryHigh":250}}`
+	req, err = http.NewRequest("POST", "/users/", strings.NewReader(invalidRange))
+	assert.NoError(t, err)
+
+	w = serve(apiInstance, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetUser(t *testing.T) {
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+
+	testCases := []struct {
+		name       string
+		userID     string
+		setupMock  func(userRepo *mocks.UserRepository)
+		expectCode int
+	}{
+		{
+			name:   "Existing User",
+			userID: userID,
+			setupMock: func(userRepo *mocks.UserRepository) {
+				userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{ID: userObjectID, Email: "jane@example.com"}, nil)
+			},
+			expectCode: http.StatusOK,
+		},
+		{
+			name:   "Unknown User",
+			userID: userID,
+			setupMock: func(userRepo *mocks.UserRepository) {
+				userRepo.On("FindByID", mock.Anything, userID).Return(domain.User{}, errors.Wrap(domain.ErrNotFound, "user not found"))
+			},
+			expectCode: http.StatusNotFound,
+		},
+		{
+			name:       "Invalid ID",
+			userID:     "not-an-id",
+			setupMock:  func(userRepo *mocks.UserRepository) {},
+			expectCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiInstance := setupAPI()
+			userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+			tc.setupMock(userRepo)
+
+			req, err := http.NewRequest("GET", "/users/"+tc.userID, nil)
+			assert.NoError(t, err)
+
+			w := serve(apiInstance, req)
+			assert.Equal(t, tc.expectCode, w.Code)
+		})
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	apiInstance := setupAPI()
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+
+	userID := "1234567890abcdef12345678"
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+	email := "new@example.com"
+
+	userRepo.On("Update", mock.Anything, userID, domain.UserUpdate{Email: &email}).
+		Return(domain.User{ID: userObjectID, Email: email}, nil)
+
+	req, err := http.NewRequest("PATCH", "/users/"+userID, strings.NewReader(`{"email":"new@example.com"}`))
+	assert.NoError(t, err)
+
+	w := serve(apiInstance, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response UserResponse
+	err = json.NewDecoder(w.Body).Decode(&response)
+	assert.NoError(t, err)
+	assert.Equal(t, email, response.Email)
+}
+
+func TestDeleteUser(t *testing.T) {
+	apiInstance := setupAPI()
+	userRepo := apiInstance.userRepo.(*mocks.UserRepository)
+
+	userID := "1234567890abcdef12345678"
+	missingID := "abcdef1234567890abcdef12"
+	userRepo.On("Delete", mock.Anything, userID).Return(nil)
+	userRepo.On("Delete", mock.Anything, missingID).Return(errors.Wrap(domain.ErrNotFound, "user not found"))
+
+	req, err := http.NewRequest("DELETE", "/users/"+userID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, serve(apiInstance, req).Code)
+
+	req, err = http.NewRequest("DELETE", "/users/"+missingID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, serve(apiInstance, req).Code)
+}
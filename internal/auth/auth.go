@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+// ErrUnauthenticated is returned when a request carries no valid bearer token.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// leeway absorbs clock skew between the token issuer and this service.
+const leeway = 30 * time.Second
+
+// Config holds the keys tokens are verified with. HS256 tokens are accepted when HMACSecret is set,
+// RS256 tokens when JWKSFile points to a JSON Web Key Set holding the issuer's public keys.
+// Issuer and Audience are checked when set.
+type Config struct {
+	HMACSecret string
+	JWKSFile   string
+	Issuer     string
+	Audience   string
+}
+
+// Claims are the claims read from access tokens. Role is required, Queues lists the ticket
+// queues a support agent works.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role   Role     `json:"role"`
+	Queues []string `json:"queues,omitempty"`
+}
+
+// Principal is the authenticated caller of a request. For patients Subject is their user ID.
+type Principal struct {
+	Subject string
+	Role    Role
+	Queues  []string
+}
+
+// Authenticator verifies bearer tokens.
+type Authenticator struct {
+	hmacSecret []byte
+	rsaKeys    map[string]*rsa.PublicKey
+	parser     *jwt.Parser
+}
+
+func NewAuthenticator(cfg Config) (*Authenticator, error) {
+	a := &Authenticator{}
+	var methods []string
+
+	if cfg.HMACSecret != "" {
+		a.hmacSecret = []byte(cfg.HMACSecret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	if cfg.JWKSFile != "" {
+		keys, err := LoadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.rsaKeys = keys
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+
+	if len(methods) == 0 {
+		return nil, errors.New("no token verification keys configured")
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(leeway),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+	a.parser = jwt.NewParser(options...)
+
+	return a, nil
+}
+
+// Authenticate verifies a signed token and returns the principal it was issued to.
+func (a *Authenticator) Authenticate(tokenString string) (Principal, error) {
+	claims := Claims{}
+	_, err := a.parser.ParseWithClaims(tokenString, &claims, a.key)
+	if err != nil {
+		return Principal{}, errors.Wrap(ErrUnauthenticated, err.Error())
+	}
+
+	if claims.Subject == "" {
+		return Principal{}, errors.Wrap(ErrUnauthenticated, "token has no subject")
+	}
+
+	if !claims.Role.Valid() {
+		return Principal{}, errors.Wrapf(ErrUnauthenticated, "unknown role %q", claims.Role)
+	}
+
+	return Principal{Subject: claims.Subject, Role: claims.Role, Queues: claims.Queues}, nil
+}
+
+// AuthenticateRequest verifies the bearer token in the Authorization header of r.
+func (a *Authenticator) AuthenticateRequest(r *http.Request) (Principal, error) {
+	header := r.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return Principal{}, errors.Wrap(ErrUnauthenticated, "missing bearer token")
+	}
+	return a.Authenticate(strings.TrimSpace(token))
+}
+
+// key selects the verification key for a token, the signing method is already checked by the parser.
+func (a *Authenticator) key(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return a.hmacSecret, nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := a.rsaKeys[kid]; ok {
+			return key, nil
+		}
+		// Tokens without a key ID are accepted when the set holds a single key
+		if kid == "" && len(a.rsaKeys) == 1 {
+			for _, key := range a.rsaKeys {
+				return key, nil
+			}
+		}
+		return nil, errors.Errorf("unknown key ID %q", kid)
+	}
+	return nil, errors.Errorf("unexpected signing method %s", token.Method.Alg())
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying principal.
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal stored on ctx by the authentication middleware.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "test-secret-0123456789abcdef0123"
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims Claims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return signed
+}
+
+func writeJWKS(t *testing.T, kid string, key *rsa.PublicKey) string {
+	set := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			},
+			{"kty": "EC", "kid": "ignored", "crv": "P-256"},
+		},
+	}
+	data, err := json.Marshal(set)
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func TestAuthenticate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	authenticator, err := NewAuthenticator(Config{
+		HMACSecret: testSecret,
+		JWKSFile:   writeJWKS(t, "key-1", &rsaKey.PublicKey),
+		Issuer:     "https://auth.example.com",
+	})
+	assert.NoError(t, err)
+
+	valid := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			Issuer:    "https://auth.example.com",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Role:   RoleSupport,
+		Queues: []string{"emea"},
+	}
+	expired := valid
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	wrongIssuer := valid
+	wrongIssuer.Issuer = "https://evil.example.com"
+	noExpiry := valid
+	noExpiry.ExpiresAt = nil
+	noSubject := valid
+	noSubject.Subject = ""
+	noRole := valid
+	noRole.Role = ""
+	unknownRole := valid
+	unknownRole.Role = "superuser"
+
+	testCases := []struct {
+		name        string
+		token       string
+		expectError bool
+	}{
+		{name: "HS256", token: sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", valid)},
+		{name: "RS256", token: sign(t, jwt.SigningMethodRS256, rsaKey, "key-1", valid)},
+		{name: "RS256 Without Key ID", token: sign(t, jwt.SigningMethodRS256, rsaKey, "", valid)},
+		{name: "Unknown Key ID", token: sign(t, jwt.SigningMethodRS256, rsaKey, "key-2", valid), expectError: true},
+		{name: "Wrong RSA Key", token: sign(t, jwt.SigningMethodRS256, otherKey, "key-1", valid), expectError: true},
+		{name: "Wrong Secret", token: sign(t, jwt.SigningMethodHS256, []byte("another-secret"), "", valid), expectError: true},
+		{name: "Unsigned", token: sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", valid), expectError: true},
+		{name: "HS512", token: sign(t, jwt.SigningMethodHS512, []byte(testSecret), "", valid), expectError: true},
+		{name: "Expired", token: sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", expired), expectError: true},
+		{name: "No Expiry", token: sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", noExpiry), expectError: true},
+		{name: "Wrong Issuer", token: sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", wrongIssuer), expectError: true},
+		{name: "No Subject", token: sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", noSubject), expectError: true},
+		{name: "No Role", token: sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", noRole), expectError: true},
+		{name: "Unknown Role", token: sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", unknownRole), expectError: true},
+		{name: "Garbage", token: "not-a-token", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			principal, err := authenticator.Authenticate(tc.token)
+			if tc.expectError {
+				assert.ErrorIs(t, err, ErrUnauthenticated)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, Principal{Subject: "user-1", Role: RoleSupport, Queues: []string{"emea"}}, principal)
+		})
+	}
+}
+
+func TestAuthenticateRequest(t *testing.T) {
+	authenticator, err := NewAuthenticator(Config{HMACSecret: testSecret})
+	assert.NoError(t, err)
+
+	token := sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Role: RolePatient,
+	})
+
+	testCases := []struct {
+		name        string
+		header      string
+		expectError bool
+	}{
+		{name: "Bearer", header: "Bearer " + token},
+		{name: "Lower Case Scheme", header: "bearer " + token},
+		{name: "Missing", header: "", expectError: true},
+		{name: "Basic", header: "Basic dXNlcjpwYXNz", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/users", nil)
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", tc.header)
+
+			_, err = authenticator.AuthenticateRequest(req)
+			assert.Equal(t, tc.expectError, err != nil)
+		})
+	}
+}
+
+func TestNewAuthenticatorWithoutKeys(t *testing.T) {
+	_, err := NewAuthenticator(Config{})
+	assert.Error(t, err)
+
+	_, err = NewAuthenticator(Config{JWKSFile: filepath.Join(t.TempDir(), "missing.json")})
+	assert.Error(t, err)
+}
+
+func TestPrincipalContext(t *testing.T) {
+	_, ok := PrincipalFrom(context.Background())
+	assert.False(t, ok)
+
+	ctx := WithPrincipal(context.Background(), Principal{Subject: "user-1"})
+	principal, ok := PrincipalFrom(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "user-1", principal.Subject)
+}
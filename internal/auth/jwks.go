@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// jwk is a JSON Web Key as defined by RFC 7517, limited to the members of RSA public keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// LoadJWKS reads the RSA signing keys of a JSON Web Key Set file, keyed on their key ID.
+// Keys of other types or meant for encryption are skipped.
+func LoadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read JWKS file")
+	}
+
+	var set jwks
+	err = json.Unmarshal(data, &set)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse JWKS file")
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") || (key.Alg != "" && key.Alg != "RS256") {
+			continue
+		}
+
+		publicKey, err := rsaPublicKey(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key %q in JWKS file", key.Kid)
+		}
+		keys[key.Kid] = publicKey
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS file holds no RS256 signing keys")
+	}
+
+	return keys, nil
+}
+
+func rsaPublicKey(key jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid modulus")
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid exponent")
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("exponent out of range")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
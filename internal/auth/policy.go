@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"glooko/internal/domain"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+// ErrForbidden is returned when the principal is not entitled to the requested data.
+var ErrForbidden = errors.New("forbidden")
+
+// Role is the kind of caller an access token was issued to.
+type Role string
+
+const (
+	RolePatient   Role = "patient"
+	RoleCaregiver Role = "caregiver"
+	RoleClinician Role = "clinician"
+	RoleSupport   Role = "support"
+	RoleAdmin     Role = "admin"
+)
+
+// Valid reports whether r is one of the known roles.
+func (r Role) Valid() bool {
+	switch r {
+	case RolePatient, RoleCaregiver, RoleClinician, RoleSupport, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// Action is what a principal wants to do with a user's data.
+type Action string
+
+const (
+	ActionRead   Action = "read"
+	ActionWrite  Action = "write"
+	ActionDelete Action = "delete"
+)
+
+// Authorize decides whether principal may perform action on the data of user:
+//   - admins may do anything
+//   - support staff may read and write users assigned to one of their queues
+//   - clinicians may read and write users whose care team they are on
+//   - caregivers may read users whose care team they are on
+//   - patients may read and write their own data
+//
+// Only admins delete users.
+func Authorize(principal Principal, action Action, user domain.User) error {
+	if principal.Role == RoleAdmin {
+		return nil
+	}
+	if action == ActionDelete {
+		return errors.Wrapf(ErrForbidden, "%s may not delete users", principal.Role)
+	}
+
+	var entitled bool
+	switch principal.Role {
+	case RoleSupport:
+		entitled = user.SupportQueue != "" && slices.Contains(principal.Queues, user.SupportQueue)
+	case RoleClinician:
+		entitled = slices.Contains(user.CareTeam, principal.Subject)
+	case RoleCaregiver:
+		entitled = action == ActionRead && slices.Contains(user.CareTeam, principal.Subject)
+	case RolePatient:
+		entitled = user.ID.Hex() == principal.Subject
+	}
+
+	if !entitled {
+		return errors.Wrapf(ErrForbidden, "%s %s may not %s user %s", principal.Role, principal.Subject, action, user.ID.Hex())
+	}
+	return nil
+}
+
+// CanManageUsers reports whether principal may list and create users and assign them to
+// support queues and care teams.
+func CanManageUsers(principal Principal) bool {
+	return principal.Role == RoleAdmin || principal.Role == RoleSupport
+}
+
+// CanAssignQueue reports whether principal may assign users to queue. Support staff only assign
+// their own queues so they keep access to the users they assign.
+func CanAssignQueue(principal Principal, queue string) bool {
+	if principal.Role == RoleAdmin {
+		return true
+	}
+	return principal.Role == RoleSupport && (queue == "" || slices.Contains(principal.Queues, queue))
+}
+
+// SupportQueues returns the queues a user listing is restricted to for principal,
+// nil when it is not restricted.
+func SupportQueues(principal Principal) []string {
+	if principal.Role == RoleAdmin {
+		return nil
+	}
+	if principal.Queues == nil {
+		return []string{}
+	}
+	return principal.Queues
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"glooko/internal/domain"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAuthorize(t *testing.T) {
+	userID := primitive.NewObjectID()
+	user := domain.User{ID: userID, SupportQueue: "emea", CareTeam: []string{"clinician-1", "caregiver-1"}}
+
+	testCases := []struct {
+		name      string
+		principal Principal
+		action    Action
+		allowed   bool
+	}{
+		{name: "Admin Delete", principal: Principal{Subject: "admin-1", Role: RoleAdmin}, action: ActionDelete, allowed: true},
+		{name: "Patient Own Data", principal: Principal{Subject: userID.Hex(), Role: RolePatient}, action: ActionWrite, allowed: true},
+		{name: "Patient Other User", principal: Principal{Subject: primitive.NewObjectID().Hex(), Role: RolePatient}, action: ActionRead},
+		{name: "Patient Delete Self", principal: Principal{Subject: userID.Hex(), Role: RolePatient}, action: ActionDelete},
+		{name: "Clinician On Care Team", principal: Principal{Subject: "clinician-1", Role: RoleClinician}, action: ActionWrite, allowed: true},
+		{name: "Clinician Not On Care Team", principal: Principal{Subject: "clinician-2", Role: RoleClinician}, action: ActionRead},
+		{name: "Caregiver Read", principal: Principal{Subject: "caregiver-1", Role: RoleCaregiver}, action: ActionRead, allowed: true},
+		{name: "Caregiver Write", principal: Principal{Subject: "caregiver-1", Role: RoleCaregiver}, action: ActionWrite},
+		{name: "Support In Queue", principal: Principal{Subject: "agent-1", Role: RoleSupport, Queues: []string{"apac", "emea"}}, action: ActionWrite, allowed: true},
+		{name: "Support Other Queue", principal: Principal{Subject: "agent-1", Role: RoleSupport, Queues: []string{"apac"}}, action: ActionRead},
+		{name: "Care Team Member With Other Role", principal: Principal{Subject: "clinician-1", Role: RolePatient}, action: ActionRead},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Authorize(tc.principal, tc.action, user)
+			if tc.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrForbidden)
+			}
+		})
+	}
+}
+
+func TestSupportQueues(t *testing.T) {
+	assert.Nil(t, SupportQueues(Principal{Role: RoleAdmin}))
+	assert.Equal(t, []string{}, SupportQueues(Principal{Role: RoleSupport}))
+	assert.Equal(t, []string{"emea"}, SupportQueues(Principal{Role: RoleSupport, Queues: []string{"emea"}}))
+
+	assert.True(t, CanAssignQueue(Principal{Role: RoleAdmin}, "apac"))
+	assert.True(t, CanAssignQueue(Principal{Role: RoleSupport, Queues: []string{"emea"}}, "emea"))
+	assert.False(t, CanAssignQueue(Principal{Role: RoleSupport, Queues: []string{"emea"}}, "apac"))
+	assert.False(t, CanAssignQueue(Principal{Role: RoleClinician}, ""))
+}
@@ -7,17 +7,39 @@ import (
 	"github.com/pkg/errors"
 )
 
+// defaultStorageDriver is used when STORAGE_DRIVER is not set.
+const defaultStorageDriver = "mongodb"
+
 type Config struct {
-	MongoDBURI  string `validate:"required"`
-	MongoDBName string `validate:"required"`
-	ServerPort  string `validate:"required"`
+	// StorageDriver selects the repositories, memory needs no database and keeps no data between runs
+	StorageDriver string `validate:"oneof=mongodb postgres memory"`
+	MongoDBURI    Secret `validate:"required_if=StorageDriver mongodb"` // May carry credentials
+	MongoDBName   string `validate:"required_if=StorageDriver mongodb"`
+	PostgresURL   Secret `validate:"required_if=StorageDriver postgres"` // May carry credentials
+	ServerPort    string `validate:"required"`
+}
+
+// AuthConfig holds the bearer token settings, only the API server authenticates requests so the
+// command line tools don't load it.
+type AuthConfig struct {
+	// Bearer tokens are verified with the HS256 secret, the RS256 keys in the JWKS file, or both
+	JWTHMACSecret Secret `validate:"required_without=JWTJWKSFile,omitempty,min=32"`
+	JWTJWKSFile   string `validate:"required_without=JWTHMACSecret,omitempty,file"`
+	JWTIssuer     string
+	JWTAudience   string
 }
 
 func LoadConfig() (*Config, error) {
 	config := &Config{
-		MongoDBURI:  os.Getenv("MONGODB_URI"),
-		MongoDBName: os.Getenv("MONGODB_NAME"),
-		ServerPort:  os.Getenv("SERVER_PORT"),
+		StorageDriver: os.Getenv("STORAGE_DRIVER"),
+		MongoDBURI:    Secret(os.Getenv("MONGODB_URI")),
+		MongoDBName:   os.Getenv("MONGODB_NAME"),
+		PostgresURL:   Secret(os.Getenv("POSTGRES_URL")),
+		ServerPort:    os.Getenv("SERVER_PORT"),
+	}
+
+	if config.StorageDriver == "" {
+		config.StorageDriver = defaultStorageDriver
 	}
 
 	validate := validator.New()
@@ -27,3 +49,19 @@ func LoadConfig() (*Config, error) {
 
 	return config, nil
 }
+
+func LoadAuthConfig() (*AuthConfig, error) {
+	config := &AuthConfig{
+		JWTHMACSecret: Secret(os.Getenv("JWT_HMAC_SECRET")),
+		JWTJWKSFile:   os.Getenv("JWT_JWKS_FILE"),
+		JWTIssuer:     os.Getenv("JWT_ISSUER"),
+		JWTAudience:   os.Getenv("JWT_AUDIENCE"),
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(config); err != nil {
+		return nil, errors.Wrap(err, "failed to validate auth config")
+	}
+
+	return config, nil
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	// The command line tools load the storage settings without any JWT settings
+	t.Setenv("STORAGE_DRIVER", "memory")
+	t.Setenv("SERVER_PORT", ":8080")
+	t.Setenv("JWT_HMAC_SECRET", "")
+	t.Setenv("JWT_JWKS_FILE", "")
+
+	cfg, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "memory", cfg.StorageDriver)
+
+	_, err = LoadAuthConfig()
+	assert.Error(t, err)
+}
+
+func TestLoadAuthConfig(t *testing.T) {
+	testCases := []struct {
+		name        string
+		hmacSecret  string
+		expectError bool
+	}{
+		{name: "HMAC Secret", hmacSecret: "0123456789abcdef0123456789abcdef"},
+		{name: "Short HMAC Secret", hmacSecret: "0123456789abcdef", expectError: true},
+		{name: "No Keys", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("JWT_HMAC_SECRET", tc.hmacSecret)
+			t.Setenv("JWT_JWKS_FILE", "")
+
+			cfg, err := LoadAuthConfig()
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.hmacSecret, cfg.JWTHMACSecret.Reveal())
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package config
+
+// redacted is printed in place of secret values.
+const redacted = "***"
+
+// Secret is a configuration value that must not end up in logs. It prints as *** through fmt,
+// encoding/json and zap, Reveal returns the value itself.
+type Secret string
+
+// Reveal returns the secret value, call it only where the value is handed to its consumer.
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecret(t *testing.T) {
+	cfg := Config{
+		MongoDBURI:  "mongodb://admin:hunter2@db:27017",
+		MongoDBName: "glooko",
+	}
+	authCfg := AuthConfig{
+		JWTHMACSecret: "0123456789abcdef0123456789abcdef",
+	}
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		printed := fmt.Sprintf(format, cfg)
+		assert.NotContains(t, printed, "hunter2", format)
+		printed = fmt.Sprintf(format, authCfg)
+		assert.NotContains(t, printed, "0123456789abcdef", format)
+	}
+
+	data, err := json.Marshal(cfg)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"MongoDBURI":"***"`)
+	assert.Contains(t, string(data), `"PostgresURL":""`)
+
+	assert.Equal(t, "mongodb://admin:hunter2@db:27017", cfg.MongoDBURI.Reveal())
+}
@@ -1,11 +1,31 @@
 package domain
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	// ErrNotFound is returned by repositories when the requested entity does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidID is returned when an entity ID is malformed.
+	ErrInvalidID = errors.New("invalid ID")
+	// ErrInvalidRange is returned when a date or value range is malformed or empty.
+	ErrInvalidRange = errors.New("invalid range")
+	// ErrConflict is returned when a change conflicts with the current state of an entity.
+	ErrConflict = errors.New("conflict")
+	// ErrInvalidInput is returned when a value supplied by the caller cannot be used.
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrDuplicate is reported for a reading of a batch that was skipped because the device
+	// already has a reading at its time.
+	ErrDuplicate = errors.New("duplicate")
+)
+
 // User represents a person in the system.
 type User struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty"`
@@ -14,25 +34,226 @@ type User struct {
 	DateOfBirth time.Time          `bson:"dateOfBirth"`
 	Email       string             `bson:"email"`
 	PhoneNumber string             `bson:"phoneNumber"`
+	Timezone    string             `bson:"timezone,omitempty"` // IANA time zone name, UTC when empty
+	TargetRange *TargetRange       `bson:"targetRange,omitempty"`
+	Unit        GlucoseUnit        `bson:"unit,omitempty"` // Preferred unit for reports, mg/dL when empty
 	Devices     []Device           `bson:"devices"`
+
+	// Access is granted to the support staff working the user's ticket queue and to the
+	// caregivers and clinicians listed, by the subject of their access tokens, in the care team.
+	SupportQueue string   `bson:"supportQueue,omitempty"`
+	CareTeam     []string `bson:"careTeam,omitempty"`
+
+	// NightscoutSecretHash is the hex SHA-256 of the SHA1 hex digest uploaders present for the
+	// user's Nightscout API_SECRET. The Nightscout site is disabled while it is empty.
+	NightscoutSecretHash string `bson:"nightscoutSecretHash,omitempty"`
+}
+
+// PreferredUnit returns the unit the user wants glucose reported in.
+func (u User) PreferredUnit() GlucoseUnit {
+	if u.Unit == "" {
+		return MgDL
+	}
+	return u.Unit
+}
+
+// TargetRange holds the glucose thresholds (mg/dL) used to compute time in range.
+// Values below VeryLow are very low, below Low are low, up to High are in range,
+// up to VeryHigh are high and anything above is very high.
+type TargetRange struct {
+	VeryLow  int `bson:"veryLow"`
+	Low      int `bson:"low"`
+	High     int `bson:"high"`
+	VeryHigh int `bson:"veryHigh"`
 }
 
+// DefaultTargetRange follows the international consensus on time in range.
+var DefaultTargetRange = TargetRange{VeryLow: 54, Low: 70, High: 180, VeryHigh: 250}
+
+// Targets returns the user's target range, falling back to DefaultTargetRange.
+func (u User) Targets() TargetRange {
+	if u.TargetRange == nil {
+		return DefaultTargetRange
+	}
+	return *u.TargetRange
+}
+
+// Location returns the user's time zone used to split readings into days.
+func (u User) Location() (*time.Location, error) {
+	if u.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(u.Timezone)
+}
+
+// DayOf returns the calendar day of t, as seen in t's own location, expressed as midnight UTC.
+// Readings are bucketed by this key so a patient's local day maps to a single stable date
+// regardless of UTC offset or daylight saving transitions.
+func DayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// LocalMidnight returns the instant the day key returned by DayOf starts at in loc.
+func LocalMidnight(day time.Time, loc *time.Location) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+}
+
+// UserFilter narrows down and paginates a user listing.
+type UserFilter struct {
+	Email         string   // Exact match on email, ignored when empty
+	LastName      string   // Case-insensitive prefix match on last name, ignored when empty
+	SupportQueues []string // Users assigned to any of these queues, ignored when nil
+	Limit         int
+	Offset        int
+}
+
+// UserUpdate holds the fields of a user to change, nil fields are left untouched.
+type UserUpdate struct {
+	FirstName   *string
+	LastName    *string
+	DateOfBirth *time.Time
+	Email       *string
+	PhoneNumber *string
+	Timezone    *string
+	TargetRange *TargetRange
+	Unit        *GlucoseUnit
+
+	SupportQueue *string
+	CareTeam     *[]string
+
+	NightscoutSecretHash *string
+}
+
+// DeviceStatus is the lifecycle state of a device.
+type DeviceStatus string
+
+const (
+	DeviceActive   DeviceStatus = "active"   // Device is in use and expected to upload readings
+	DeviceReplaced DeviceStatus = "replaced" // Device was swapped for another device
+	DeviceRetired  DeviceStatus = "retired"  // Device was taken out of use
+)
+
 // Device represents a glucose measuring device used by a user.
 type Device struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty"`
-	UserID       primitive.ObjectID `bson:"userId"`
-	Manufacturer string             `bson:"manufacturer"`
-	Model        string             `bson:"model"`
-	SerialNumber string             `bson:"serialNumber"`
+	ID           primitive.ObjectID  `bson:"_id,omitempty"`
+	UserID       primitive.ObjectID  `bson:"userId"`
+	Manufacturer string              `bson:"manufacturer"`
+	Model        string              `bson:"model"`
+	SerialNumber string              `bson:"serialNumber"`
+	Status       DeviceStatus        `bson:"status,omitempty"`
+	ActivatedAt  time.Time           `bson:"activatedAt,omitempty"`
+	ReplacedAt   *time.Time          `bson:"replacedAt,omitempty"`
+	ReplacedBy   *primitive.ObjectID `bson:"replacedBy,omitempty"`
+	RetiredAt    *time.Time          `bson:"retiredAt,omitempty"`
+}
+
+// Lifecycle returns the device status, devices stored before lifecycle tracking are active.
+func (d Device) Lifecycle() DeviceStatus {
+	if d.Status == "" {
+		return DeviceActive
+	}
+	return d.Status
+}
+
+// DeviceUpdate holds the fields of a device to change, nil fields are left untouched.
+type DeviceUpdate struct {
+	UserID       *primitive.ObjectID
+	Manufacturer *string
+	Model        *string
+	SerialNumber *string
+	Status       *DeviceStatus
+	ReplacedAt   *time.Time
+	ReplacedBy   *primitive.ObjectID
+	RetiredAt    *time.Time
+}
+
+// GlucoseUnit is the unit a glucose concentration is expressed in.
+type GlucoseUnit string
+
+const (
+	MgDL  GlucoseUnit = "mg/dL"
+	MmolL GlucoseUnit = "mmol/L"
+)
+
+// MgDLPerMmolL converts glucose concentrations between mmol/L and mg/dL.
+const MgDLPerMmolL = 18.0182
+
+// ParseGlucoseUnit accepts the canonical unit names as well as the short forms "mg" and "mmol".
+func ParseGlucoseUnit(s string) (GlucoseUnit, error) {
+	switch strings.ToLower(s) {
+	case "mg/dl", "mgdl", "mg":
+		return MgDL, nil
+	case "mmol/l", "mmoll", "mmol":
+		return MmolL, nil
+	}
+	return "", fmt.Errorf("unknown glucose unit %q: %w", s, ErrInvalidInput)
+}
+
+// FromMgDL converts a mg/dL value to the unit without rounding.
+func (u GlucoseUnit) FromMgDL(value float64) float64 {
+	if u == MmolL {
+		return value / MgDLPerMmolL
+	}
+	return value
+}
+
+// Round rounds a single reading to the precision customary for the unit,
+// whole numbers for mg/dL and one decimal for mmol/L.
+func (u GlucoseUnit) Round(value float64) float64 {
+	if u == MmolL {
+		return math.Round(value*10) / 10
+	}
+	return math.Round(value)
+}
+
+// RoundDerived rounds a derived value such as an average with one more decimal than Round.
+func (u GlucoseUnit) RoundDerived(value float64) float64 {
+	if u == MmolL {
+		return math.Round(value*100) / 100
+	}
+	return math.Round(value*10) / 10
+}
+
+// Glucose is a glucose concentration in a given unit.
+type Glucose struct {
+	Value float64
+	Unit  GlucoseUnit
+}
+
+// MgDL returns the concentration in whole mg/dL, the unit readings are stored in.
+func (g Glucose) MgDL() int {
+	if g.Unit == MmolL {
+		return int(math.Round(g.Value * MgDLPerMmolL))
+	}
+	return int(math.Round(g.Value))
+}
+
+// In converts the concentration to unit, rounded as a single reading.
+func (g Glucose) In(unit GlucoseUnit) Glucose {
+	mgdl := g.Value
+	if g.Unit == MmolL {
+		mgdl = g.Value * MgDLPerMmolL
+	}
+	return Glucose{Value: unit.Round(unit.FromMgDL(mgdl)), Unit: unit}
 }
 
 // Reading represents a glucose level reading taken from a device.
+// Value is stored in mg/dL.
 type ReadingEntry struct {
 	Time  time.Time `bson:"time"`
 	Value int       `bson:"value"`
 }
 
+// DeviceReading is a reading of one of a user's devices, the unit of batched ingestion.
+// Value is in mg/dL.
+type DeviceReading struct {
+	DeviceID string
+	Time     time.Time
+	Value    int
+}
+
 // Reading represents a glucose level readings for a day taken from a device.
+// Day is the patient's local calendar day as returned by DayOf.
 type Reading struct {
 	ID            primitive.ObjectID `bson:"_id,omitempty"`
 	UserID        primitive.ObjectID `bson:"userId"`
@@ -57,3 +278,57 @@ type DayDeviceCounts struct {
 	Day     time.Time     `json:"day"`     // The day for which readings are counted
 	Devices []DeviceCount `json:"devices"` // List of device counts for the day
 }
+
+// EventType is the kind of a glycemic episode.
+type EventType string
+
+const (
+	EventHypoglycemia  EventType = "hypoglycemia"
+	EventHyperglycemia EventType = "hyperglycemia"
+)
+
+// GlucoseEvent represents a hypoglycemic or hyperglycemic episode detected in a device's readings.
+type GlucoseEvent struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	UserID   primitive.ObjectID `bson:"userId"`
+	DeviceID primitive.ObjectID `bson:"deviceId"`
+	Type     EventType          `bson:"type"`
+	Level    int                `bson:"level"`
+	Start    time.Time          `bson:"start"`
+	End      time.Time          `bson:"end"`
+	Extreme  int                `bson:"extreme"` // Nadir of a hypoglycemia or peak of a hyperglycemia
+}
+
+// AuditOutcome tells whether an audited request was served.
+type AuditOutcome string
+
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditDenied  AuditOutcome = "denied" // The caller was not entitled to the data
+	AuditFailure AuditOutcome = "failure"
+)
+
+// AuditEntry records an access to a patient's protected health information.
+// Subject is the ID of the user whose data was accessed.
+type AuditEntry struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty"`
+	Time       time.Time           `bson:"time"`
+	Actor      string              `bson:"actor"`
+	ActorRole  string              `bson:"actorRole"`
+	Subject    string              `bson:"subject"`
+	Method     string              `bson:"method"`
+	Endpoint   string              `bson:"endpoint"` // Route pattern, e.g. /users/{id}/overview
+	Parameters map[string][]string `bson:"parameters,omitempty"`
+	Status     int                 `bson:"status"`
+	Outcome    AuditOutcome        `bson:"outcome"`
+}
+
+// AuditFilter narrows down and paginates the audit trail, newest entries first.
+type AuditFilter struct {
+	Actor   string    // Exact match on actor, ignored when empty
+	Subject string    // Exact match on subject, ignored when empty
+	From    time.Time // Entries at or after From, ignored when zero
+	To      time.Time // Entries before To, ignored when zero
+	Limit   int
+	Offset  int
+}
@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlucose(t *testing.T) {
+	assert.Equal(t, 100, Glucose{Value: 100, Unit: MgDL}.MgDL())
+	assert.Equal(t, 99, Glucose{Value: 5.5, Unit: MmolL}.MgDL())
+	assert.Equal(t, 180, Glucose{Value: 10, Unit: MmolL}.MgDL())
+
+	assert.Equal(t, Glucose{Value: 5.5, Unit: MmolL}, Glucose{Value: 99, Unit: MgDL}.In(MmolL))
+	assert.Equal(t, Glucose{Value: 3.9, Unit: MmolL}, Glucose{Value: 70, Unit: MgDL}.In(MmolL))
+	assert.Equal(t, Glucose{Value: 5.6, Unit: MmolL}, Glucose{Value: 5.55, Unit: MmolL}.In(MmolL))
+	assert.Equal(t, Glucose{Value: 126, Unit: MgDL}, Glucose{Value: 7, Unit: MmolL}.In(MgDL))
+}
+
+func TestParseGlucoseUnit(t *testing.T) {
+	for _, s := range []string{"mg/dL", "mg/dl", "mg"} {
+		unit, err := ParseGlucoseUnit(s)
+		assert.NoError(t, err)
+		assert.Equal(t, MgDL, unit)
+	}
+	for _, s := range []string{"mmol/L", "mmol"} {
+		unit, err := ParseGlucoseUnit(s)
+		assert.NoError(t, err)
+		assert.Equal(t, MmolL, unit)
+	}
+
+	_, err := ParseGlucoseUnit("g/L")
+	assert.Error(t, err)
+}
+
+func TestGlucoseUnitRounding(t *testing.T) {
+	assert.Equal(t, 108.0, MgDL.Round(107.5))
+	assert.Equal(t, 107.5, MgDL.RoundDerived(107.46))
+	assert.Equal(t, 6.0, MmolL.Round(MmolL.FromMgDL(107.5)))
+	assert.Equal(t, 5.97, MmolL.RoundDerived(MmolL.FromMgDL(107.5)))
+}
+
+func TestDayOf(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+
+	// 23:30 UTC on the last Sunday of March is already the next day in Berlin
+	ts := time.Date(2024, 3, 30, 23, 30, 0, 0, time.UTC).In(loc)
+	assert.Equal(t, time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC), DayOf(ts))
+}
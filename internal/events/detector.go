@@ -0,0 +1,86 @@
+package events
+
+import (
+	"context"
+	"glooko/internal/analytics"
+	"glooko/internal/domain"
+	"glooko/internal/ports"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Detector keeps the stored hypo- and hyperglycemia events of devices in line with their readings.
+type Detector struct {
+	readingsRepo ports.ReadingRepository
+	eventRepo    ports.EventRepository
+}
+
+func NewDetector(readingsRepo ports.ReadingRepository, eventRepo ports.EventRepository) *Detector {
+	return &Detector{
+		readingsRepo: readingsRepo,
+		eventRepo:    eventRepo,
+	}
+}
+
+// Detect re-runs episode detection for a device over the local days spanned by from and to, plus
+// a day on either side so episodes crossing midnight are complete, and replaces the device's
+// events starting in that window with the episodes found. Readings of a further day on each side
+// are analysed so episodes running over the window's edges keep their start and end.
+//
+// Callers run it after the readings are stored and only report a failure, nothing retries it: the
+// window keeps its previous events until readings uploaded for the same days re-detect them.
+func (d *Detector) Detect(ctx context.Context, user domain.User, loc *time.Location, deviceID primitive.ObjectID, from, to time.Time) error {
+	firstDay := domain.DayOf(from.In(loc)).AddDate(0, 0, -1)
+	lastDay := domain.DayOf(to.In(loc)).AddDate(0, 0, 1)
+	start := domain.LocalMidnight(firstDay, loc)
+	end := domain.LocalMidnight(lastDay.AddDate(0, 0, 1), loc).Add(-time.Nanosecond)
+
+	// Buckets stored before readings were keyed by the patient's local day hold readings of the
+	// neighbouring local days, so the buckets of another day on each side are fetched
+	readStart, readEnd := firstDay.AddDate(0, 0, -1), lastDay.AddDate(0, 0, 1)
+	bucketStart, bucketEnd := readStart.AddDate(0, 0, -1), readEnd.AddDate(0, 0, 1)
+	readings, err := d.readingsRepo.FetchReadings(ctx, user.ID.Hex(), bucketStart, bucketEnd.AddDate(0, 0, 1).Add(-time.Nanosecond))
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch readings")
+	}
+
+	var entries []domain.ReadingEntry
+	for _, reading := range readings {
+		if reading.DeviceID != deviceID {
+			continue
+		}
+		for _, entry := range reading.Readings {
+			day := domain.DayOf(entry.Time.In(loc))
+			if day.Before(readStart) || day.After(readEnd) {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	events := []domain.GlucoseEvent{}
+	for _, episode := range analytics.DetectEvents(entries, user.Targets()) {
+		// Episodes starting outside the window are left as stored
+		if episode.Start.Before(start) || episode.Start.After(end) {
+			continue
+		}
+		events = append(events, domain.GlucoseEvent{
+			UserID:   user.ID,
+			DeviceID: deviceID,
+			Type:     episode.Type,
+			Level:    episode.Level,
+			Start:    episode.Start,
+			End:      episode.End,
+			Extreme:  episode.Extreme,
+		})
+	}
+
+	err = d.eventRepo.ReplaceEvents(ctx, user.ID.Hex(), deviceID.Hex(), start, end, events)
+	if err != nil {
+		return errors.Wrap(err, "failed to replace events")
+	}
+
+	return nil
+}
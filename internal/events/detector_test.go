@@ -0,0 +1,51 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+	"glooko/internal/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDetect(t *testing.T) {
+	readingsRepo := new(mocks.ReadingRepository)
+	eventRepo := new(mocks.EventRepository)
+
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	user := domain.User{ID: primitive.NewObjectID(), Timezone: "America/New_York"}
+	userID := user.ID.Hex()
+	deviceID := primitive.NewObjectID()
+
+	// A reading late on the local 6 April is on 7 April in UTC
+	reading := time.Date(2024, 4, 6, 23, 30, 0, 0, loc)
+	day := time.Date(2024, 4, 6, 0, 0, 0, 0, time.UTC)
+	low := []domain.ReadingEntry{
+		{Time: reading, Value: 60},
+		{Time: reading.Add(5 * time.Minute), Value: 60},
+		{Time: reading.Add(10 * time.Minute), Value: 60},
+		{Time: reading.Add(15 * time.Minute), Value: 60},
+	}
+	stored := []domain.Reading{{UserID: user.ID, DeviceID: deviceID, Day: day, Readings: low}}
+	readingsRepo.On("FetchReadings", mock.Anything, userID, day.AddDate(0, 0, -3), day.AddDate(0, 0, 4).Add(-time.Nanosecond)).Return(stored, nil).Once()
+
+	// The local days 5 to 7 April are re-detected
+	start := time.Date(2024, 4, 5, 0, 0, 0, 0, loc)
+	end := time.Date(2024, 4, 8, 0, 0, 0, 0, loc).Add(-time.Nanosecond)
+	eventRepo.On("ReplaceEvents", mock.Anything, userID, deviceID.Hex(), start, end, mock.MatchedBy(func(events []domain.GlucoseEvent) bool {
+		return len(events) == 1 && events[0].Type == domain.EventHypoglycemia && events[0].Start.Equal(reading) &&
+			events[0].UserID == user.ID && events[0].DeviceID == deviceID
+	})).Return(nil).Once()
+
+	err = NewDetector(readingsRepo, eventRepo).Detect(context.Background(), user, loc, deviceID, reading, reading.Add(15*time.Minute))
+	assert.NoError(t, err)
+
+	readingsRepo.AssertExpectations(t)
+	eventRepo.AssertExpectations(t)
+}
@@ -0,0 +1,216 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"glooko/internal/domain"
+	"glooko/internal/events"
+	"glooko/internal/ports"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxReportedErrors caps the rejected rows listed in a summary, the count is always complete.
+const maxReportedErrors = 100
+
+// ErrEventDetection is returned along with the summary when the readings were stored but the
+// events of the days they fall on could not be detected again.
+var ErrEventDetection = errors.New("failed to detect events")
+
+// DeviceSummary reports what was imported for a single device.
+type DeviceSummary struct {
+	DeviceID     string    `json:"deviceId"`
+	SerialNumber string    `json:"serialNumber"`
+	Created      bool      `json:"created"`
+	Accepted     int       `json:"accepted"`
+	Duplicated   int       `json:"duplicated"`
+	Failed       int       `json:"failed"` // Readings that could not be stored, storing them again is safe
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+}
+
+// Summary reports the outcome of an import.
+type Summary struct {
+	Format     Format          `json:"format"`
+	Accepted   int             `json:"accepted"`
+	Duplicated int             `json:"duplicated"`
+	Failed     int             `json:"failed"`
+	Rejected   int             `json:"rejected"`
+	Devices    []DeviceSummary `json:"devices"`
+	Errors     []RowError      `json:"errors"`
+}
+
+// Importer stores vendor exports and other third-party uploads for a user, creating the
+// devices found in them as needed.
+type Importer struct {
+	deviceRepo   ports.DeviceRepository
+	readingsRepo ports.ReadingRepository
+	detector     *events.Detector
+}
+
+func NewImporter(deviceRepo ports.DeviceRepository, readingsRepo ports.ReadingRepository, detector *events.Detector) *Importer {
+	return &Importer{
+		deviceRepo:   deviceRepo,
+		readingsRepo: readingsRepo,
+		detector:     detector,
+	}
+}
+
+// Import parses an export and stores its readings for user, see Store. Like Store it returns the
+// summary along with ErrEventDetection.
+func (im *Importer) Import(ctx context.Context, user domain.User, r io.Reader) (Summary, error) {
+	loc, err := user.Location()
+	if err != nil {
+		return Summary{}, errors.Wrapf(err, "invalid timezone %q for user", user.Timezone)
+	}
+
+	parsed, err := Parse(r, loc)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	summary, err := im.Store(ctx, user, parsed.Devices)
+	if err != nil && !errors.Is(err, ErrEventDetection) {
+		return Summary{}, err
+	}
+
+	summary.Format = parsed.Format
+	summary.Rejected = len(parsed.Rejected)
+	if parsed.Rejected != nil {
+		summary.Errors = parsed.Rejected
+	}
+	if len(summary.Errors) > maxReportedErrors {
+		summary.Errors = summary.Errors[:maxReportedErrors]
+	}
+
+	return summary, err
+}
+
+// Store saves readings for user. Devices are matched on manufacturer and serial number and created
+// when the user has no such device yet. The readings of all devices are stored in one batch, those
+// already stored for a device at the same time, including those repeated in devices, are counted
+// as duplicated and skipped, so the same data can be stored again safely.
+//
+// Events are then detected again over the span of every device readings were stored for. When
+// that fails the summary is returned along with ErrEventDetection, the readings are stored.
+func (im *Importer) Store(ctx context.Context, user domain.User, devices []DeviceReadings) (Summary, error) {
+	loc, err := user.Location()
+	if err != nil {
+		return Summary{}, errors.Wrapf(err, "invalid timezone %q for user", user.Timezone)
+	}
+
+	summary := Summary{
+		Devices: []DeviceSummary{},
+		Errors:  []RowError{},
+	}
+
+	userID := user.ID.Hex()
+	existing, err := im.deviceRepo.FindByUser(ctx, userID)
+	if err != nil {
+		return Summary{}, errors.Wrap(err, "failed to fetch devices")
+	}
+
+	var batch []domain.DeviceReading
+	var owners []int // Position in summary.Devices of the device of each reading in batch
+	for _, imported := range devices {
+		if len(imported.Entries) == 0 {
+			continue
+		}
+
+		device, created, err := im.findOrCreateDevice(ctx, user, existing, imported)
+		if err != nil {
+			return Summary{}, err
+		}
+		if created {
+			existing = append(existing, device)
+		}
+
+		summary.Devices = append(summary.Devices, DeviceSummary{
+			DeviceID:     device.ID.Hex(),
+			SerialNumber: device.SerialNumber,
+			Created:      created,
+			From:         imported.Entries[0].Time,
+			To:           imported.Entries[len(imported.Entries)-1].Time,
+		})
+		for _, entry := range imported.Entries {
+			batch = append(batch, domain.DeviceReading{DeviceID: device.ID.Hex(), Time: entry.Time.In(loc), Value: entry.Value})
+			owners = append(owners, len(summary.Devices)-1)
+		}
+	}
+
+	if len(batch) == 0 {
+		return summary, nil
+	}
+
+	results, err := im.readingsRepo.AddReadingsAndUpdateStats(ctx, userID, batch)
+	if err != nil {
+		return Summary{}, errors.Wrap(err, "failed to add readings")
+	}
+
+	for i, err := range results {
+		deviceSummary := &summary.Devices[owners[i]]
+		switch {
+		case err == nil:
+			deviceSummary.Accepted++
+		case errors.Is(err, domain.ErrDuplicate):
+			deviceSummary.Duplicated++
+		default:
+			deviceSummary.Failed++
+		}
+	}
+
+	for _, deviceSummary := range summary.Devices {
+		summary.Accepted += deviceSummary.Accepted
+		summary.Duplicated += deviceSummary.Duplicated
+		summary.Failed += deviceSummary.Failed
+	}
+
+	err = im.detectEvents(ctx, user, loc, summary.Devices)
+	if err != nil {
+		return summary, fmt.Errorf("%w: %v", ErrEventDetection, err)
+	}
+
+	return summary, nil
+}
+
+// detectEvents runs event detection over the span of every device readings were stored for.
+func (im *Importer) detectEvents(ctx context.Context, user domain.User, loc *time.Location, devices []DeviceSummary) error {
+	for _, device := range devices {
+		if device.Accepted == 0 {
+			continue
+		}
+
+		deviceID, err := primitive.ObjectIDFromHex(device.DeviceID)
+		if err != nil {
+			return errors.Wrap(err, "invalid device ID")
+		}
+
+		err = im.detector.Detect(ctx, user, loc, deviceID, device.From, device.To)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *Importer) findOrCreateDevice(ctx context.Context, user domain.User, existing []domain.Device, imported DeviceReadings) (domain.Device, bool, error) {
+	for _, device := range existing {
+		if device.Manufacturer == imported.Device.Manufacturer && device.SerialNumber == imported.Device.SerialNumber {
+			return device, false, nil
+		}
+	}
+
+	device := imported.Device
+	device.UserID = user.ID
+	device.Status = domain.DeviceActive
+	device.ActivatedAt = imported.Entries[0].Time.UTC()
+
+	device, err := im.deviceRepo.Save(ctx, device)
+	if err != nil {
+		return domain.Device{}, false, errors.Wrap(err, "failed to save device")
+	}
+	return device, true, nil
+}
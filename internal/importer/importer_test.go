@@ -0,0 +1,158 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+	"glooko/internal/events"
+	"glooko/internal/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestImport(t *testing.T) {
+	deviceRepo := new(mocks.DeviceRepository)
+	readingsRepo := new(mocks.ReadingRepository)
+	eventRepo := new(mocks.EventRepository)
+
+	user := domain.User{ID: primitive.NewObjectID()}
+	userID := user.ID.Hex()
+
+	// The LibreLink sensor is known already, the Libre 2 is created by the import
+	known := domain.Device{ID: primitive.NewObjectID(), UserID: user.ID, Manufacturer: "Abbott", SerialNumber: "ABC-123"}
+	created := primitive.NewObjectID()
+	deviceRepo.On("FindByUser", mock.Anything, userID).Return([]domain.Device{known}, nil)
+	deviceRepo.On("Save", mock.Anything, mock.MatchedBy(func(device domain.Device) bool {
+		return device.SerialNumber == "XYZ-789" && device.UserID == user.ID && device.Status == domain.DeviceActive
+	})).Return(func(_ context.Context, device domain.Device) (domain.Device, error) {
+		device.ID = created
+		return device, nil
+	})
+
+	// The 08:00 reading of the known sensor is stored already
+	batch := []domain.DeviceReading{
+		{DeviceID: known.ID.Hex(), Time: time.Date(2024, 4, 6, 8, 0, 0, 0, time.UTC), Value: 99},
+		{DeviceID: known.ID.Hex(), Time: time.Date(2024, 4, 6, 8, 7, 0, 0, time.UTC), Value: 112},
+		{DeviceID: created.Hex(), Time: time.Date(2024, 4, 6, 13, 15, 0, 0, time.UTC), Value: sensorHigh},
+	}
+	readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, batch).Return([]error{domain.ErrDuplicate, nil, nil}, nil).Once()
+
+	// Events are detected again for both devices
+	readingsRepo.On("FetchReadings", mock.Anything, userID, mock.Anything, mock.Anything).Return([]domain.Reading{}, nil)
+	eventRepo.On("ReplaceEvents", mock.Anything, userID, known.ID.Hex(), mock.Anything, mock.Anything, []domain.GlucoseEvent{}).Return(nil).Once()
+	eventRepo.On("ReplaceEvents", mock.Anything, userID, created.Hex(), mock.Anything, mock.Anything, []domain.GlucoseEvent{}).Return(nil).Once()
+
+	detector := events.NewDetector(readingsRepo, eventRepo)
+	summary, err := NewImporter(deviceRepo, readingsRepo, detector).Import(context.Background(), user, strings.NewReader(libreViewExport))
+	assert.NoError(t, err)
+
+	assert.Equal(t, FormatLibreView, summary.Format)
+	assert.Equal(t, 2, summary.Accepted)
+	assert.Equal(t, 1, summary.Duplicated)
+	assert.Equal(t, 0, summary.Failed)
+	assert.Equal(t, 1, summary.Rejected)
+	assert.Len(t, summary.Errors, 1)
+	assert.Len(t, summary.Devices, 2)
+	assert.False(t, summary.Devices[0].Created)
+	assert.Equal(t, 1, summary.Devices[0].Accepted)
+	assert.Equal(t, 1, summary.Devices[0].Duplicated)
+	assert.True(t, summary.Devices[1].Created)
+	assert.Equal(t, created.Hex(), summary.Devices[1].DeviceID)
+
+	deviceRepo.AssertExpectations(t)
+	readingsRepo.AssertExpectations(t)
+	eventRepo.AssertExpectations(t)
+}
+
+func TestStoreFailedReadings(t *testing.T) {
+	deviceRepo := new(mocks.DeviceRepository)
+	readingsRepo := new(mocks.ReadingRepository)
+	eventRepo := new(mocks.EventRepository)
+
+	user := domain.User{ID: primitive.NewObjectID()}
+	userID := user.ID.Hex()
+	device := domain.Device{ID: primitive.NewObjectID(), UserID: user.ID, Manufacturer: "Dexcom", SerialNumber: "8ABCDE"}
+	deviceRepo.On("FindByUser", mock.Anything, userID).Return([]domain.Device{device}, nil)
+
+	start := time.Date(2024, 4, 6, 8, 0, 0, 0, time.UTC)
+	readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, mock.Anything).Return([]error{nil, errors.New("write conflict")}, nil).Once()
+	readingsRepo.On("FetchReadings", mock.Anything, userID, mock.Anything, mock.Anything).Return([]domain.Reading{}, nil)
+	eventRepo.On("ReplaceEvents", mock.Anything, userID, device.ID.Hex(), mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+
+	detector := events.NewDetector(readingsRepo, eventRepo)
+	summary, err := NewImporter(deviceRepo, readingsRepo, detector).Store(context.Background(), user, []DeviceReadings{
+		{
+			Device: domain.Device{Manufacturer: "Dexcom", SerialNumber: "8ABCDE"},
+			Entries: []domain.ReadingEntry{
+				{Time: start, Value: 110},
+				{Time: start.Add(5 * time.Minute), Value: 115},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, summary.Accepted)
+	assert.Equal(t, 1, summary.Failed)
+	assert.Equal(t, 1, summary.Devices[0].Failed)
+	assert.Equal(t, start.Add(5*time.Minute), summary.Devices[0].To)
+}
+
+func TestStoreEventDetection(t *testing.T) {
+	user := domain.User{ID: primitive.NewObjectID()}
+	userID := user.ID.Hex()
+	device := domain.Device{ID: primitive.NewObjectID(), UserID: user.ID, Manufacturer: "Dexcom", SerialNumber: "8ABCDE"}
+	start := time.Date(2024, 4, 6, 8, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		results       []error
+		replaceErr    error
+		expectDetect  bool
+		expectErr     error
+		expectSummary int
+	}{
+		{name: "Readings Stored", results: []error{nil}, expectDetect: true, expectSummary: 1},
+		{name: "Detection Failed", results: []error{nil}, replaceErr: errors.New("no primary"), expectDetect: true, expectErr: ErrEventDetection, expectSummary: 1},
+		{name: "Only Duplicates", results: []error{domain.ErrDuplicate}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			deviceRepo := new(mocks.DeviceRepository)
+			readingsRepo := new(mocks.ReadingRepository)
+			eventRepo := new(mocks.EventRepository)
+
+			deviceRepo.On("FindByUser", mock.Anything, userID).Return([]domain.Device{device}, nil)
+			readingsRepo.On("AddReadingsAndUpdateStats", mock.Anything, userID, mock.Anything).Return(tc.results, nil).Once()
+			readingsRepo.On("FetchReadings", mock.Anything, userID, mock.Anything, mock.Anything).Return([]domain.Reading{}, nil).Maybe()
+			eventRepo.On("ReplaceEvents", mock.Anything, userID, device.ID.Hex(), mock.Anything, mock.Anything, mock.Anything).Return(tc.replaceErr).Maybe()
+
+			detector := events.NewDetector(readingsRepo, eventRepo)
+			summary, err := NewImporter(deviceRepo, readingsRepo, detector).Store(context.Background(), user, []DeviceReadings{
+				{
+					Device:  domain.Device{Manufacturer: "Dexcom", SerialNumber: "8ABCDE"},
+					Entries: []domain.ReadingEntry{{Time: start, Value: 110}},
+				},
+			})
+			if tc.expectErr != nil {
+				assert.ErrorIs(t, err, tc.expectErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			// The summary is returned when only the detection failed, the readings are stored
+			assert.Equal(t, tc.expectSummary, summary.Accepted)
+			if tc.expectDetect {
+				eventRepo.AssertNumberOfCalls(t, "ReplaceEvents", 1)
+			} else {
+				eventRepo.AssertNotCalled(t, "ReplaceEvents", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"glooko/internal/domain"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidFile is returned when an upload is not a CSV export in one of the supported formats.
+var ErrInvalidFile = errors.New("invalid import file")
+
+// Format identifies the vendor portal an export was produced by.
+type Format string
+
+const (
+	FormatDexcomClarity Format = "dexcom-clarity"
+	FormatLibreView     Format = "libreview"
+)
+
+// Sensor readings outside of these limits are reported as Low or High by both vendors.
+const (
+	sensorLow  = 40
+	sensorHigh = 400
+)
+
+// headerScanRows is how many leading rows are searched for the column header,
+// LibreView puts a metadata line in front of it.
+const headerScanRows = 5
+
+// RowError describes a data row that could not be imported.
+type RowError struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// DeviceReadings holds the readings of a single device found in an export.
+// Device carries the manufacturer, model and serial number only.
+type DeviceReadings struct {
+	Device  domain.Device
+	Entries []domain.ReadingEntry // mg/dL, sorted by time
+}
+
+// Parsed is the content of an export mapped onto domain types.
+type Parsed struct {
+	Format   Format
+	Devices  []DeviceReadings
+	Rejected []RowError
+}
+
+// Parse detects the format of a Dexcom Clarity or LibreView CSV export and extracts its glucose readings.
+// Timestamps in these exports carry no offset, so they are read as local time in loc.
+func Parse(r io.Reader, loc *time.Location) (Parsed, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	for i := 0; i < headerScanRows; i++ {
+		header, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Parsed{}, errors.Wrap(ErrInvalidFile, err.Error())
+		}
+
+		columns := indexColumns(header)
+		if isDexcomHeader(columns) {
+			return parseRows(reader, FormatDexcomClarity, dexcomParser(columns, loc))
+		}
+		if isLibreViewHeader(columns) {
+			return parseRows(reader, FormatLibreView, libreViewParser(columns, loc))
+		}
+	}
+
+	return Parsed{}, errors.Wrap(ErrInvalidFile, "not a Dexcom Clarity or LibreView export")
+}
+
+// rowParser maps a data row onto a reading. It returns skip for rows that hold other
+// kinds of records, such as insulin or notes.
+type rowParser func(row []string) (device domain.Device, entry domain.ReadingEntry, skip bool, err error)
+
+func parseRows(reader *csv.Reader, format Format, parse rowParser) (Parsed, error) {
+	parsed := Parsed{Format: format}
+	bySerial := map[string]int{}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); ok {
+				parsed.Rejected = append(parsed.Rejected, RowError{Line: line, Reason: err.Error()})
+				continue
+			}
+			return Parsed{}, errors.Wrap(err, "failed to read import file")
+		}
+
+		device, entry, skip, err := parse(row)
+		if skip {
+			continue
+		}
+		if err != nil {
+			parsed.Rejected = append(parsed.Rejected, RowError{Line: line, Reason: err.Error()})
+			continue
+		}
+
+		i, ok := bySerial[device.SerialNumber]
+		if !ok {
+			i = len(parsed.Devices)
+			bySerial[device.SerialNumber] = i
+			parsed.Devices = append(parsed.Devices, DeviceReadings{Device: device})
+		}
+		parsed.Devices[i].Entries = append(parsed.Devices[i].Entries, entry)
+	}
+
+	for _, device := range parsed.Devices {
+		sort.SliceStable(device.Entries, func(i, j int) bool {
+			return device.Entries[i].Time.Before(device.Entries[j].Time)
+		})
+	}
+
+	return parsed, nil
+}
+
+func isDexcomHeader(columns map[string]int) bool {
+	timestampCol, _ := findColumn(columns, "timestamp (")
+	glucoseCol, _ := findColumn(columns, "glucose value (")
+	_, hasEventType := columns["event type"]
+	return timestampCol >= 0 && glucoseCol >= 0 && hasEventType
+}
+
+func dexcomParser(columns map[string]int, loc *time.Location) rowParser {
+	timestampCol, _ := findColumn(columns, "timestamp (")
+	glucoseCol, glucoseHeader := findColumn(columns, "glucose value (")
+	unit := unitFromHeader(glucoseHeader)
+	eventTypeCol := columns["event type"]
+	sourceCol := column(columns, "source device id")
+	transmitterCol := column(columns, "transmitter id")
+
+	return func(row []string) (domain.Device, domain.ReadingEntry, bool, error) {
+		if !strings.EqualFold(field(row, eventTypeCol), "EGV") {
+			return domain.Device{}, domain.ReadingEntry{}, true, nil
+		}
+
+		device := domain.Device{Manufacturer: "Dexcom", Model: "Clarity"}
+		if field(row, sourceCol) != "" {
+			device.Model = field(row, sourceCol)
+		}
+		device.SerialNumber = device.Model
+		if field(row, transmitterCol) != "" {
+			device.SerialNumber = field(row, transmitterCol)
+		}
+
+		timestamp, err := time.ParseInLocation("2006-01-02T15:04:05", field(row, timestampCol), loc)
+		if err != nil {
+			return domain.Device{}, domain.ReadingEntry{}, false, fmt.Errorf("invalid timestamp %q", field(row, timestampCol))
+		}
+
+		value, err := parseGlucose(field(row, glucoseCol), unit)
+		if err != nil {
+			return domain.Device{}, domain.ReadingEntry{}, false, err
+		}
+
+		return device, domain.ReadingEntry{Time: timestamp, Value: value}, false, nil
+	}
+}
+
+// LibreView record types holding glucose values, other types are insulin, food or notes.
+const (
+	libreHistoric = "0"
+	libreScan     = "1"
+)
+
+// libreViewLayouts are the timestamp layouts used by LibreView depending on the account's locale.
+var libreViewLayouts = []string{
+	"01-02-2006 03:04 PM",
+	"02-01-2006 15:04",
+	"2006-01-02 15:04",
+	"01/02/2006 03:04 PM",
+	"02/01/2006 15:04",
+}
+
+func isLibreViewHeader(columns map[string]int) bool {
+	_, hasTimestamp := columns["device timestamp"]
+	_, hasRecordType := columns["record type"]
+	historicCol, _ := findColumn(columns, "historic glucose")
+	return hasTimestamp && hasRecordType && historicCol >= 0
+}
+
+func libreViewParser(columns map[string]int, loc *time.Location) rowParser {
+	deviceCol := column(columns, "device")
+	serialCol := column(columns, "serial number")
+	timestampCol := columns["device timestamp"]
+	recordTypeCol := columns["record type"]
+	historicCol, historicHeader := findColumn(columns, "historic glucose")
+	scanCol, _ := findColumn(columns, "scan glucose")
+	unit := unitFromHeader(historicHeader)
+
+	return func(row []string) (domain.Device, domain.ReadingEntry, bool, error) {
+		var glucose string
+		switch field(row, recordTypeCol) {
+		case libreHistoric:
+			glucose = field(row, historicCol)
+		case libreScan:
+			glucose = field(row, scanCol)
+		default:
+			return domain.Device{}, domain.ReadingEntry{}, true, nil
+		}
+
+		device := domain.Device{
+			Manufacturer: "Abbott",
+			Model:        field(row, deviceCol),
+			SerialNumber: field(row, serialCol),
+		}
+		if device.SerialNumber == "" {
+			return domain.Device{}, domain.ReadingEntry{}, false, errors.New("missing serial number")
+		}
+
+		timestamp, err := parseLibreViewTime(field(row, timestampCol), loc)
+		if err != nil {
+			return domain.Device{}, domain.ReadingEntry{}, false, err
+		}
+
+		value, err := parseGlucose(glucose, unit)
+		if err != nil {
+			return domain.Device{}, domain.ReadingEntry{}, false, err
+		}
+
+		return device, domain.ReadingEntry{Time: timestamp, Value: value}, false, nil
+	}
+}
+
+func parseLibreViewTime(value string, loc *time.Location) (time.Time, error) {
+	for _, layout := range libreViewLayouts {
+		timestamp, err := time.ParseInLocation(layout, value, loc)
+		if err == nil {
+			return timestamp, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+}
+
+// parseGlucose converts a glucose cell to whole mg/dL, mapping the sensor's Low and High markers to its limits.
+func parseGlucose(value string, unit domain.GlucoseUnit) (int, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return 0, errors.New("missing glucose value")
+	case "low", "lo":
+		return sensorLow, nil
+	case "high", "hi":
+		return sensorHigh, nil
+	}
+
+	number, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid glucose value %q", value)
+	}
+	return domain.Glucose{Value: number, Unit: unit}.MgDL(), nil
+}
+
+// unitFromHeader reads the unit out of a column name such as "Glucose Value (mmol/L)", defaulting to mg/dL.
+func unitFromHeader(header string) domain.GlucoseUnit {
+	if strings.Contains(strings.ToLower(header), "mmol") {
+		return domain.MmolL
+	}
+	return domain.MgDL
+}
+
+// indexColumns maps the lower-cased, trimmed column names of header to their position.
+func indexColumns(header []string) map[string]int {
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, ok := columns[name]; !ok {
+			columns[name] = i
+		}
+	}
+	return columns
+}
+
+// column returns the position of the column called name, or -1 when there is none.
+func column(columns map[string]int, name string) int {
+	if i, ok := columns[name]; ok {
+		return i
+	}
+	return -1
+}
+
+// findColumn returns the position and name of the first column starting with prefix, or -1 when there is none.
+func findColumn(columns map[string]int, prefix string) (int, string) {
+	found, foundName := -1, ""
+	for name, i := range columns {
+		if strings.HasPrefix(name, prefix) && (found == -1 || i < found) {
+			found, foundName = i, name
+		}
+	}
+	return found, foundName
+}
+
+func field(row []string, i int) string {
+	if i < 0 || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
@@ -0,0 +1,80 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const dexcomExport = `Index,Timestamp (YYYY-MM-DDThh:mm:ss),Event Type,Event Subtype,Patient Info,Device Info,Source Device ID,Glucose Value (mg/dL),Insulin Value (u),Carb Value (grams),Duration (hh:mm:ss),Glucose Rate of Change (mg/dL/min),Transmitter Time (Long Integer),Transmitter ID
+1,,FirstName,,Jane,,,,,,,,,
+2,,Device,,,Dexcom G6 Mobile App,Android G6,,,,,,,
+3,2024-04-06T08:05:00,EGV,,,,Android G6,112,,,,,1000,8ABCDE
+4,2024-04-06T08:00:00,EGV,,,,Android G6,Low,,,,,700,8ABCDE
+5,2024-04-06T08:10:00,Insulin,Fast-Acting,,,Android G6,,4,,,,,
+6,2024-04-06T08:15:00,EGV,,,,Android G6,abc,,,,,1300,8ABCDE
+7,06/04/2024 08:20,EGV,,,,Android G6,120,,,,,1600,8ABCDE
+`
+
+const libreViewExport = `Glucose Data,Generated on,04-07-2024 10:00 AM UTC,Generated by,Jane Doe
+Device,Serial Number,Device Timestamp,Record Type,Historic Glucose mmol/L,Scan Glucose mmol/L,Non-numeric Rapid-Acting Insulin,Rapid-Acting Insulin (units)
+FreeStyle LibreLink,ABC-123,04-06-2024 08:00 AM,0,5.5,,,
+FreeStyle LibreLink,ABC-123,04-06-2024 08:07 AM,1,,6.2,,
+FreeStyle LibreLink,ABC-123,04-06-2024 08:10 AM,4,,,,2
+FreeStyle Libre 2,XYZ-789,04-06-2024 01:15 PM,0,HI,,,
+FreeStyle Libre 2,,04-06-2024 01:30 PM,0,7.0,,,
+`
+
+func TestParseDexcomClarity(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	parsed, err := Parse(strings.NewReader(dexcomExport), loc)
+	assert.NoError(t, err)
+
+	assert.Equal(t, FormatDexcomClarity, parsed.Format)
+	assert.Len(t, parsed.Devices, 1)
+
+	device := parsed.Devices[0]
+	assert.Equal(t, "Dexcom", device.Device.Manufacturer)
+	assert.Equal(t, "Android G6", device.Device.Model)
+	assert.Equal(t, "8ABCDE", device.Device.SerialNumber)
+	assert.Len(t, device.Entries, 2)
+	assert.Equal(t, time.Date(2024, 4, 6, 12, 0, 0, 0, time.UTC), device.Entries[0].Time.UTC())
+	assert.Equal(t, sensorLow, device.Entries[0].Value)
+	assert.Equal(t, 112, device.Entries[1].Value)
+
+	assert.Equal(t, []RowError{
+		{Line: 7, Reason: `invalid glucose value "abc"`},
+		{Line: 8, Reason: `invalid timestamp "06/04/2024 08:20"`},
+	}, parsed.Rejected)
+}
+
+func TestParseLibreView(t *testing.T) {
+	parsed, err := Parse(strings.NewReader(libreViewExport), time.UTC)
+	assert.NoError(t, err)
+
+	assert.Equal(t, FormatLibreView, parsed.Format)
+	assert.Len(t, parsed.Devices, 2)
+
+	assert.Equal(t, "Abbott", parsed.Devices[0].Device.Manufacturer)
+	assert.Equal(t, "FreeStyle LibreLink", parsed.Devices[0].Device.Model)
+	assert.Equal(t, "ABC-123", parsed.Devices[0].Device.SerialNumber)
+	assert.Len(t, parsed.Devices[0].Entries, 2)
+	assert.Equal(t, 99, parsed.Devices[0].Entries[0].Value)
+	assert.Equal(t, 112, parsed.Devices[0].Entries[1].Value)
+	assert.Equal(t, time.Date(2024, 4, 6, 8, 7, 0, 0, time.UTC), parsed.Devices[0].Entries[1].Time)
+
+	assert.Equal(t, "XYZ-789", parsed.Devices[1].Device.SerialNumber)
+	assert.Equal(t, sensorHigh, parsed.Devices[1].Entries[0].Value)
+	assert.Equal(t, time.Date(2024, 4, 6, 13, 15, 0, 0, time.UTC), parsed.Devices[1].Entries[0].Time)
+
+	assert.Equal(t, []RowError{{Line: 7, Reason: "missing serial number"}}, parsed.Rejected)
+}
+
+func TestParseUnknownFormat(t *testing.T) {
+	_, err := Parse(strings.NewReader("time,value\n2024-04-06T08:00:00Z,100\n"), time.UTC)
+	assert.ErrorIs(t, err, ErrInvalidFile)
+}
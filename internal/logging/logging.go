@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// redacted replaces secrets and personal data in log output.
+const redacted = "***"
+
+// sensitiveKeys are substrings of field keys whose values are never logged.
+var sensitiveKeys = []string{"secret", "password", "token", "authorization", "cookie"}
+
+// patterns match secrets and personal data embedded in messages and error strings, such as
+// MongoDB URIs with credentials or email addresses echoed by duplicate key errors.
+var patterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/\s:@]+(:[^/\s@]*)?@`), "${1}" + redacted + "@"},
+	{regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`), "${1}" + redacted},
+	{regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), redacted},
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)+`), redacted},
+}
+
+// NewProduction builds the production logger of the commands with Redact applied.
+func NewProduction() (*zap.Logger, error) {
+	return zap.NewProduction(zap.WrapCore(Redact))
+}
+
+// Redact wraps core so that secrets and personal data are masked before entries are written:
+// values of fields with a sensitive key are replaced entirely, messages, strings and errors are
+// scrubbed of credentials, bearer tokens and email addresses.
+func Redact(core zapcore.Core) zapcore.Core {
+	return &redactingCore{Core: core}
+}
+
+type redactingCore struct {
+	zapcore.Core
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(redactFields(fields))}
+}
+
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = RedactString(entry.Message)
+	return c.Core.Write(entry, redactFields(fields))
+}
+
+// RedactString masks the credentials, bearer tokens and email addresses in s.
+func RedactString(s string) string {
+	for _, p := range patterns {
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	redactedFields := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		redactedFields[i] = redactField(field)
+	}
+	return redactedFields
+}
+
+func redactField(field zapcore.Field) zapcore.Field {
+	if isSensitiveKey(field.Key) {
+		return zap.String(field.Key, redacted)
+	}
+
+	switch field.Type {
+	case zapcore.StringType:
+		return zap.String(field.Key, RedactString(field.String))
+	case zapcore.ErrorType:
+		if err, ok := field.Interface.(error); ok {
+			return zap.String(field.Key, RedactString(err.Error()))
+		}
+	case zapcore.StringerType:
+		if stringer, ok := field.Interface.(interface{ String() string }); ok {
+			return zap.String(field.Key, RedactString(stringer.String()))
+		}
+	}
+	return field
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRedactString(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "URI Credentials", input: "dial mongodb://admin:hunter2@db:27017/glooko", expected: "dial mongodb://***@db:27017/glooko"},
+		{name: "URI Without Credentials", input: "dial mongodb://db:27017", expected: "dial mongodb://db:27017"},
+		{name: "Bearer Token", input: "Authorization: Bearer abc.def-ghi", expected: "Authorization: Bearer ***"},
+		{name: "JWT", input: "token eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.sig rejected", expected: "token *** rejected"},
+		{name: "Email", input: `E11000 duplicate key { email: "jane.doe@example.com" }`, expected: `E11000 duplicate key { email: "***" }`},
+		{name: "Plain", input: "failed to fetch user 1234567890abcdef12345678", expected: "failed to fetch user 1234567890abcdef12345678"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, RedactString(tc.input))
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	log := zap.New(Redact(core)).Sugar()
+
+	log.With("apiSecret", "plain-secret").Errorw("failed to connect to mongodb://admin:hunter2@db",
+		"error", errors.New("auth failed for jane@example.com"),
+		"user", "jane@example.com",
+		"count", 3,
+	)
+	log.Debug("dropped below the level")
+
+	entries := logs.AllUntimed()
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "failed to connect to mongodb://***@db", entries[0].Message)
+	assert.Equal(t, map[string]interface{}{
+		"apiSecret": "***",
+		"error":     "auth failed for ***",
+		"user":      "***",
+		"count":     int64(3),
+	}, entries[0].ContextMap())
+}
@@ -14,6 +14,82 @@ type DeviceRepository struct {
 	mock.Mock
 }
 
+// Delete provides a mock function with given fields: ctx, id
+func (_m *DeviceRepository) Delete(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Delete")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// FindByID provides a mock function with given fields: ctx, id
+func (_m *DeviceRepository) FindByID(ctx context.Context, id string) (domain.Device, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for FindByID")
+	}
+
+	var r0 domain.Device
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (domain.Device, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) domain.Device); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(domain.Device)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindByUser provides a mock function with given fields: ctx, userID
+func (_m *DeviceRepository) FindByUser(ctx context.Context, userID string) ([]domain.Device, error) {
+	ret := _m.Called(ctx, userID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for FindByUser")
+	}
+
+	var r0 []domain.Device
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]domain.Device, error)); ok {
+		return rf(ctx, userID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []domain.Device); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.Device)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Save provides a mock function with given fields: ctx, device
 func (_m *DeviceRepository) Save(ctx context.Context, device domain.Device) (domain.Device, error) {
 	ret := _m.Called(ctx, device)
@@ -42,6 +118,34 @@ func (_m *DeviceRepository) Save(ctx context.Context, device domain.Device) (dom
 	return r0, r1
 }
 
+// Update provides a mock function with given fields: ctx, id, update
+func (_m *DeviceRepository) Update(ctx context.Context, id string, update domain.DeviceUpdate) (domain.Device, error) {
+	ret := _m.Called(ctx, id, update)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Update")
+	}
+
+	var r0 domain.Device
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, domain.DeviceUpdate) (domain.Device, error)); ok {
+		return rf(ctx, id, update)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, domain.DeviceUpdate) domain.Device); ok {
+		r0 = rf(ctx, id, update)
+	} else {
+		r0 = ret.Get(0).(domain.Device)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, domain.DeviceUpdate) error); ok {
+		r1 = rf(ctx, id, update)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // NewDeviceRepository creates a new instance of DeviceRepository. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewDeviceRepository(t interface {
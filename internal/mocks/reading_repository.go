@@ -34,6 +34,36 @@ func (_m *ReadingRepository) AddReadingAndUpdateStats(ctx context.Context, devic
 	return r0
 }
 
+// AddReadingsAndUpdateStats provides a mock function with given fields: ctx, userID, readings
+func (_m *ReadingRepository) AddReadingsAndUpdateStats(ctx context.Context, userID string, readings []domain.DeviceReading) ([]error, error) {
+	ret := _m.Called(ctx, userID, readings)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddReadingsAndUpdateStats")
+	}
+
+	var r0 []error
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []domain.DeviceReading) ([]error, error)); ok {
+		return rf(ctx, userID, readings)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, []domain.DeviceReading) []error); ok {
+		r0 = rf(ctx, userID, readings)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]error)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, []domain.DeviceReading) error); ok {
+		r1 = rf(ctx, userID, readings)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // FetchDevicesOverview provides a mock function with given fields: ctx, userID, days
 func (_m *ReadingRepository) FetchDevicesOverview(ctx context.Context, userID string, days int) ([]domain.DayDeviceCounts, error) {
 	ret := _m.Called(ctx, userID, days)
@@ -94,6 +124,24 @@ func (_m *ReadingRepository) FetchReadings(ctx context.Context, userID string, s
 	return r0, r1
 }
 
+// StreamReadings provides a mock function with given fields: ctx, userID, startDate, endDate, fn
+func (_m *ReadingRepository) StreamReadings(ctx context.Context, userID string, startDate time.Time, endDate time.Time, fn func(domain.Reading) error) error {
+	ret := _m.Called(ctx, userID, startDate, endDate, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for StreamReadings")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time, time.Time, func(domain.Reading) error) error); ok {
+		r0 = rf(ctx, userID, startDate, endDate, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewReadingRepository creates a new instance of ReadingRepository. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewReadingRepository(t interface {
@@ -8,14 +8,50 @@ import (
 
 type UserRepository interface {
 	Save(ctx context.Context, user domain.User) (domain.User, error)
+	FindByID(ctx context.Context, id string) (domain.User, error)
+	Find(ctx context.Context, filter domain.UserFilter) ([]domain.User, int64, error)
+	Update(ctx context.Context, id string, update domain.UserUpdate) (domain.User, error)
+	Delete(ctx context.Context, id string) error
 }
 
 type DeviceRepository interface {
 	Save(ctx context.Context, device domain.Device) (domain.Device, error)
+	FindByID(ctx context.Context, id string) (domain.Device, error)
+	FindByUser(ctx context.Context, userID string) ([]domain.Device, error)
+	Update(ctx context.Context, id string, update domain.DeviceUpdate) (domain.Device, error)
+	Delete(ctx context.Context, id string) error
 }
 
 type ReadingRepository interface {
+	// AddReadingAndUpdateStats stores a reading in the bucket of the day timestamp falls on in its
+	// own location, so callers pass the timestamp in the patient's time zone. The reading and the
+	// bucket's statistics are updated atomically, concurrent calls never leave them inconsistent.
+	// A reading for a device and timestamp that is already stored is skipped, so retried uploads
+	// don't count twice.
 	AddReadingAndUpdateStats(ctx context.Context, deviceID, userID string, value int, timestamp time.Time) error
+	// AddReadingsAndUpdateStats stores a batch of readings of the user's devices like
+	// AddReadingAndUpdateStats would one by one, in as few round trips as the store allows. The
+	// returned errors line up with readings and are nil for stored readings and ErrDuplicate for
+	// readings skipped as already stored, earlier in the batch included. A reading failing doesn't
+	// fail the others. The error is set when the batch as a whole could not be stored.
+	AddReadingsAndUpdateStats(ctx context.Context, userID string, readings []domain.DeviceReading) ([]error, error)
 	FetchReadings(ctx context.Context, userID string, startDate, endDate time.Time) ([]domain.Reading, error)
+	// StreamReadings calls fn for every daily reading document in the range, in day order,
+	// without loading the whole range into memory. Iteration stops at the first error.
+	StreamReadings(ctx context.Context, userID string, startDate, endDate time.Time, fn func(domain.Reading) error) error
 	FetchDevicesOverview(ctx context.Context, userID string, days int) ([]domain.DayDeviceCounts, error)
 }
+
+type EventRepository interface {
+	// ReplaceEvents replaces the device's events starting between startDate and endDate with
+	// events, all of which start in that window. The events are replaced atomically, readers see
+	// either the old or the new episodes.
+	ReplaceEvents(ctx context.Context, userID, deviceID string, startDate, endDate time.Time, events []domain.GlucoseEvent) error
+	FetchEvents(ctx context.Context, userID string, startDate, endDate time.Time) ([]domain.GlucoseEvent, error)
+}
+
+// AuditRepository is the append-only trail of PHI accesses, entries are never updated or deleted.
+type AuditRepository interface {
+	Record(ctx context.Context, entry domain.AuditEntry) error
+	Find(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEntry, int64, error)
+}
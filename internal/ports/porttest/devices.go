@@ -0,0 +1,153 @@
+package porttest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+	"glooko/internal/ports"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestDeviceRepository checks that newRepository returns a DeviceRepository that saves, finds,
+// updates and deletes devices.
+func TestDeviceRepository(t *testing.T, newRepository func(t *testing.T) ports.DeviceRepository) {
+	ctx := context.Background()
+	repo := newRepository(t)
+
+	activatedAt := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	newDevice := func(userID primitive.ObjectID, serialNumber string) domain.Device {
+		return domain.Device{
+			UserID:       userID,
+			Manufacturer: "Acme",
+			Model:        "X100",
+			SerialNumber: serialNumber,
+			Status:       domain.DeviceActive,
+			ActivatedAt:  activatedAt,
+		}
+	}
+
+	t.Run("Save And Find By ID", func(t *testing.T) {
+		device := newDevice(primitive.NewObjectID(), "SN0001")
+
+		saved, err := repo.Save(ctx, device)
+		require.NoError(t, err)
+		assert.False(t, saved.ID.IsZero())
+
+		found, err := repo.FindByID(ctx, saved.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, saved.ID, found.ID)
+		assert.Equal(t, device.UserID, found.UserID)
+		assert.Equal(t, device.Manufacturer, found.Manufacturer)
+		assert.Equal(t, device.Model, found.Model)
+		assert.Equal(t, device.SerialNumber, found.SerialNumber)
+		assert.Equal(t, device.Status, found.Status)
+		assert.True(t, activatedAt.Equal(found.ActivatedAt))
+		assert.Nil(t, found.ReplacedAt)
+		assert.Nil(t, found.ReplacedBy)
+		assert.Nil(t, found.RetiredAt)
+	})
+
+	t.Run("Save Existing ID", func(t *testing.T) {
+		device := newDevice(primitive.NewObjectID(), "SN0002")
+		device.ID = primitive.NewObjectID()
+
+		_, err := repo.Save(ctx, device)
+		require.NoError(t, err)
+
+		_, err = repo.Save(ctx, device)
+		assert.ErrorIs(t, err, domain.ErrConflict)
+	})
+
+	t.Run("Find By User", func(t *testing.T) {
+		userID := primitive.NewObjectID()
+		var saved []primitive.ObjectID
+		for _, serialNumber := range []string{"SN0003", "SN0004"} {
+			device, err := repo.Save(ctx, newDevice(userID, serialNumber))
+			require.NoError(t, err)
+			saved = append(saved, device.ID)
+		}
+		_, err := repo.Save(ctx, newDevice(primitive.NewObjectID(), "SN0005"))
+		require.NoError(t, err)
+
+		devices, err := repo.FindByUser(ctx, userID.Hex())
+		require.NoError(t, err)
+		require.Len(t, devices, 2)
+		assert.Equal(t, saved[0], devices[0].ID)
+		assert.Equal(t, saved[1], devices[1].ID)
+
+		devices, err = repo.FindByUser(ctx, newID())
+		require.NoError(t, err)
+		assert.NotNil(t, devices)
+		assert.Empty(t, devices)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		saved, err := repo.Save(ctx, newDevice(primitive.NewObjectID(), "SN0006"))
+		require.NoError(t, err)
+
+		status := domain.DeviceReplaced
+		replacedAt := time.Date(2024, time.April, 1, 9, 0, 0, 0, time.UTC)
+		replacedBy := primitive.NewObjectID()
+		updated, err := repo.Update(ctx, saved.ID.Hex(), domain.DeviceUpdate{
+			Status:     &status,
+			ReplacedAt: &replacedAt,
+			ReplacedBy: &replacedBy,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, status, updated.Status)
+		require.NotNil(t, updated.ReplacedAt)
+		assert.True(t, replacedAt.Equal(*updated.ReplacedAt))
+		assert.Equal(t, &replacedBy, updated.ReplacedBy)
+		assert.Equal(t, saved.SerialNumber, updated.SerialNumber)
+
+		found, err := repo.FindByID(ctx, saved.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, status, found.Status)
+
+		unchanged, err := repo.Update(ctx, saved.ID.Hex(), domain.DeviceUpdate{})
+		require.NoError(t, err)
+		assert.Equal(t, status, unchanged.Status)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		saved, err := repo.Save(ctx, newDevice(primitive.NewObjectID(), "SN0007"))
+		require.NoError(t, err)
+
+		err = repo.Delete(ctx, saved.ID.Hex())
+		require.NoError(t, err)
+
+		_, err = repo.FindByID(ctx, saved.ID.Hex())
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+
+		err = repo.Delete(ctx, saved.ID.Hex())
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		_, err := repo.FindByID(ctx, newID())
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+
+		model := "X200"
+		_, err = repo.Update(ctx, newID(), domain.DeviceUpdate{Model: &model})
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+
+	t.Run("Invalid IDs", func(t *testing.T) {
+		_, err := repo.FindByID(ctx, "invalid")
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+
+		_, err = repo.FindByUser(ctx, "invalid")
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+
+		_, err = repo.Update(ctx, "invalid", domain.DeviceUpdate{})
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+
+		err = repo.Delete(ctx, "invalid")
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+	})
+}
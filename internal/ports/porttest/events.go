@@ -0,0 +1,106 @@
+package porttest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+	"glooko/internal/ports"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestEventRepository checks that newRepository returns an EventRepository that replaces a
+// device's events window by window.
+func TestEventRepository(t *testing.T, newRepository func(t *testing.T) ports.EventRepository) {
+	ctx := context.Background()
+	repo := newRepository(t)
+
+	day := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+	windowStart := day
+	windowEnd := day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+
+	newEvent := func(userID, deviceID string, typ domain.EventType, start time.Time, extreme int) domain.GlucoseEvent {
+		userObjectID, _ := primitive.ObjectIDFromHex(userID)
+		deviceObjectID, _ := primitive.ObjectIDFromHex(deviceID)
+		return domain.GlucoseEvent{
+			UserID:   userObjectID,
+			DeviceID: deviceObjectID,
+			Type:     typ,
+			Level:    1,
+			Start:    start,
+			End:      start.Add(30 * time.Minute),
+			Extreme:  extreme,
+		}
+	}
+
+	t.Run("Replaces Events In Window", func(t *testing.T) {
+		userID, deviceID, otherDeviceID := newID(), newID(), newID()
+
+		before := newEvent(userID, deviceID, domain.EventHypoglycemia, day.Add(-time.Hour), 60)
+		err := repo.ReplaceEvents(ctx, userID, deviceID, day.AddDate(0, 0, -1), day.Add(-time.Nanosecond), []domain.GlucoseEvent{before})
+		require.NoError(t, err)
+
+		other := newEvent(userID, otherDeviceID, domain.EventHypoglycemia, day.Add(8*time.Hour), 65)
+		err = repo.ReplaceEvents(ctx, userID, otherDeviceID, windowStart, windowEnd, []domain.GlucoseEvent{other})
+		require.NoError(t, err)
+
+		// A first detection finds two episodes, the next one only a longer hyperglycemia
+		err = repo.ReplaceEvents(ctx, userID, deviceID, windowStart, windowEnd, []domain.GlucoseEvent{
+			newEvent(userID, deviceID, domain.EventHypoglycemia, day.Add(8*time.Hour), 62),
+			newEvent(userID, deviceID, domain.EventHyperglycemia, day.Add(12*time.Hour), 260),
+		})
+		require.NoError(t, err)
+
+		hyper := newEvent(userID, deviceID, domain.EventHyperglycemia, day.Add(12*time.Hour), 280)
+		hyper.End = hyper.Start.Add(2 * time.Hour)
+		err = repo.ReplaceEvents(ctx, userID, deviceID, windowStart, windowEnd, []domain.GlucoseEvent{hyper})
+		require.NoError(t, err)
+
+		events, err := repo.FetchEvents(ctx, userID, day.AddDate(0, 0, -1), windowEnd)
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+
+		assert.Equal(t, deviceID, events[0].DeviceID.Hex())
+		assert.True(t, events[0].Start.Equal(before.Start), "start %s", events[0].Start)
+
+		assert.Equal(t, otherDeviceID, events[1].DeviceID.Hex())
+		assert.Equal(t, 65, events[1].Extreme)
+
+		assert.Equal(t, deviceID, events[2].DeviceID.Hex())
+		assert.Equal(t, domain.EventHyperglycemia, events[2].Type)
+		assert.Equal(t, 280, events[2].Extreme)
+		assert.True(t, events[2].End.Equal(hyper.End), "end %s", events[2].End)
+		assert.False(t, events[2].ID.IsZero())
+	})
+
+	t.Run("Empty Replacement Clears Window", func(t *testing.T) {
+		userID, deviceID := newID(), newID()
+
+		err := repo.ReplaceEvents(ctx, userID, deviceID, windowStart, windowEnd, []domain.GlucoseEvent{
+			newEvent(userID, deviceID, domain.EventHypoglycemia, day.Add(8*time.Hour), 62),
+		})
+		require.NoError(t, err)
+
+		err = repo.ReplaceEvents(ctx, userID, deviceID, windowStart, windowEnd, []domain.GlucoseEvent{})
+		require.NoError(t, err)
+
+		events, err := repo.FetchEvents(ctx, userID, windowStart, windowEnd)
+		require.NoError(t, err)
+		assert.Empty(t, events)
+	})
+
+	t.Run("Invalid IDs", func(t *testing.T) {
+		err := repo.ReplaceEvents(ctx, "invalid", newID(), windowStart, windowEnd, nil)
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+
+		err = repo.ReplaceEvents(ctx, newID(), "invalid", windowStart, windowEnd, nil)
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+
+		_, err = repo.FetchEvents(ctx, "invalid", windowStart, windowEnd)
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+	})
+}
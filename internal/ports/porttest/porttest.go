@@ -0,0 +1,29 @@
+// Package porttest holds conformance tests for implementations of the repository ports. Every
+// adapter runs them from its own tests, so the adapters agree on bucketing, statistics, range
+// boundaries, ordering and errors:
+//
+//	func TestReadingRepository(t *testing.T) {
+//		porttest.TestReadingRepository(t, func(t *testing.T) ports.ReadingRepository {
+//			return NewReadingRepository(NewStore())
+//		})
+//	}
+//
+// The tests create their own users, devices and readings under fresh IDs and names, they may run
+// against a database shared with other data.
+package porttest
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newID returns a fresh ID in the form the ports take them.
+func newID() string {
+	return primitive.NewObjectID().Hex()
+}
+
+// at returns the given minute in loc.
+func at(loc *time.Location, year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, loc)
+}
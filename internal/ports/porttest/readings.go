@@ -0,0 +1,421 @@
+package porttest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+	"glooko/internal/ports"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReadingRepository checks that newRepository returns a ReadingRepository that keeps one
+// bucket per user, device and local day with the statistics of its readings.
+func TestReadingRepository(t *testing.T, newRepository func(t *testing.T) ports.ReadingRepository) {
+	ctx := context.Background()
+	repo := newRepository(t)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	t.Run("Buckets By Device And Local Day", func(t *testing.T) {
+		userID, deviceID, otherDeviceID := newID(), newID(), newID()
+
+		// 23:30 in New York is 03:30 UTC on the next day, the reading belongs to the local day
+		readings := []struct {
+			deviceID string
+			value    int
+			time     time.Time
+		}{
+			{deviceID, 100, at(newYork, 2024, time.April, 1, 8, 0)},
+			{deviceID, 140, at(newYork, 2024, time.April, 1, 23, 30)},
+			{otherDeviceID, 180, at(newYork, 2024, time.April, 1, 12, 0)},
+			{deviceID, 120, at(newYork, 2024, time.April, 2, 0, 30)},
+		}
+		for _, reading := range readings {
+			err := repo.AddReadingAndUpdateStats(ctx, reading.deviceID, userID, reading.value, reading.time)
+			require.NoError(t, err)
+		}
+
+		april1 := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+		april2 := april1.AddDate(0, 0, 1)
+
+		fetched, err := repo.FetchReadings(ctx, userID, april1, april2)
+		require.NoError(t, err)
+		require.Len(t, fetched, 3)
+
+		buckets := map[string]domain.Reading{}
+		for _, reading := range fetched {
+			buckets[reading.DeviceID.Hex()+reading.Day.Format(time.DateOnly)] = reading
+			assert.Equal(t, userID, reading.UserID.Hex())
+		}
+
+		first := buckets[deviceID+"2024-04-01"]
+		assert.True(t, first.Day.Equal(april1), "day %s", first.Day)
+		assert.Equal(t, 2, first.CountReadings)
+		assert.Equal(t, []int{100, 140}, values(first.Readings))
+
+		other := buckets[otherDeviceID+"2024-04-01"]
+		assert.Equal(t, 1, other.CountReadings)
+
+		second := buckets[deviceID+"2024-04-02"]
+		assert.True(t, second.Day.Equal(april2), "day %s", second.Day)
+		assert.Equal(t, []int{120}, values(second.Readings))
+		assert.True(t, second.Readings[0].Time.Equal(readings[3].time))
+	})
+
+	t.Run("Keeps Stats", func(t *testing.T) {
+		userID, deviceID := newID(), newID()
+		day := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+		for i, value := range []int{120, 80, 190, 110} {
+			err := repo.AddReadingAndUpdateStats(ctx, deviceID, userID, value, day.Add(time.Duration(i)*time.Hour))
+			require.NoError(t, err)
+		}
+
+		fetched, err := repo.FetchReadings(ctx, userID, day, day)
+		require.NoError(t, err)
+		require.Len(t, fetched, 1)
+
+		reading := fetched[0]
+		assert.Equal(t, 80, reading.MinValue)
+		assert.Equal(t, 190, reading.MaxValue)
+		assert.Equal(t, 500, reading.SumValues)
+		assert.Equal(t, 4, reading.CountReadings)
+		assert.Equal(t, 125.0, reading.AvgValue)
+		assert.Equal(t, []int{120, 80, 190, 110}, values(reading.Readings))
+	})
+
+	t.Run("Idempotent On Device And Time", func(t *testing.T) {
+		userID, deviceID, otherDeviceID := newID(), newID(), newID()
+		timestamp := time.Date(2024, time.May, 2, 8, 0, 0, 0, time.UTC)
+
+		// A re-upload of the same reading, a correction at the same time and another device's reading
+		for _, reading := range []struct {
+			deviceID string
+			value    int
+		}{{deviceID, 120}, {deviceID, 120}, {deviceID, 125}, {otherDeviceID, 120}} {
+			err := repo.AddReadingAndUpdateStats(ctx, reading.deviceID, userID, reading.value, timestamp)
+			require.NoError(t, err)
+		}
+		err := repo.AddReadingAndUpdateStats(ctx, deviceID, userID, 140, timestamp.Add(5*time.Minute))
+		require.NoError(t, err)
+
+		fetched, err := repo.FetchReadings(ctx, userID, domain.DayOf(timestamp), domain.DayOf(timestamp))
+		require.NoError(t, err)
+		require.Len(t, fetched, 2)
+
+		for _, reading := range fetched {
+			if reading.DeviceID.Hex() == otherDeviceID {
+				assert.Equal(t, []int{120}, values(reading.Readings))
+				continue
+			}
+			assert.Equal(t, []int{120, 140}, values(reading.Readings))
+			assert.Equal(t, 2, reading.CountReadings)
+			assert.Equal(t, 260, reading.SumValues)
+			assert.Equal(t, 120, reading.MinValue)
+			assert.Equal(t, 140, reading.MaxValue)
+			assert.Equal(t, 130.0, reading.AvgValue)
+		}
+	})
+
+	t.Run("Millisecond Precision", func(t *testing.T) {
+		userID, deviceID := newID(), newID()
+		stored := at(newYork, 2024, time.April, 1, 6, 0).Add(250 * time.Microsecond)
+		err := repo.AddReadingAndUpdateStats(ctx, deviceID, userID, 90, stored)
+		require.NoError(t, err)
+
+		// Readings are identified by their time to the millisecond
+		results, err := repo.AddReadingsAndUpdateStats(ctx, userID, []domain.DeviceReading{
+			{DeviceID: deviceID, Time: stored.Add(500 * time.Microsecond), Value: 95},
+			{DeviceID: deviceID, Time: stored.Add(time.Millisecond), Value: 100},
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.ErrorIs(t, results[0], domain.ErrDuplicate)
+		assert.NoError(t, results[1])
+
+		april1 := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+		fetched, err := repo.FetchReadings(ctx, userID, april1, april1)
+		require.NoError(t, err)
+		require.Len(t, fetched, 1)
+		assert.Equal(t, []int{90, 100}, values(fetched[0].Readings))
+		assert.Equal(t, stored.UnixMilli(), fetched[0].Readings[0].Time.UnixMilli())
+		assert.Zero(t, fetched[0].Readings[0].Time.Nanosecond()%int(time.Millisecond))
+	})
+
+	t.Run("Batch Ingestion", func(t *testing.T) {
+		userID, deviceID, otherDeviceID := newID(), newID(), newID()
+		stored := at(newYork, 2024, time.April, 1, 6, 0)
+		err := repo.AddReadingAndUpdateStats(ctx, deviceID, userID, 90, stored)
+		require.NoError(t, err)
+
+		// Repeats of the stored reading and of one within the batch are skipped as duplicates, the
+		// malformed device ID only fails its own reading
+		batch := []domain.DeviceReading{
+			{DeviceID: deviceID, Time: at(newYork, 2024, time.April, 1, 8, 0), Value: 100},
+			{DeviceID: deviceID, Time: stored, Value: 90},
+			{DeviceID: "invalid", Time: at(newYork, 2024, time.April, 1, 9, 0), Value: 160},
+			{DeviceID: deviceID, Time: at(newYork, 2024, time.April, 1, 23, 30), Value: 140},
+			{DeviceID: otherDeviceID, Time: at(newYork, 2024, time.April, 1, 12, 0), Value: 180},
+			{DeviceID: deviceID, Time: at(newYork, 2024, time.April, 2, 0, 30), Value: 120},
+			{DeviceID: deviceID, Time: at(newYork, 2024, time.April, 1, 8, 0), Value: 100},
+		}
+		results, err := repo.AddReadingsAndUpdateStats(ctx, userID, batch)
+		require.NoError(t, err)
+		require.Len(t, results, len(batch))
+		for i, result := range results {
+			switch i {
+			case 1, 6:
+				assert.ErrorIs(t, result, domain.ErrDuplicate, "reading %d", i)
+			case 2:
+				assert.ErrorIs(t, result, domain.ErrInvalidID)
+			default:
+				assert.NoError(t, result, "reading %d", i)
+			}
+		}
+
+		april1 := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+		april2 := april1.AddDate(0, 0, 1)
+
+		fetched, err := repo.FetchReadings(ctx, userID, april1, april2)
+		require.NoError(t, err)
+		require.Len(t, fetched, 3)
+
+		buckets := map[string]domain.Reading{}
+		for _, reading := range fetched {
+			buckets[reading.DeviceID.Hex()+reading.Day.Format(time.DateOnly)] = reading
+		}
+
+		first := buckets[deviceID+"2024-04-01"]
+		assert.Equal(t, []int{90, 100, 140}, values(first.Readings))
+		assert.Equal(t, 3, first.CountReadings)
+		assert.Equal(t, 330, first.SumValues)
+		assert.Equal(t, 90, first.MinValue)
+		assert.Equal(t, 140, first.MaxValue)
+		assert.Equal(t, 110.0, first.AvgValue)
+
+		assert.Equal(t, []int{180}, values(buckets[otherDeviceID+"2024-04-01"].Readings))
+		assert.Equal(t, []int{120}, values(buckets[deviceID+"2024-04-02"].Readings))
+	})
+
+	t.Run("Range Boundaries", func(t *testing.T) {
+		userID, deviceID := newID(), newID()
+		start := time.Date(2024, time.June, 10, 0, 0, 0, 0, time.UTC)
+		end := start.AddDate(0, 0, 2)
+
+		// One reading on each day from the day before start to the day after end
+		for day := -1; day <= 3; day++ {
+			timestamp := start.AddDate(0, 0, day).Add(12 * time.Hour)
+			err := repo.AddReadingAndUpdateStats(ctx, deviceID, userID, 100+day, timestamp)
+			require.NoError(t, err)
+		}
+
+		fetched, err := repo.FetchReadings(ctx, userID, start, end)
+		require.NoError(t, err)
+		require.Len(t, fetched, 3)
+		for i, reading := range fetched {
+			assert.True(t, reading.Day.Equal(start.AddDate(0, 0, i)), "day %d is %s", i, reading.Day)
+		}
+
+		var streamed []domain.Reading
+		err = repo.StreamReadings(ctx, userID, start, end, func(reading domain.Reading) error {
+			streamed = append(streamed, reading)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, len(fetched), len(streamed))
+		for i := range streamed {
+			assert.True(t, streamed[i].Day.Equal(fetched[i].Day))
+		}
+
+		fetched, err = repo.FetchReadings(ctx, userID, end.AddDate(0, 0, 5), end.AddDate(0, 0, 6))
+		require.NoError(t, err)
+		assert.Empty(t, fetched)
+	})
+
+	t.Run("Streams In Day And Device Order", func(t *testing.T) {
+		userID := newID()
+		deviceIDs := []string{newID(), newID()}
+		day := time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC)
+
+		// Inserted newest day and last device first
+		for i := 2; i >= 0; i-- {
+			for j := len(deviceIDs) - 1; j >= 0; j-- {
+				err := repo.AddReadingAndUpdateStats(ctx, deviceIDs[j], userID, 100, day.AddDate(0, 0, i))
+				require.NoError(t, err)
+			}
+		}
+
+		var streamed []domain.Reading
+		err := repo.StreamReadings(ctx, userID, day, day.AddDate(0, 0, 2), func(reading domain.Reading) error {
+			streamed = append(streamed, reading)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, streamed, 6)
+		for i, reading := range streamed {
+			assert.True(t, reading.Day.Equal(day.AddDate(0, 0, i/2)), "reading %d is on %s", i, reading.Day)
+			assert.Equal(t, deviceIDs[i%2], reading.DeviceID.Hex(), "reading %d", i)
+		}
+
+		calls := 0
+		err = repo.StreamReadings(ctx, userID, day, day.AddDate(0, 0, 2), func(domain.Reading) error {
+			calls++
+			return assert.AnError
+		})
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Devices Overview", func(t *testing.T) {
+		userID, deviceID, otherDeviceID := newID(), newID(), newID()
+		// Readings at noon keep clear of the day boundaries
+		now := domain.DayOf(time.Now().UTC()).Add(12 * time.Hour)
+
+		add := func(deviceID string, timestamp time.Time, count int) {
+			for i := 0; i < count; i++ {
+				err := repo.AddReadingAndUpdateStats(ctx, deviceID, userID, 100, timestamp.Add(-time.Duration(i)*time.Second))
+				require.NoError(t, err)
+			}
+		}
+		add(deviceID, now, 3)
+		add(otherDeviceID, now, 1)
+		add(deviceID, now.AddDate(0, 0, -2), 2)
+		add(deviceID, now.AddDate(0, 0, -30), 5)
+
+		overview, err := repo.FetchDevicesOverview(ctx, userID, 7)
+		require.NoError(t, err)
+		require.Len(t, overview, 2)
+
+		assert.True(t, overview[0].Day.Equal(domain.DayOf(now).AddDate(0, 0, -2)))
+		assert.Equal(t, []domain.DeviceCount{{DeviceID: deviceID, Count: 2}}, overview[0].Devices)
+
+		assert.True(t, overview[1].Day.Equal(domain.DayOf(now)))
+		assert.ElementsMatch(t, []domain.DeviceCount{
+			{DeviceID: deviceID, Count: 3},
+			{DeviceID: otherDeviceID, Count: 1},
+		}, overview[1].Devices)
+	})
+
+	t.Run("Concurrent Inserts", func(t *testing.T) {
+		userID, deviceID := newID(), newID()
+		day := time.Date(2024, time.August, 1, 0, 0, 0, 0, time.UTC)
+
+		const writers, perWriter = 8, 25
+		var wg sync.WaitGroup
+		errs := make(chan error, writers*perWriter)
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < perWriter; i++ {
+					value := 40 + w*perWriter + i
+					timestamp := day.Add(time.Duration(w*perWriter+i) * time.Minute)
+					errs <- repo.AddReadingAndUpdateStats(ctx, deviceID, userID, value, timestamp)
+				}
+			}(w)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		fetched, err := repo.FetchReadings(ctx, userID, day, day)
+		require.NoError(t, err)
+		require.Len(t, fetched, 1, "concurrent inserts must share one bucket")
+
+		// Values are 40 to 239, one each
+		reading := fetched[0]
+		assert.Len(t, reading.Readings, writers*perWriter)
+		assert.Equal(t, writers*perWriter, reading.CountReadings)
+		assert.Equal(t, 40, reading.MinValue)
+		assert.Equal(t, 239, reading.MaxValue)
+		assert.Equal(t, 27900, reading.SumValues)
+		assert.Equal(t, 139.5, reading.AvgValue)
+	})
+
+	t.Run("Stats Consistent Under Parallel Ingestion", func(t *testing.T) {
+		userID := newID()
+		deviceIDs := []string{newID(), newID(), newID()}
+		day := time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC)
+
+		// Every writer feeds every device on three days, interleaving with the other writers
+		const writers, days, perDay = 6, 3, 10
+		var wg sync.WaitGroup
+		errs := make(chan error, writers*len(deviceIDs)*days*perDay)
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < perDay; i++ {
+					for d := 0; d < days; d++ {
+						for _, deviceID := range deviceIDs {
+							timestamp := day.AddDate(0, 0, d).Add(time.Duration(w*perDay+i) * time.Minute)
+							errs <- repo.AddReadingAndUpdateStats(ctx, deviceID, userID, 50+w*perDay+i, timestamp)
+						}
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		fetched, err := repo.FetchReadings(ctx, userID, day, day.AddDate(0, 0, days-1))
+		require.NoError(t, err)
+		require.Len(t, fetched, days*len(deviceIDs))
+
+		// Values are 50 to 109 in every bucket
+		for _, reading := range fetched {
+			sum := 0
+			for _, entry := range reading.Readings {
+				sum += entry.Value
+			}
+			assert.Equal(t, writers*perDay, reading.CountReadings)
+			assert.Equal(t, len(reading.Readings), reading.CountReadings)
+			assert.Equal(t, sum, reading.SumValues)
+			assert.Equal(t, 4770, reading.SumValues)
+			assert.Equal(t, 50, reading.MinValue)
+			assert.Equal(t, 109, reading.MaxValue)
+			assert.Equal(t, float64(reading.SumValues)/float64(reading.CountReadings), reading.AvgValue)
+		}
+	})
+
+	t.Run("Invalid IDs", func(t *testing.T) {
+		day := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+		err := repo.AddReadingAndUpdateStats(ctx, newID(), "invalid", 100, day)
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+
+		err = repo.AddReadingAndUpdateStats(ctx, "invalid", newID(), 100, day)
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+
+		_, err = repo.AddReadingsAndUpdateStats(ctx, "invalid", []domain.DeviceReading{{DeviceID: newID(), Time: day, Value: 100}})
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+
+		_, err = repo.FetchReadings(ctx, "invalid", day, day)
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+
+		err = repo.StreamReadings(ctx, "invalid", day, day, func(domain.Reading) error { return nil })
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+
+		_, err = repo.FetchDevicesOverview(ctx, "invalid", 7)
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+	})
+}
+
+func values(entries []domain.ReadingEntry) []int {
+	values := make([]int, len(entries))
+	for i, entry := range entries {
+		values[i] = entry.Value
+	}
+	return values
+}
@@ -0,0 +1,179 @@
+package porttest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"glooko/internal/domain"
+	"glooko/internal/ports"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestUserRepository checks that newRepository returns a UserRepository that saves, finds,
+// updates and deletes users.
+func TestUserRepository(t *testing.T, newRepository func(t *testing.T) ports.UserRepository) {
+	ctx := context.Background()
+	repo := newRepository(t)
+
+	// Names and emails unique to this run keep listings clear of other data
+	run := newID()
+	newUser := func(firstName, lastName, queue string) domain.User {
+		return domain.User{
+			FirstName:    firstName,
+			LastName:     lastName,
+			DateOfBirth:  time.Date(1980, time.January, 2, 0, 0, 0, 0, time.UTC),
+			Email:        fmt.Sprintf("%s.%s.%s@example.com", firstName, lastName, run),
+			PhoneNumber:  "555-0100",
+			SupportQueue: queue,
+		}
+	}
+
+	t.Run("Save And Find By ID", func(t *testing.T) {
+		user := newUser("Ada", "Lovelace"+run, "emea")
+		user.Timezone = "Europe/London"
+		user.Unit = domain.MmolL
+		user.TargetRange = &domain.TargetRange{VeryLow: 54, Low: 70, High: 180, VeryHigh: 250}
+		user.CareTeam = []string{"clinician-1"}
+
+		saved, err := repo.Save(ctx, user)
+		require.NoError(t, err)
+		assert.False(t, saved.ID.IsZero())
+
+		found, err := repo.FindByID(ctx, saved.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, saved.ID, found.ID)
+		assert.Equal(t, user.FirstName, found.FirstName)
+		assert.Equal(t, user.LastName, found.LastName)
+		assert.True(t, user.DateOfBirth.Equal(found.DateOfBirth))
+		assert.Equal(t, user.Email, found.Email)
+		assert.Equal(t, user.PhoneNumber, found.PhoneNumber)
+		assert.Equal(t, user.Timezone, found.Timezone)
+		assert.Equal(t, user.Unit, found.Unit)
+		assert.Equal(t, user.TargetRange, found.TargetRange)
+		assert.Equal(t, user.SupportQueue, found.SupportQueue)
+		assert.Equal(t, user.CareTeam, found.CareTeam)
+	})
+
+	t.Run("Save Existing ID", func(t *testing.T) {
+		user := newUser("Grace", "Hopper"+run, "")
+		user.ID = primitive.NewObjectID()
+
+		_, err := repo.Save(ctx, user)
+		require.NoError(t, err)
+
+		_, err = repo.Save(ctx, user)
+		assert.ErrorIs(t, err, domain.ErrConflict)
+	})
+
+	t.Run("Find", func(t *testing.T) {
+		lastName := "Find" + run
+		queue := "queue-" + run
+		for _, user := range []domain.User{
+			newUser("Carol", lastName+"b", queue),
+			newUser("Alice", lastName+"a", ""),
+			newUser("Bob", lastName+"a", queue),
+		} {
+			_, err := repo.Save(ctx, user)
+			require.NoError(t, err)
+		}
+
+		firstNames := func(users []domain.User) []string {
+			names := make([]string, len(users))
+			for i, user := range users {
+				names[i] = user.FirstName
+			}
+			return names
+		}
+
+		tests := []struct {
+			name     string
+			filter   domain.UserFilter
+			expected []string
+			total    int64
+		}{
+			{"Last Name Prefix Sorted", domain.UserFilter{LastName: lastName}, []string{"Alice", "Bob", "Carol"}, 3},
+			{"Last Name Case Insensitive", domain.UserFilter{LastName: "find" + run + "A"}, []string{"Alice", "Bob"}, 2},
+			{"Email", domain.UserFilter{Email: fmt.Sprintf("Bob.%sa.%s@example.com", lastName, run)}, []string{"Bob"}, 1},
+			{"Support Queues", domain.UserFilter{LastName: lastName, SupportQueues: []string{queue}}, []string{"Bob", "Carol"}, 2},
+			{"No Support Queues", domain.UserFilter{LastName: lastName, SupportQueues: []string{}}, []string{}, 0},
+			{"Page", domain.UserFilter{LastName: lastName, Limit: 1, Offset: 1}, []string{"Bob"}, 3},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				users, total, err := repo.Find(ctx, tt.filter)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, firstNames(users))
+				assert.Equal(t, tt.total, total)
+			})
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		saved, err := repo.Save(ctx, newUser("Edsger", "Dijkstra"+run, "emea"))
+		require.NoError(t, err)
+
+		timezone := "Europe/Amsterdam"
+		careTeam := []string{"clinician-2", "caregiver-1"}
+		updated, err := repo.Update(ctx, saved.ID.Hex(), domain.UserUpdate{Timezone: &timezone, CareTeam: &careTeam})
+		require.NoError(t, err)
+		assert.Equal(t, timezone, updated.Timezone)
+		assert.Equal(t, careTeam, updated.CareTeam)
+		assert.Equal(t, saved.FirstName, updated.FirstName)
+		assert.Equal(t, saved.SupportQueue, updated.SupportQueue)
+
+		found, err := repo.FindByID(ctx, saved.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, timezone, found.Timezone)
+
+		secretHash := "5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8"
+		updated, err = repo.Update(ctx, saved.ID.Hex(), domain.UserUpdate{NightscoutSecretHash: &secretHash})
+		require.NoError(t, err)
+		assert.Equal(t, secretHash, updated.NightscoutSecretHash)
+		assert.Equal(t, careTeam, updated.CareTeam)
+
+		unchanged, err := repo.Update(ctx, saved.ID.Hex(), domain.UserUpdate{})
+		require.NoError(t, err)
+		assert.Equal(t, timezone, unchanged.Timezone)
+		assert.Equal(t, secretHash, unchanged.NightscoutSecretHash)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		saved, err := repo.Save(ctx, newUser("Alan", "Turing"+run, ""))
+		require.NoError(t, err)
+
+		err = repo.Delete(ctx, saved.ID.Hex())
+		require.NoError(t, err)
+
+		_, err = repo.FindByID(ctx, saved.ID.Hex())
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+
+		err = repo.Delete(ctx, saved.ID.Hex())
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		_, err := repo.FindByID(ctx, newID())
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+
+		firstName := "Nobody"
+		_, err = repo.Update(ctx, newID(), domain.UserUpdate{FirstName: &firstName})
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+
+	t.Run("Invalid IDs", func(t *testing.T) {
+		_, err := repo.FindByID(ctx, "invalid")
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+
+		_, err = repo.Update(ctx, "invalid", domain.UserUpdate{})
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+
+		err = repo.Delete(ctx, "invalid")
+		assert.ErrorIs(t, err, domain.ErrInvalidID)
+	})
+}
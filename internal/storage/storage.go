@@ -0,0 +1,73 @@
+// Package storage opens the repositories of the storage driver selected in the config.
+package storage
+
+import (
+	"context"
+	"glooko/internal/adapters/memory"
+	"glooko/internal/adapters/mongodb"
+	"glooko/internal/adapters/postgres"
+	"glooko/internal/config"
+	"glooko/internal/ports"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DriverMongoDB  = "mongodb"
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+)
+
+// Repositories are the repositories of one storage driver. MongoDB is set for the mongodb driver
+// only, for the commands that manage collections directly.
+type Repositories struct {
+	Users    ports.UserRepository
+	Devices  ports.DeviceRepository
+	Readings ports.ReadingRepository
+	Events   ports.EventRepository
+	Audit    ports.AuditRepository
+
+	MongoDB *mongodb.MongoDB
+}
+
+// Open connects to the storage selected by cfg.StorageDriver. The postgres driver migrates the
+// schema on connect, data of the memory driver lives as long as the process.
+func Open(ctx context.Context, cfg *config.Config) (*Repositories, error) {
+	switch cfg.StorageDriver {
+	case DriverMongoDB:
+		mongoDB, err := mongodb.NewMongoDB(ctx, cfg.MongoDBURI.Reveal(), cfg.MongoDBName)
+		if err != nil {
+			return nil, err
+		}
+		return &Repositories{
+			Users:    mongodb.NewUserRepository(mongoDB),
+			Devices:  mongodb.NewDeviceRepository(mongoDB),
+			Readings: mongodb.NewReadingRepository(mongoDB),
+			Events:   mongodb.NewEventRepository(mongoDB),
+			Audit:    mongodb.NewAuditRepository(mongoDB),
+			MongoDB:  mongoDB,
+		}, nil
+	case DriverPostgres:
+		postgresDB, err := postgres.NewPostgres(ctx, cfg.PostgresURL.Reveal())
+		if err != nil {
+			return nil, err
+		}
+		return &Repositories{
+			Users:    postgres.NewUserRepository(postgresDB),
+			Devices:  postgres.NewDeviceRepository(postgresDB),
+			Readings: postgres.NewReadingRepository(postgresDB),
+			Events:   postgres.NewEventRepository(postgresDB),
+			Audit:    postgres.NewAuditRepository(postgresDB),
+		}, nil
+	case DriverMemory:
+		store := memory.NewStore()
+		return &Repositories{
+			Users:    memory.NewUserRepository(store),
+			Devices:  memory.NewDeviceRepository(store),
+			Readings: memory.NewReadingRepository(store),
+			Events:   memory.NewEventRepository(store),
+			Audit:    memory.NewAuditRepository(store),
+		}, nil
+	}
+	return nil, errors.Errorf("unknown storage driver %q", cfg.StorageDriver)
+}